@@ -25,9 +25,21 @@ type Application struct {
 	Name       string
 	Path       string              `yaml:",omitempty"`
 	Routes     []map[string]string `yaml:",omitempty"`
+	Metadata   *Metadata           `yaml:",omitempty"`
+}
+
+type Metadata struct {
+	Labels      map[string]string `yaml:",omitempty"`
+	Annotations map[string]string `yaml:",omitempty"`
 }
 
 var Push = func(appName string, args ...string) *gexec.Session {
+	return PushWithLabels(nil, appName, args...)
+}
+
+// PushWithLabels is Push for an app that gets the labels, such as the
+// ownership labels of a ReproducibleTestSuiteSetup.
+var PushWithLabels = func(labels map[string]string, appName string, args ...string) *gexec.Session {
 	tmpDir, err := os.MkdirTemp("", "")
 	if err != nil {
 		panic(err)
@@ -67,6 +79,10 @@ var Push = func(appName string, args ...string) *gexec.Session {
 		}
 	}
 
+	if len(labels) > 0 {
+		app.Metadata = &Metadata{Labels: labels}
+	}
+
 	manifest := Manifest{}
 
 	manifest.Applications = append(manifest.Applications, app)
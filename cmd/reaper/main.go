@@ -0,0 +1,93 @@
+// Command reaper deletes Cloud Foundry resources left behind by crashed test
+// suites. It uses the target and token of the cf CLI unless told otherwise:
+//
+//	cf login -a api.example.com -u admin
+//	go run github.com/cloudfoundry/cf-test-helpers/v2/cmd/reaper -prefix CATS -older-than 6h -dry-run
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/cf-test-helpers/v2/reaper"
+)
+
+type cfConfig struct {
+	Target      string
+	AccessToken string
+	SSLDisabled bool
+}
+
+func main() {
+	config := readCfConfig()
+
+	apiUrl := flag.String("api", config.Target, "Cloud Controller API URL, defaults to the cf CLI's target")
+	token := flag.String("token", os.Getenv("CF_OAUTH_TOKEN"), "OAuth token, defaults to $CF_OAUTH_TOKEN or the cf CLI's token")
+	skipSSLValidation := flag.Bool("skip-ssl-validation", config.SSLDisabled, "skip verification of the API's certificate")
+	caCertFile := flag.String("ca-cert-file", os.Getenv("SSL_CERT_FILE"), "CA bundle to trust in place of the system roots, such as the suite config's ca_cert_file, defaults to $SSL_CERT_FILE")
+	namePrefix := flag.String("prefix", "", "name prefix of the test suites whose resources to delete (required)")
+	olderThan := flag.Duration("older-than", time.Hour, "only delete resources created longer ago than this")
+	kinds := flag.String("kinds", "all", "comma separated kinds of resources to delete: "+kindNames())
+	dryRun := flag.Bool("dry-run", false, "only list the resources that would be deleted")
+	flag.Parse()
+
+	if *token == "" {
+		*token = config.AccessToken
+	}
+	if *namePrefix == "" || *apiUrl == "" || *token == "" {
+		fmt.Fprintln(os.Stderr, "reaper needs a name prefix, an API URL and a token") // nolint:errcheck
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	parsedKinds, err := reaper.ParseKinds(*kinds)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err) // nolint:errcheck
+		os.Exit(2)
+	}
+
+	client, err := reaper.NewClient(*apiUrl, *token, *skipSSLValidation, *caCertFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err) // nolint:errcheck
+		os.Exit(2)
+	}
+
+	r := reaper.NewReaper(client, *namePrefix, os.Stdout)
+	r.OlderThan = *olderThan
+	r.Kinds = parsedKinds
+	r.DryRun = *dryRun
+
+	_, err = r.Reap()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err) // nolint:errcheck
+		os.Exit(1)
+	}
+}
+
+func readCfConfig() cfConfig {
+	var config cfConfig
+
+	cfHome := os.Getenv("CF_HOME")
+	if cfHome == "" {
+		cfHome, _ = os.UserHomeDir()
+	}
+
+	contents, err := os.ReadFile(filepath.Join(cfHome, ".cf", "config.json"))
+	if err == nil {
+		_ = json.Unmarshal(contents, &config)
+	}
+	return config
+}
+
+func kindNames() string {
+	names := make([]string, 0, len(reaper.AllKinds))
+	for _, kind := range reaper.AllKinds {
+		names = append(names, string(kind))
+	}
+	return strings.Join(names, ", ")
+}
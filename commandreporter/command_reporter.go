@@ -7,6 +7,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/cloudfoundry/cf-test-helpers/v2/internal/secrets"
 	"github.com/onsi/ginkgo/v2"
 )
 
@@ -46,7 +47,7 @@ func (r *CommandReporter) Report(startTime time.Time, cmd *exec.Cmd) {
 		"\n%s[%s]> %s %s\n",
 		startColor,
 		startTime.UTC().Format(timeFormat),
-		strings.Join(cmd.Args, " "),
+		secrets.Redact(strings.Join(cmd.Args, " ")),
 		endColor,
 	)
 	if err != nil {
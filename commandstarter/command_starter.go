@@ -2,16 +2,20 @@ package commandstarter
 
 import (
 	"io"
+	"os"
 	"os/exec"
 	"time"
 
 	"github.com/cloudfoundry/cf-test-helpers/v2/internal"
+	"github.com/cloudfoundry/cf-test-helpers/v2/internal/secrets"
 	"github.com/onsi/ginkgo/v2"
 	"github.com/onsi/gomega/gexec"
 )
 
 type CommandStarter struct {
-	stdin io.Reader
+	stdin    io.Reader
+	env      []string
+	noOutput bool
 }
 
 func NewCommandStarter() *CommandStarter {
@@ -24,10 +28,47 @@ func NewCommandStarterWithStdin(stdin io.Reader) *CommandStarter {
 	}
 }
 
+// NewCommandStarterWithEnv returns a starter whose commands run with the
+// given KEY=value pairs added to the environment of the current process.
+func NewCommandStarterWithEnv(env ...string) *CommandStarter {
+	return &CommandStarter{
+		env: env,
+	}
+}
+
+// WithEnv returns a copy of the starter that adds the given KEY=value pairs to
+// the environment of its commands, on top of any it already adds.
+func (r *CommandStarter) WithEnv(env ...string) internal.Starter {
+	return &CommandStarter{
+		stdin:    r.stdin,
+		env:      append(append([]string{}, r.env...), env...),
+		noOutput: r.noOutput,
+	}
+}
+
+// WithoutOutput returns a copy of the starter whose commands do not write
+// their output to the GinkgoWriter, for output that holds secrets.
+func (r *CommandStarter) WithoutOutput() internal.Starter {
+	return &CommandStarter{
+		stdin:    r.stdin,
+		env:      r.env,
+		noOutput: true,
+	}
+}
+
 func (r *CommandStarter) Start(reporter internal.Reporter, executable string, args ...string) (*gexec.Session, error) {
 	cmd := exec.Command(executable, args...)
 	cmd.Stdin = r.stdin
+	if len(r.env) > 0 {
+		cmd.Env = append(os.Environ(), r.env...)
+	}
 	reporter.Report(time.Now(), cmd)
 
-	return gexec.Start(cmd, ginkgo.GinkgoWriter, ginkgo.GinkgoWriter)
+	if r.noOutput {
+		return gexec.Start(cmd, nil, nil)
+	}
+	// The output goes through the redactor of secrets the helpers came
+	// across, such as binding credentials.
+	output := secrets.Writer(ginkgo.GinkgoWriter)
+	return gexec.Start(cmd, output, output)
 }
@@ -3,14 +3,17 @@ package commandstarter_test
 import (
 	"bytes"
 	"io"
+	"os"
 	"os/exec"
 	"time"
 
 	"github.com/cloudfoundry/cf-test-helpers/v2/commandstarter"
+	"github.com/cloudfoundry/cf-test-helpers/v2/internal/secrets"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	. "github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
 )
 
 type fakeReporter struct {
@@ -41,6 +44,28 @@ var _ = Describe("CommandStarter", func() {
 		Eventually(session).Should(Say("hello world"))
 	})
 
+	It("leaves the registered secrets out of the output it writes", func() {
+		secrets.Register("hunter22")
+		DeferCleanup(secrets.Reset)
+
+		session, err := cmdStarter.Start(reporter, "bash", "-c", "echo \"password: hunter22\"")
+		Expect(err).To(Succeed())
+		Eventually(session).Should(gexec.Exit(0))
+
+		Expect(session.Out).To(Say("password: hunter22"))
+		Expect(string(CurrentSpecReport().CapturedGinkgoWriterOutput)).To(ContainSubstring("password: [REDACTED]"))
+		Expect(string(CurrentSpecReport().CapturedGinkgoWriterOutput)).NotTo(ContainSubstring("hunter22"))
+	})
+
+	It("does not write the output of a copy made with WithoutOutput", func() {
+		session, err := cmdStarter.WithoutOutput().Start(reporter, "bash", "-c", "echo \"token: not-for-the-logs\"")
+		Expect(err).To(Succeed())
+		Eventually(session).Should(gexec.Exit(0))
+
+		Expect(session.Out).To(Say("token: not-for-the-logs"))
+		Expect(string(CurrentSpecReport().CapturedGinkgoWriterOutput)).NotTo(ContainSubstring("not-for-the-logs"))
+	})
+
 	When("created with stdin", func() {
 		var stdin io.Reader
 
@@ -56,4 +81,27 @@ var _ = Describe("CommandStarter", func() {
 			Eventually(session).Should(Say("hello name from input"))
 		})
 	})
+
+	When("created with env", func() {
+		BeforeEach(func() {
+			cmdStarter = commandstarter.NewCommandStarterWithEnv("CF_TEST_HELPERS_GREETING=hello from env")
+		})
+
+		It("adds the env to the environment of the command", func() {
+			session, err := cmdStarter.Start(reporter, "bash", "-c", `echo "$CF_TEST_HELPERS_GREETING and $HOME"`)
+			Expect(err).To(Succeed())
+			Eventually(session).Should(Say("hello from env and " + os.Getenv("HOME")))
+		})
+
+		It("adds more env to a copy of the starter with WithEnv", func() {
+			session, err := cmdStarter.WithEnv("CF_HOME=/some/cf/home").Start(reporter, "bash", "-c", `echo "$CF_TEST_HELPERS_GREETING in $CF_HOME"`)
+			Expect(err).To(Succeed())
+			Eventually(session).Should(Say("hello from env in /some/cf/home"))
+
+			session, err = cmdStarter.Start(reporter, "bash", "-c", `echo "[$CF_HOME]"`)
+			Expect(err).To(Succeed())
+			Eventually(session).Should(gexec.Exit(0))
+			Expect(session.Out).NotTo(Say("/some/cf/home"))
+		})
+	})
 })
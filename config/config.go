@@ -42,8 +42,18 @@ type Config struct {
 	SkipSSLValidation bool   `json:"skip_ssl_validation"`
 	Backend           string `json:"backend"`
 
+	CACertFile     string `json:"ca_cert_file"`
+	ClientCertFile string `json:"client_cert_file"`
+	ClientKeyFile  string `json:"client_key_file"`
+
 	ArtifactsDirectory string `json:"artifacts_directory"`
 
+	// KeepResourcesOnFailure keeps the space, org and user of a failed suite
+	// for inspection. ReproducibleTestSuiteSetup only knows that a spec
+	// failed when the suite calls its RecordSpecReport from a
+	// ReportAfterEach, or sets its HasFailed.
+	KeepResourcesOnFailure bool `json:"keep_resources_on_failure"`
+
 	DefaultTimeout               int `json:"default_timeout"`
 	SleepTimeout                 int `json:"sleep_timeout"`
 	DetectTimeout                int `json:"detect_timeout"`
@@ -233,6 +243,18 @@ func (c *Config) GetSkipSSLValidation() bool {
 	return c.SkipSSLValidation
 }
 
+func (c *Config) GetCACertFile() string {
+	return c.CACertFile
+}
+
+func (c *Config) GetClientCertFile() string {
+	return c.ClientCertFile
+}
+
+func (c *Config) GetClientKeyFile() string {
+	return c.ClientKeyFile
+}
+
 func (c *Config) GetArtifactsDirectory() string {
 	return c.ArtifactsDirectory
 }
@@ -273,6 +295,10 @@ func (c *Config) GetShouldKeepUser() bool {
 	return c.ShouldKeepUser
 }
 
+func (c *Config) GetKeepResourcesOnFailure() bool {
+	return c.KeepResourcesOnFailure
+}
+
 func (c *Config) GetAdminUser() string {
 	return c.AdminUser
 }
@@ -60,6 +60,7 @@ var _ = Describe("Config", func() {
 		Expect(config.UseExistingOrganization).To(BeFalse())
 		Expect(config.UseExistingSpace).To(BeFalse())
 		Expect(config.ExistingOrganization).To(BeEmpty())
+		Expect(config.KeepResourcesOnFailure).To(BeFalse())
 		Expect(config.DefaultTimeout).To(Equal(30))
 		Expect(config.DefaultTimeoutDuration()).To(Equal(30 * time.Second))
 		Expect(config.CfPushTimeout).To(Equal(2))
@@ -104,4 +105,15 @@ var _ = Describe("Config", func() {
 		}
 		Expect(cfg.GetAppsDomain()).To(Equal("abc.com"))
 	})
+
+	It("should have functions to get the TLS files", func() {
+		cfg := cfg.Config{
+			CACertFile:     "/path/to/ca.pem",
+			ClientCertFile: "/path/to/client.pem",
+			ClientKeyFile:  "/path/to/client.key",
+		}
+		Expect(cfg.GetCACertFile()).To(Equal("/path/to/ca.pem"))
+		Expect(cfg.GetClientCertFile()).To(Equal("/path/to/client.pem"))
+		Expect(cfg.GetClientKeyFile()).To(Equal("/path/to/client.key"))
+	})
 })
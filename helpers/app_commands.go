@@ -8,6 +8,13 @@ import (
 
 const CURL_TIMEOUT = 60 * time.Second
 
+type RetryPolicy = helpersinternal.RetryPolicy
+
+// Returns a policy that retries gorouter 404s for unknown routes, 502s and 503s for up to maxDuration
+func DefaultRetryPolicy(maxDuration time.Duration) RetryPolicy {
+	return helpersinternal.DefaultRetryPolicy(maxDuration)
+}
+
 // Gets an app's endpoint with the specified path
 func AppUri(appName, path string, config helpersinternal.CurlConfig) string {
 	uriCreator := &helpersinternal.AppUriCreator{CurlConfig: config}
@@ -27,6 +34,12 @@ func CurlApp(cfg helpersinternal.CurlConfig, appName, path string, args ...strin
 	return appCurler.CurlAndWait(cfg, appName, path, CURL_TIMEOUT, args...)
 }
 
+// Curls an app's endpoint, retrying according to the policy until it responds successfully
+func CurlAppWithRetry(cfg helpersinternal.CurlConfig, appName, path string, policy RetryPolicy, args ...string) string {
+	appCurler := helpersinternal.NewAppCurler(Curl, cfg)
+	return appCurler.CurlWithRetry(cfg, appName, path, CURL_TIMEOUT, policy, args...)
+}
+
 // Curls an app's endpoint and returns the body content and the HTTP status code
 func CurlAppWithStatusCode(cfg helpersinternal.CurlConfig, appName, path string, args ...string) string {
 	appCurler := helpersinternal.NewAppCurler(Curl, cfg)
@@ -0,0 +1,31 @@
+package helpers
+
+import (
+	helpersinternal "github.com/cloudfoundry/cf-test-helpers/v2/helpers/internal"
+	"github.com/onsi/gomega/types"
+)
+
+type ProbeResult = helpersinternal.ProbeResult
+type ProbeResponse = helpersinternal.ProbeResponse
+type KeyExtractor = helpersinternal.KeyExtractor
+
+// Curls an app's endpoint the given number of times, up to parallelism at once, and counts the responses by key
+func ProbeApp(cfg helpersinternal.CurlConfig, appName, path string, requests, parallelism int, extract KeyExtractor, args ...string) ProbeResult {
+	prober := helpersinternal.NewAppProber(Curl, cfg, parallelism, CURL_TIMEOUT)
+	return prober.Probe(cfg, appName, path, requests, extract, args...)
+}
+
+// Counts probe responses by their trimmed body
+func ByBody() KeyExtractor {
+	return helpersinternal.ByBody()
+}
+
+// Counts probe responses by the value of a response header
+func ByHeader(name string) KeyExtractor {
+	return helpersinternal.ByHeader(name)
+}
+
+// Matches a ProbeResult that saw responses from exactly the given number of instances and no failures
+func HitAllInstances(instances int) types.GomegaMatcher {
+	return helpersinternal.HitAllInstances(instances)
+}
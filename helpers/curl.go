@@ -10,7 +10,8 @@ import (
 
 func Curl(cfg helpersinternal.CurlConfig, args ...string) *gexec.Session {
 	cmdStarter := commandstarter.NewCommandStarter()
-	return helpersinternal.Curl(cmdStarter, cfg.GetSkipSSLValidation(), args...)
+	curlArgs := append(helpersinternal.CurlTLSArgs(cfg), args...)
+	return helpersinternal.Curl(cmdStarter, cfg.GetSkipSSLValidation(), curlArgs...)
 }
 
 func CurlRedact(stringToRedact string, cfg helpersinternal.CurlConfig, args ...string) *gexec.Session {
@@ -18,7 +19,8 @@ func CurlRedact(stringToRedact string, cfg helpersinternal.CurlConfig, args ...s
 	redactor := internal.NewRedactor(stringToRedact)
 	redactingReporter := internal.NewRedactingReporter(ginkgo.GinkgoWriter, redactor)
 
-	return helpersinternal.CurlWithCustomReporter(cmdStarter, redactingReporter, cfg.GetSkipSSLValidation(), args...)
+	curlArgs := append(helpersinternal.CurlTLSArgs(cfg), args...)
+	return helpersinternal.CurlWithCustomReporter(cmdStarter, redactingReporter, cfg.GetSkipSSLValidation(), curlArgs...)
 }
 
 func CurlSkipSSL(skip bool, args ...string) *gexec.Session {
@@ -0,0 +1,20 @@
+package helpers
+
+import (
+	helpersinternal "github.com/cloudfoundry/cf-test-helpers/v2/helpers/internal"
+)
+
+type HTTP2ProbeResult = helpersinternal.HTTP2ProbeResult
+type GRPCHealthResult = helpersinternal.GRPCHealthResult
+
+// Requests an app's endpoint over HTTP/2 (h2 for https, h2c for http) and reports the negotiated protocol
+func ProbeHTTP2(cfg helpersinternal.CurlConfig, appName, path string) (HTTP2ProbeResult, error) {
+	prober := helpersinternal.NewHTTP2Prober(cfg, CURL_TIMEOUT)
+	return prober.Probe(cfg, appName, path)
+}
+
+// Calls the standard gRPC health check of an app for the given service, or the whole server when service is empty
+func GRPCHealthCheck(cfg helpersinternal.CurlConfig, appName, service string) (GRPCHealthResult, error) {
+	prober := helpersinternal.NewHTTP2Prober(cfg, CURL_TIMEOUT)
+	return prober.GRPCHealthCheck(cfg, appName, service)
+}
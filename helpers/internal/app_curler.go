@@ -1,19 +1,30 @@
 package helpersinternal
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/onsi/ginkgo/v2"
 	"github.com/onsi/gomega"
 	"github.com/onsi/gomega/gexec"
 )
 
+const timeFormat = "2006-01-02 15:04:05.00 (MST)"
+
 type uriCreator interface {
 	AppUri(appName, path string) string
+	RouteUri(route Route) string
 }
 
 type AppCurler struct {
 	CurlFunc   func(CurlConfig, ...string) *gexec.Session
 	UriCreator uriCreator
+
+	// FailHandler reports a curl that never succeeded. It defaults to
+	// ginkgo.Fail.
+	FailHandler func(message string, callerSkip ...int)
 }
 
 func NewAppCurler(curlFunc func(CurlConfig, ...string) *gexec.Session, cfg CurlConfig) *AppCurler {
@@ -35,6 +46,22 @@ func (appCurler *AppCurler) CurlAndWait(cfg CurlConfig, appName string, path str
 	return string(curlCmd.Out.Contents())
 }
 
+// CurlRouteAndWait curls the given route using the HTTP version the route asks
+// for. TCP routes cannot be curled; use TCPRequest for them instead.
+func (appCurler *AppCurler) CurlRouteAndWait(cfg CurlConfig, route Route, timeout time.Duration, args ...string) string {
+	gomega.ExpectWithOffset(3, route.Protocol).NotTo(gomega.Equal(RouteProtocolTCP), "TCP routes cannot be curled, use TCPRequest instead")
+
+	routeUri := appCurler.UriCreator.RouteUri(route)
+	curlArgs := append(route.CurlArgs(route.Scheme(cfg.Protocol())), routeUri)
+	curlArgs = append(curlArgs, args...)
+
+	curlCmd := appCurler.CurlFunc(cfg, curlArgs...).Wait(timeout)
+
+	gomega.ExpectWithOffset(3, curlCmd).To(gexec.Exit(0))
+	gomega.ExpectWithOffset(3, string(curlCmd.Err.Contents())).To(gomega.HaveLen(0))
+	return string(curlCmd.Out.Contents())
+}
+
 func (appCurler *AppCurler) CurlWithStatusCode(cfg CurlConfig, appName string, path string, timeout time.Duration, args ...string) string {
 	appUri := appCurler.UriCreator.AppUri(appName, path)
 	curlArgs := append([]string{"-s", "-w", "\n%{http_code}", appUri}, args...)
@@ -45,3 +72,91 @@ func (appCurler *AppCurler) CurlWithStatusCode(cfg CurlConfig, appName string, p
 	gomega.ExpectWithOffset(3, string(curlCmd.Err.Contents())).To(gomega.HaveLen(0))
 	return string(curlCmd.Out.Contents())
 }
+
+// CurlWithRetry curls the app until it responds successfully according to the
+// given policy, giving each attempt up to timeout to complete. It fails with a
+// summary of every attempt when the policy's MaxDuration is exhausted.
+func (appCurler *AppCurler) CurlWithRetry(cfg CurlConfig, appName string, path string, timeout time.Duration, policy RetryPolicy, args ...string) string {
+	appUri := appCurler.UriCreator.AppUri(appName, path)
+	curlArgs := append([]string{"-w", "\n%{http_code}", appUri}, args...)
+
+	conditions, err := policy.retryConditions()
+	if err != nil {
+		appCurler.fail(err.Error(), 2)
+		return ""
+	}
+
+	start := time.Now()
+	var attempts []curlAttempt
+	var pause time.Duration
+	for {
+		attempt, body, succeeded := appCurler.curlOnce(cfg, curlArgs, timeout, conditions)
+		attempt.number = len(attempts) + 1
+		attempt.elapsed = time.Since(start)
+		attempts = append(attempts, attempt)
+
+		if succeeded {
+			return body
+		}
+
+		_, err := fmt.Fprintf(ginkgo.GinkgoWriter, "\n[%s]> Retrying curl %s: %s\n", time.Now().UTC().Format(timeFormat), appUri, attempt)
+		if err != nil {
+			panic(err)
+		}
+
+		pause = policy.backoff(pause)
+		if time.Since(start)+pause >= policy.MaxDuration {
+			break
+		}
+		time.Sleep(policy.withJitter(pause))
+	}
+
+	appCurler.fail(retrySummary(appUri, attempts), 2)
+	return ""
+}
+
+func (appCurler *AppCurler) fail(message string, callerSkip int) {
+	failHandler := appCurler.FailHandler
+	if failHandler == nil {
+		failHandler = ginkgo.Fail
+	}
+	failHandler(message, callerSkip+1)
+}
+
+func (appCurler *AppCurler) curlOnce(cfg CurlConfig, curlArgs []string, timeout time.Duration, conditions retryConditions) (curlAttempt, string, bool) {
+	curlCmd := appCurler.CurlFunc(cfg, curlArgs...)
+
+	if !waitForExit(curlCmd, timeout) {
+		return curlAttempt{exitCode: curlCmd.ExitCode(), reason: fmt.Sprintf("timed out after %s", timeout)}, "", false
+	}
+
+	attempt := curlAttempt{exitCode: curlCmd.ExitCode()}
+	stderr := strings.TrimSpace(string(curlCmd.Err.Contents()))
+	if curlCmd.ExitCode() != 0 || stderr != "" {
+		attempt.reason = fmt.Sprintf("stderr %q", stderr)
+		return attempt, "", false
+	}
+
+	body, statusCode := splitStatusCode(string(curlCmd.Out.Contents()))
+	attempt.statusCode = statusCode
+	if retry, reason := conditions.shouldRetry(statusCode, body); retry {
+		attempt.reason = reason
+		return attempt, body, false
+	}
+
+	return attempt, body, true
+}
+
+func splitStatusCode(output string) (string, int) {
+	output = strings.TrimSuffix(output, "\n")
+	index := strings.LastIndex(output, "\n")
+	statusCode, err := strconv.Atoi(strings.TrimSpace(output[index+1:]))
+	if err != nil {
+		return output, 0
+	}
+
+	if index < 0 {
+		return "", statusCode
+	}
+	return output[:index], statusCode
+}
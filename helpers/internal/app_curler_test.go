@@ -14,13 +14,19 @@ import (
 )
 
 type fakeUriCreator struct {
-	toReturn string
+	toReturn      string
+	receivedRoute Route
 }
 
 func (fake *fakeUriCreator) AppUri(appName, path string) string {
 	return fake.toReturn
 }
 
+func (fake *fakeUriCreator) RouteUri(route Route) string {
+	fake.receivedRoute = route
+	return fake.toReturn
+}
+
 var _ = Describe("AppCurler", func() {
 	var appCurler *AppCurler
 	var curlStub func(CurlConfig, ...string) *gexec.Session
@@ -138,4 +144,177 @@ var _ = Describe("AppCurler", func() {
 			})
 		})
 	})
+
+	Describe("CurlWithRetry", func() {
+		var cfg config.Config
+		var policy RetryPolicy
+		var outputs []string
+		var calls int
+		var receivedArgs []string
+
+		BeforeEach(func() {
+			cfg = config.Config{}
+			calls = 0
+			outputs = []string{}
+			policy = RetryPolicy{
+				MaxDuration:         time.Second,
+				InitialBackoff:      time.Millisecond,
+				RetryOnStatusCodes:  []int{502},
+				RetryOnBodyPatterns: []string{GorouterRouteNotFoundPattern},
+			}
+
+			curlStub = func(cfg CurlConfig, args ...string) *gexec.Session {
+				receivedArgs = args
+				output := outputs[len(outputs)-1]
+				if calls < len(outputs) {
+					output = outputs[calls]
+				}
+				calls++
+
+				cmd := exec.Command("bash", "-c", output)
+				session, _ := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
+				return session
+			}
+
+			uriCreator = &fakeUriCreator{
+				toReturn: "my-app.my-domain.org/path",
+			}
+		})
+
+		It("asks curl for the status code and passes any args on", func() {
+			outputs = []string{`printf "ok\n200"`}
+
+			appCurler.CurlWithRetry(&cfg, "my-app", "/path", time.Second, policy, "arg1")
+			Expect(receivedArgs).To(Equal([]string{"-w", "\n%{http_code}", "my-app.my-domain.org/path", "arg1"}))
+		})
+
+		It("retries on matching status codes and body patterns until it succeeds", func() {
+			outputs = []string{
+				`printf "404 Not Found: Requested route ('my-app.my-domain.org') does not exist.\n404"`,
+				`printf "502 Bad Gateway\n502"`,
+				`printf "hello\nworld\n200"`,
+			}
+
+			Expect(appCurler.CurlWithRetry(&cfg, "my-app", "/path", time.Second, policy)).To(Equal("hello\nworld"))
+			Expect(calls).To(Equal(3))
+		})
+
+		It("does not retry a status code that is not in the policy", func() {
+			outputs = []string{`printf "not here\n404"`}
+
+			Expect(appCurler.CurlWithRetry(&cfg, "my-app", "/path", time.Second, policy)).To(Equal("not here"))
+			Expect(calls).To(Equal(1))
+		})
+
+		It("retries when curl fails", func() {
+			outputs = []string{`echo "connection refused" >&2; exit 7`, `printf "ok\n200"`}
+
+			Expect(appCurler.CurlWithRetry(&cfg, "my-app", "/path", time.Second, policy)).To(Equal("ok"))
+			Expect(calls).To(Equal(2))
+		})
+
+		It("retries when an attempt times out", func() {
+			outputs = []string{`sleep 1`, `printf "ok\n200"`}
+
+			Expect(appCurler.CurlWithRetry(&cfg, "my-app", "/path", 50*time.Millisecond, policy)).To(Equal("ok"))
+			Expect(calls).To(Equal(2))
+		})
+
+		It("fails before curling when a body pattern does not compile", func() {
+			outputs = []string{`printf "ok\n200"`}
+			policy.RetryOnBodyPatterns = []string{"("}
+			var failures []string
+			appCurler.FailHandler = func(message string, callerSkip ...int) {
+				failures = append(failures, message)
+			}
+
+			appCurler.CurlWithRetry(&cfg, "my-app", "/path", time.Second, policy)
+
+			Expect(calls).To(Equal(0))
+			Expect(failures).To(ConsistOf(ContainSubstring(`invalid retry body pattern "("`)))
+		})
+
+		Context("when the policy's max duration is exhausted", func() {
+			BeforeEach(func() {
+				policy.MaxDuration = 100 * time.Millisecond
+				policy.InitialBackoff = 10 * time.Millisecond
+				outputs = []string{`echo "connection refused" >&2; exit 7`, `printf "502 Bad Gateway\n502"`}
+			})
+
+			It("fails with a summary of every attempt", func() {
+				var failures []string
+				appCurler.FailHandler = func(message string, callerSkip ...int) {
+					failures = append(failures, message)
+				}
+
+				appCurler.CurlWithRetry(&cfg, "my-app", "/path", time.Second, policy)
+
+				Expect(calls).To(BeNumerically(">", 2))
+				Expect(failures).To(HaveLen(1))
+				Expect(failures[0]).To(ContainSubstring(fmt.Sprintf("curl my-app.my-domain.org/path did not succeed after %d attempts", calls)))
+				Expect(failures[0]).To(ContainSubstring(`attempt 1 after`))
+				Expect(failures[0]).To(ContainSubstring(`exit code 7, status code 0, stderr "connection refused"`))
+				Expect(failures[0]).To(ContainSubstring(`exit code 0, status code 502, retryable status code`))
+			})
+		})
+	})
+
+	Describe("CurlRouteAndWait", func() {
+		var cfg config.Config
+		var receivedArgs []string
+
+		BeforeEach(func() {
+			cfg = config.Config{}
+			receivedArgs = []string{}
+
+			curlStub = func(cfg CurlConfig, args ...string) *gexec.Session {
+				receivedArgs = args
+
+				cmd := exec.Command("bash", "-c", "echo ok")
+				session, _ := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
+				return session
+			}
+
+			uriCreator = &fakeUriCreator{
+				toReturn: "https://my-app.my-domain.org/path",
+			}
+		})
+
+		It("curls the route uri, as computed by the uriCreator", func() {
+			route := Route{Host: "my-app", Path: "/path"}
+
+			Expect(appCurler.CurlRouteAndWait(&cfg, route, time.Second, "arg1")).To(Equal("ok\n"))
+			Expect(uriCreator.receivedRoute).To(Equal(route))
+			Expect(receivedArgs).To(Equal([]string{"https://my-app.my-domain.org/path", "arg1"}))
+		})
+
+		It("asks for http2 when the route uses it", func() {
+			appCurler.CurlRouteAndWait(&cfg, Route{Host: "my-app", Protocol: RouteProtocolHTTP2}, time.Second)
+			Expect(receivedArgs).To(Equal([]string{"--http2", "https://my-app.my-domain.org/path"}))
+		})
+
+		It("asks for http2 with prior knowledge when the route uses it over http", func() {
+			cfg.UseHttp = true
+
+			appCurler.CurlRouteAndWait(&cfg, Route{Host: "my-app", Protocol: RouteProtocolHTTP2}, time.Second)
+			Expect(receivedArgs).To(Equal([]string{"--http2-prior-knowledge", "https://my-app.my-domain.org/path"}))
+		})
+
+		It("asks for http2 with prior knowledge on internal routes, which always use http", func() {
+			route := NewInternalRoute("my-app", 8080)
+			route.Protocol = RouteProtocolHTTP2
+			uriCreator.toReturn = "http://my-app.apps.internal:8080"
+
+			appCurler.CurlRouteAndWait(&cfg, route, time.Second)
+			Expect(receivedArgs).To(Equal([]string{"--http2-prior-knowledge", "http://my-app.apps.internal:8080"}))
+		})
+
+		It("raises a ginkgo error for TCP routes", func() {
+			failures := InterceptGomegaFailures(func() {
+				appCurler.CurlRouteAndWait(&cfg, NewTCPRoute("tcp.my-domain.org", 1024), time.Second)
+			})
+
+			Expect(failures).To(ContainElement(ContainSubstring("TCP routes cannot be curled")))
+		})
+	})
 })
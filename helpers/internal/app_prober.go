@@ -0,0 +1,243 @@
+package helpersinternal
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/onsi/gomega/gexec"
+)
+
+// ProbeResponse is a single response received while probing an app.
+type ProbeResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       string
+	Latency    time.Duration
+}
+
+// KeyExtractor maps a response to the key it is counted under, for example
+// the index of the instance that served it.
+type KeyExtractor func(ProbeResponse) string
+
+// ByBody counts responses by their trimmed body, which suits apps that reply
+// with their CF_INSTANCE_INDEX or CF_INSTANCE_GUID.
+func ByBody() KeyExtractor {
+	return func(response ProbeResponse) string {
+		return strings.TrimSpace(response.Body)
+	}
+}
+
+// ByHeader counts responses by the value of the given response header.
+func ByHeader(name string) KeyExtractor {
+	return func(response ProbeResponse) string {
+		return response.Header.Get(name)
+	}
+}
+
+type ProbeResult struct {
+	Requests  int
+	Counts    map[string]int
+	Failures  []string
+	Latencies []time.Duration
+}
+
+// Percentile returns the latency below which the given percentage of
+// successful responses fall.
+func (result ProbeResult) Percentile(percentile float64) time.Duration {
+	if len(result.Latencies) == 0 {
+		return 0
+	}
+
+	latencies := append([]time.Duration{}, result.Latencies...)
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	index := int(float64(len(latencies))*percentile/100+0.5) - 1
+	if index < 0 {
+		index = 0
+	}
+	if index >= len(latencies) {
+		index = len(latencies) - 1
+	}
+
+	return latencies[index]
+}
+
+func (result ProbeResult) LatencySummary() string {
+	return fmt.Sprintf("p50=%s p90=%s p99=%s max=%s",
+		result.Percentile(50), result.Percentile(90), result.Percentile(99), result.Percentile(100))
+}
+
+func (result ProbeResult) String() string {
+	keys := make([]string, 0, len(result.Counts))
+	for key := range result.Counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	counts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		counts = append(counts, fmt.Sprintf("%q: %d", key, result.Counts[key]))
+	}
+
+	return fmt.Sprintf("%d requests, %d failed, counts {%s}, latency %s",
+		result.Requests, len(result.Failures), strings.Join(counts, ", "), result.LatencySummary())
+}
+
+type AppProber struct {
+	CurlFunc    func(CurlConfig, ...string) *gexec.Session
+	UriCreator  uriCreator
+	Parallelism int
+	Timeout     time.Duration
+}
+
+func NewAppProber(curlFunc func(CurlConfig, ...string) *gexec.Session, cfg CurlConfig, parallelism int, timeout time.Duration) *AppProber {
+	return &AppProber{
+		CurlFunc:    curlFunc,
+		UriCreator:  &AppUriCreator{CurlConfig: cfg},
+		Parallelism: parallelism,
+		Timeout:     timeout,
+	}
+}
+
+// Probe curls the app the given number of times, running up to Parallelism
+// curls at once, and counts successful responses by the extracted key.
+// Responses with a status code outside 2xx, such as gorouter 404s and 502s,
+// are recorded as failures.
+func (prober *AppProber) Probe(cfg CurlConfig, appName, path string, requests int, extract KeyExtractor, args ...string) ProbeResult {
+	appUri := prober.UriCreator.AppUri(appName, path)
+	curlArgs := append([]string{"--include", "-w", "\n%{time_total}", appUri}, args...)
+
+	parallelism := prober.Parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	result := ProbeResult{Requests: requests, Counts: map[string]int{}}
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+
+	work := make(chan int)
+	for i := 0; i < parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range work {
+				response, err := prober.probeOnce(cfg, curlArgs)
+
+				lock.Lock()
+				if err != nil {
+					result.Failures = append(result.Failures, err.Error())
+				} else {
+					result.Counts[extract(response)]++
+					result.Latencies = append(result.Latencies, response.Latency)
+				}
+				lock.Unlock()
+			}
+		}()
+	}
+
+	for i := 0; i < requests; i++ {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	return result
+}
+
+func (prober *AppProber) probeOnce(cfg CurlConfig, curlArgs []string) (ProbeResponse, error) {
+	curlCmd := prober.CurlFunc(cfg, curlArgs...)
+	if !waitForExit(curlCmd, prober.Timeout) {
+		return ProbeResponse{}, fmt.Errorf("timed out after %s", prober.Timeout)
+	}
+
+	if curlCmd.ExitCode() != 0 {
+		return ProbeResponse{}, fmt.Errorf("curl exited with %d: %s", curlCmd.ExitCode(), strings.TrimSpace(string(curlCmd.Err.Contents())))
+	}
+
+	output := strings.TrimSuffix(string(curlCmd.Out.Contents()), "\n")
+	index := strings.LastIndex(output, "\n")
+	seconds, err := strconv.ParseFloat(strings.TrimSpace(output[index+1:]), 64)
+	if err != nil || index < 0 {
+		return ProbeResponse{}, fmt.Errorf("could not read request time from curl output %q", output)
+	}
+
+	response, err := parseIncludedResponse(output[:index])
+	if err != nil {
+		return ProbeResponse{}, err
+	}
+	response.Latency = time.Duration(seconds * float64(time.Second))
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return ProbeResponse{}, fmt.Errorf("status code %d: %s", response.StatusCode, strings.TrimSpace(response.Body))
+	}
+
+	return response, nil
+}
+
+// parseIncludedResponse parses the output of curl --include, skipping over
+// informational and redirect responses.
+func parseIncludedResponse(output string) (ProbeResponse, error) {
+	reader := bufio.NewReader(strings.NewReader(output))
+	for {
+		statusLine, err := reader.ReadString('\n')
+		if err != nil {
+			return ProbeResponse{}, fmt.Errorf("could not read status line from curl output %q", output)
+		}
+
+		fields := strings.Fields(statusLine)
+		if len(fields) < 2 || !strings.HasPrefix(fields[0], "HTTP/") {
+			return ProbeResponse{}, fmt.Errorf("malformed status line %q", statusLine)
+		}
+
+		statusCode, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return ProbeResponse{}, fmt.Errorf("malformed status line %q", statusLine)
+		}
+
+		header, err := textproto.NewReader(reader).ReadMIMEHeader()
+		if err != nil && err != io.EOF {
+			return ProbeResponse{}, err
+		}
+
+		if statusCode < 200 {
+			continue
+		}
+
+		if statusCode < 400 && statusCode >= 300 {
+			next, _ := reader.Peek(5)
+			if string(next) == "HTTP/" {
+				continue
+			}
+		}
+
+		body, err := io.ReadAll(reader)
+		if err != nil {
+			return ProbeResponse{}, err
+		}
+
+		return ProbeResponse{
+			StatusCode: statusCode,
+			Header:     http.Header(header),
+			Body:       string(body),
+		}, nil
+	}
+}
+
+func waitForExit(session *gexec.Session, timeout time.Duration) bool {
+	select {
+	case <-session.Exited:
+		return true
+	case <-time.After(timeout):
+		<-session.Kill().Exited
+		return false
+	}
+}
@@ -0,0 +1,149 @@
+package helpersinternal_test
+
+import (
+	"fmt"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry/cf-test-helpers/v2/config"
+	. "github.com/cloudfoundry/cf-test-helpers/v2/helpers/internal"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+)
+
+var _ = Describe("AppProber", func() {
+	var prober *AppProber
+	var cfg config.Config
+	var lock sync.Mutex
+	var calls int
+	var receivedArgs []string
+	var respond func(call int) string
+
+	BeforeEach(func() {
+		cfg = config.Config{}
+		calls = 0
+
+		respond = func(call int) string {
+			return fmt.Sprintf(`printf "HTTP/1.1 200 OK\r\nX-Instance: %d\r\n\r\n%d\n0.0%d"`, call%3, call%3, call%10)
+		}
+
+		curlStub := func(cfg CurlConfig, args ...string) *gexec.Session {
+			lock.Lock()
+			receivedArgs = args
+			call := calls
+			calls++
+			lock.Unlock()
+
+			cmd := exec.Command("bash", "-c", respond(call))
+			session, _ := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
+			return session
+		}
+
+		prober = &AppProber{
+			CurlFunc:    curlStub,
+			UriCreator:  &fakeUriCreator{toReturn: "my-app.my-domain.org/path"},
+			Parallelism: 4,
+			Timeout:     time.Second,
+		}
+	})
+
+	It("includes headers and the request time in the curl output and passes any args on", func() {
+		prober.Probe(&cfg, "my-app", "/path", 1, ByBody(), "arg1")
+		Expect(receivedArgs).To(Equal([]string{"--include", "-w", "\n%{time_total}", "my-app.my-domain.org/path", "arg1"}))
+	})
+
+	It("counts responses by body", func() {
+		result := prober.Probe(&cfg, "my-app", "/path", 30, ByBody())
+
+		Expect(calls).To(Equal(30))
+		Expect(result.Requests).To(Equal(30))
+		Expect(result.Counts).To(Equal(map[string]int{"0": 10, "1": 10, "2": 10}))
+		Expect(result.Failures).To(BeEmpty())
+		Expect(result).To(HitAllInstances(3))
+		Expect(result).NotTo(HitAllInstances(4))
+	})
+
+	It("counts responses by header", func() {
+		result := prober.Probe(&cfg, "my-app", "/path", 6, ByHeader("X-Instance"))
+		Expect(result.Counts).To(Equal(map[string]int{"0": 2, "1": 2, "2": 2}))
+	})
+
+	It("reports latency percentiles", func() {
+		result := prober.Probe(&cfg, "my-app", "/path", 10, ByBody())
+
+		Expect(result.Latencies).To(HaveLen(10))
+		Expect(result.Percentile(50)).To(Equal(40 * time.Millisecond))
+		Expect(result.Percentile(90)).To(Equal(80 * time.Millisecond))
+		Expect(result.Percentile(100)).To(Equal(90 * time.Millisecond))
+		Expect(result.LatencySummary()).To(Equal("p50=40ms p90=80ms p99=90ms max=90ms"))
+	})
+
+	It("skips over informational and redirect responses", func() {
+		respond = func(int) string {
+			return `printf "HTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 302 Found\r\nLocation: /other\r\n\r\nHTTP/2 200\r\nX-Instance: 7\r\n\r\nbody\n0.001"`
+		}
+
+		result := prober.Probe(&cfg, "my-app", "/path", 1, ByHeader("X-Instance"))
+		Expect(result.Counts).To(Equal(map[string]int{"7": 1}))
+	})
+
+	Context("when requests fail", func() {
+		BeforeEach(func() {
+			respond = func(call int) string {
+				if call == 0 {
+					return `echo "connection refused" >&2; exit 7`
+				}
+				return `printf "HTTP/1.1 200 OK\r\n\r\n0\n0.001"`
+			}
+			prober.Parallelism = 1
+		})
+
+		It("records the failures and does not match HitAllInstances", func() {
+			result := prober.Probe(&cfg, "my-app", "/path", 3, ByBody())
+
+			Expect(result.Failures).To(ConsistOf("curl exited with 7: connection refused"))
+			Expect(result.Counts).To(Equal(map[string]int{"0": 2}))
+
+			failures := InterceptGomegaFailures(func() {
+				Expect(result).To(HitAllInstances(1))
+			})
+			Expect(failures).To(ConsistOf(ContainSubstring("3 requests, 1 failed")))
+		})
+	})
+
+	Context("when the router responds with an error", func() {
+		BeforeEach(func() {
+			respond = func(call int) string {
+				if call == 0 {
+					return `printf "HTTP/1.1 502 Bad Gateway\r\nX-Instance: 0\r\n\r\n502 Bad Gateway: Registered endpoint failed to handle the request.\n0.001"`
+				}
+				return `printf "HTTP/1.1 200 OK\r\nX-Instance: 1\r\n\r\n1\n0.001"`
+			}
+			prober.Parallelism = 1
+		})
+
+		It("records the response as a failure rather than a hit", func() {
+			result := prober.Probe(&cfg, "my-app", "/path", 2, ByHeader("X-Instance"))
+
+			Expect(result.Failures).To(ConsistOf("status code 502: 502 Bad Gateway: Registered endpoint failed to handle the request."))
+			Expect(result.Counts).To(Equal(map[string]int{"1": 1}))
+			Expect(result.Latencies).To(HaveLen(1))
+			Expect(result).NotTo(HitAllInstances(2))
+		})
+	})
+
+	Context("when a request times out", func() {
+		BeforeEach(func() {
+			respond = func(int) string { return "sleep 1" }
+			prober.Timeout = 50 * time.Millisecond
+		})
+
+		It("records the timeout as a failure", func() {
+			result := prober.Probe(&cfg, "my-app", "/path", 1, ByBody())
+			Expect(result.Failures).To(ConsistOf("timed out after 50ms"))
+		})
+	})
+})
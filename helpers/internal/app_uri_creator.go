@@ -7,14 +7,19 @@ type AppUriCreator struct {
 }
 
 func (uriCreator *AppUriCreator) AppUri(appName string, path string) string {
-	if path != "" && !strings.HasPrefix(path, "/") {
-		path = "/" + path
+	return uriCreator.RouteUri(Route{Host: appName, Path: path})
+}
+
+func (uriCreator *AppUriCreator) RouteUri(route Route) string {
+	address := route.Address(uriCreator.CurlConfig.GetAppsDomain())
+	if route.Protocol == RouteProtocolTCP {
+		return address
 	}
 
-	var subdomain string
-	if appName != "" {
-		subdomain = appName + "."
+	path := route.Path
+	if path != "" && !strings.HasPrefix(path, "/") {
+		path = "/" + path
 	}
 
-	return uriCreator.CurlConfig.Protocol() + subdomain + uriCreator.CurlConfig.GetAppsDomain() + path
+	return route.Scheme(uriCreator.CurlConfig.Protocol()) + address + path
 }
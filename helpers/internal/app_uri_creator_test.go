@@ -79,4 +79,35 @@ var _ = Describe("AppUriCreator", func() {
 			})
 		})
 	})
+
+	Describe("RouteUri", func() {
+		BeforeEach(func() {
+			useHttp = false
+			appsDomain = "my-domain.org"
+		})
+
+		It("defaults to the apps domain", func() {
+			Expect(uriCreator.RouteUri(Route{Host: "my-app", Path: "path"})).To(Equal("https://my-app.my-domain.org/path"))
+		})
+
+		It("uses the given domain and port", func() {
+			Expect(uriCreator.RouteUri(Route{Host: "my-app", Domain: "shared.org", Port: 8443, Path: "/context"})).To(Equal("https://my-app.shared.org:8443/context"))
+		})
+
+		It("computes the url for a hostless route", func() {
+			Expect(uriCreator.RouteUri(Route{Domain: "shared.org", Path: "/context"})).To(Equal("https://shared.org/context"))
+		})
+
+		It("replaces the wildcard of a wildcard route", func() {
+			Expect(uriCreator.RouteUri(Route{Host: "*", Domain: "shared.org"})).To(Equal("https://wildcard-probe.shared.org"))
+		})
+
+		It("uses http for internal routes", func() {
+			Expect(uriCreator.RouteUri(NewInternalRoute("my-app", 8080))).To(Equal("http://my-app.apps.internal:8080"))
+		})
+
+		It("returns only the address for a TCP route", func() {
+			Expect(uriCreator.RouteUri(NewTCPRoute("tcp.my-domain.org", 1024))).To(Equal("tcp.my-domain.org:1024"))
+		})
+	})
 })
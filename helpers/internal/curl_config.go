@@ -1,7 +1,45 @@
 package helpersinternal
 
+import (
+	"crypto/tls"
+
+	"github.com/cloudfoundry/cf-test-helpers/v2/internal"
+)
+
 type CurlConfig interface {
 	GetAppsDomain() string
 	Protocol() string
 	GetSkipSSLValidation() bool
 }
+
+// TLSConfig is optionally implemented by a CurlConfig to trust a custom CA
+// bundle and to present a client certificate, e.g. for mTLS routes.
+type TLSConfig = internal.TLSConfig
+
+// CurlTLSArgs returns the curl flags for the CA bundle and client certificate
+// configured by cfg, if it implements TLSConfig.
+func CurlTLSArgs(cfg CurlConfig) []string {
+	tlsConfig, ok := cfg.(TLSConfig)
+	if !ok {
+		return nil
+	}
+
+	var args []string
+	if tlsConfig.GetCACertFile() != "" {
+		args = append(args, "--cacert", tlsConfig.GetCACertFile())
+	}
+	if tlsConfig.GetClientCertFile() != "" {
+		args = append(args, "--cert", tlsConfig.GetClientCertFile())
+	}
+	if tlsConfig.GetClientKeyFile() != "" {
+		args = append(args, "--key", tlsConfig.GetClientKeyFile())
+	}
+	return args
+}
+
+// ClientTLSConfig builds the TLS configuration for Go HTTP clients from cfg,
+// loading its CA bundle and client certificate if it implements TLSConfig.
+// Like curl, it accepts a client certificate file that also holds the key.
+func ClientTLSConfig(cfg CurlConfig) (*tls.Config, error) {
+	return internal.ClientTLSConfig(cfg, cfg.GetSkipSSLValidation())
+}
@@ -0,0 +1,149 @@
+package helpersinternal_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudfoundry/cf-test-helpers/v2/config"
+	. "github.com/cloudfoundry/cf-test-helpers/v2/helpers/internal"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type plainCurlConfig struct{}
+
+func (plainCurlConfig) GetAppsDomain() string      { return "my-domain.org" }
+func (plainCurlConfig) Protocol() string           { return "https://" }
+func (plainCurlConfig) GetSkipSSLValidation() bool { return true }
+
+func writeCertificate(dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "cf-test-helpers"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+		KeyUsage:     x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).NotTo(HaveOccurred())
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	Expect(err).NotTo(HaveOccurred())
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	Expect(os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)).To(Succeed())
+	Expect(os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)).To(Succeed())
+
+	return certFile, keyFile
+}
+
+var _ = Describe("CurlConfig", func() {
+	var cfg config.Config
+
+	BeforeEach(func() {
+		cfg = config.Config{}
+	})
+
+	Describe("CurlTLSArgs", func() {
+		It("returns nothing when no TLS files are configured", func() {
+			Expect(CurlTLSArgs(&cfg)).To(BeEmpty())
+		})
+
+		It("returns nothing when the config does not implement TLSConfig", func() {
+			Expect(CurlTLSArgs(plainCurlConfig{})).To(BeEmpty())
+		})
+
+		It("passes the CA bundle and client certificate to curl", func() {
+			cfg.CACertFile = "/path/to/ca.pem"
+			cfg.ClientCertFile = "/path/to/client.pem"
+			cfg.ClientKeyFile = "/path/to/client.key"
+
+			Expect(CurlTLSArgs(&cfg)).To(Equal([]string{
+				"--cacert", "/path/to/ca.pem",
+				"--cert", "/path/to/client.pem",
+				"--key", "/path/to/client.key",
+			}))
+		})
+	})
+
+	Describe("ClientTLSConfig", func() {
+		var certFile, keyFile string
+
+		BeforeEach(func() {
+			certFile, keyFile = writeCertificate(GinkgoT().TempDir())
+		})
+
+		It("skips SSL validation as configured", func() {
+			cfg.SkipSSLValidation = true
+
+			tlsConfig, err := ClientTLSConfig(&cfg)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tlsConfig.InsecureSkipVerify).To(BeTrue())
+			Expect(tlsConfig.RootCAs).To(BeNil())
+			Expect(tlsConfig.Certificates).To(BeEmpty())
+		})
+
+		It("loads the CA bundle and client certificate", func() {
+			cfg.CACertFile = certFile
+			cfg.ClientCertFile = certFile
+			cfg.ClientKeyFile = keyFile
+
+			tlsConfig, err := ClientTLSConfig(&cfg)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tlsConfig.InsecureSkipVerify).To(BeFalse())
+			Expect(tlsConfig.RootCAs).NotTo(BeNil())
+			Expect(tlsConfig.Certificates).To(HaveLen(1))
+		})
+
+		It("returns an error when the CA bundle has no certificates", func() {
+			cfg.CACertFile = keyFile
+
+			_, err := ClientTLSConfig(&cfg)
+			Expect(err).To(MatchError(ContainSubstring("no certificates found in")))
+		})
+
+		It("reads the client key from the certificate file when no key file is configured", func() {
+			combinedFile := filepath.Join(GinkgoT().TempDir(), "combined.pem")
+			certPEM, err := os.ReadFile(certFile)
+			Expect(err).NotTo(HaveOccurred())
+			keyPEM, err := os.ReadFile(keyFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.WriteFile(combinedFile, append(certPEM, keyPEM...), 0600)).To(Succeed())
+			cfg.ClientCertFile = combinedFile
+
+			tlsConfig, err := ClientTLSConfig(&cfg)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tlsConfig.Certificates).To(HaveLen(1))
+			Expect(CurlTLSArgs(&cfg)).To(Equal([]string{"--cert", combinedFile}))
+		})
+
+		It("returns an error when the certificate file holds no key and no key file is configured", func() {
+			cfg.ClientCertFile = certFile
+
+			_, err := ClientTLSConfig(&cfg)
+			Expect(err).To(MatchError(ContainSubstring("could not load client certificate " + certFile)))
+		})
+
+		It("returns an error when the client key is missing", func() {
+			cfg.ClientCertFile = certFile
+			cfg.ClientKeyFile = "/does/not/exist"
+
+			_, err := ClientTLSConfig(&cfg)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,258 @@
+package helpersinternal
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+const grpcHealthCheckPath = "/grpc.health.v1.Health/Check"
+
+var grpcServingStatuses = map[uint64]string{
+	0: "UNKNOWN",
+	1: "SERVING",
+	2: "NOT_SERVING",
+	3: "SERVICE_UNKNOWN",
+}
+
+type HTTP2ProbeResult struct {
+	StatusCode int
+	Protocol   string
+	Body       string
+}
+
+type GRPCHealthResult struct {
+	Protocol string
+	Status   string
+}
+
+// HTTP2Prober talks HTTP/2 to apps without going through curl. https URIs
+// negotiate h2 through ALPN, falling back to HTTP/1.1 if the server does not
+// offer it, and http URIs use h2c with prior knowledge.
+type HTTP2Prober struct {
+	UriCreator uriCreator
+	Timeout    time.Duration
+}
+
+func NewHTTP2Prober(cfg CurlConfig, timeout time.Duration) *HTTP2Prober {
+	return &HTTP2Prober{
+		UriCreator: &AppUriCreator{CurlConfig: cfg},
+		Timeout:    timeout,
+	}
+}
+
+func (prober *HTTP2Prober) Probe(cfg CurlConfig, appName, path string) (HTTP2ProbeResult, error) {
+	appUri := prober.UriCreator.AppUri(appName, path)
+
+	ctx, cancel := context.WithTimeout(context.Background(), prober.Timeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, appUri, nil)
+	if err != nil {
+		return HTTP2ProbeResult{}, err
+	}
+
+	client, err := prober.client(cfg, appUri)
+	if err != nil {
+		return HTTP2ProbeResult{}, err
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return HTTP2ProbeResult{}, err
+	}
+	defer response.Body.Close() // nolint:errcheck
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return HTTP2ProbeResult{}, err
+	}
+
+	return HTTP2ProbeResult{
+		StatusCode: response.StatusCode,
+		Protocol:   response.Proto,
+		Body:       string(body),
+	}, nil
+}
+
+// GRPCHealthCheck calls the standard grpc.health.v1.Health/Check method for
+// the given service, where an empty service asks about the server as a whole.
+func (prober *HTTP2Prober) GRPCHealthCheck(cfg CurlConfig, appName, service string) (GRPCHealthResult, error) {
+	appUri := prober.UriCreator.AppUri(appName, grpcHealthCheckPath)
+
+	ctx, cancel := context.WithTimeout(context.Background(), prober.Timeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, appUri, bytes.NewReader(grpcFrame(healthCheckRequest(service))))
+	if err != nil {
+		return GRPCHealthResult{}, err
+	}
+	request.Header.Set("Content-Type", "application/grpc")
+	request.Header.Set("TE", "trailers")
+
+	client, err := prober.client(cfg, appUri)
+	if err != nil {
+		return GRPCHealthResult{}, err
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return GRPCHealthResult{}, err
+	}
+	defer response.Body.Close() // nolint:errcheck
+
+	if response.StatusCode != http.StatusOK {
+		return GRPCHealthResult{}, fmt.Errorf("grpc health check returned HTTP status %d", response.StatusCode)
+	}
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return GRPCHealthResult{}, err
+	}
+
+	err = grpcStatusError(response)
+	if err != nil {
+		return GRPCHealthResult{}, err
+	}
+
+	message, err := readGRPCFrame(body)
+	if err != nil {
+		return GRPCHealthResult{}, err
+	}
+
+	status, err := healthCheckStatus(message)
+	if err != nil {
+		return GRPCHealthResult{}, err
+	}
+
+	return GRPCHealthResult{
+		Protocol: response.Proto,
+		Status:   status,
+	}, nil
+}
+
+func (prober *HTTP2Prober) client(cfg CurlConfig, appUri string) (*http.Client, error) {
+	if strings.HasPrefix(appUri, "http://") {
+		return &http.Client{Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, network, addr)
+			},
+		}}, nil
+	}
+
+	tlsConfig, err := ClientTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   tlsConfig,
+		ForceAttemptHTTP2: true,
+	}}, nil
+}
+
+func grpcStatusError(response *http.Response) error {
+	status := response.Trailer.Get("Grpc-Status")
+	message := response.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status = response.Header.Get("Grpc-Status")
+		message = response.Header.Get("Grpc-Message")
+	}
+
+	if status != "" && status != "0" {
+		return fmt.Errorf("grpc health check failed with status %s: %s", status, message)
+	}
+	return nil
+}
+
+func healthCheckRequest(service string) []byte {
+	if service == "" {
+		return nil
+	}
+
+	message := []byte{0x0a}
+	message = binary.AppendUvarint(message, uint64(len(service)))
+	return append(message, service...)
+}
+
+func grpcFrame(message []byte) []byte {
+	frame := make([]byte, 5, 5+len(message))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(message)))
+	return append(frame, message...)
+}
+
+func readGRPCFrame(body []byte) ([]byte, error) {
+	if len(body) < 5 {
+		return nil, errors.New("grpc response is missing its message")
+	}
+	if body[0] != 0 {
+		return nil, errors.New("compressed grpc responses are not supported")
+	}
+
+	length := binary.BigEndian.Uint32(body[1:5])
+	if uint32(len(body)-5) < length {
+		return nil, errors.New("grpc response message is truncated")
+	}
+	return body[5 : 5+length], nil
+}
+
+// healthCheckStatus decodes the status field of a HealthCheckResponse,
+// skipping any fields it does not know about.
+func healthCheckStatus(message []byte) (string, error) {
+	status := uint64(0)
+	for len(message) > 0 {
+		tag, n := binary.Uvarint(message)
+		if n <= 0 {
+			return "", errors.New("malformed grpc health check response")
+		}
+		message = message[n:]
+
+		switch tag & 0x7 {
+		case 0:
+			value, n := binary.Uvarint(message)
+			if n <= 0 {
+				return "", errors.New("malformed grpc health check response")
+			}
+			message = message[n:]
+			if tag>>3 == 1 {
+				status = value
+			}
+		case 1:
+			if len(message) < 8 {
+				return "", errors.New("malformed grpc health check response")
+			}
+			message = message[8:]
+		case 2:
+			length, n := binary.Uvarint(message)
+			if n <= 0 || uint64(len(message)-n) < length {
+				return "", errors.New("malformed grpc health check response")
+			}
+			message = message[n+int(length):]
+		case 5:
+			if len(message) < 4 {
+				return "", errors.New("malformed grpc health check response")
+			}
+			message = message[4:]
+		default:
+			return "", errors.New("malformed grpc health check response")
+		}
+	}
+
+	name, ok := grpcServingStatuses[status]
+	if !ok {
+		return fmt.Sprintf("%d", status), nil
+	}
+	return name, nil
+}
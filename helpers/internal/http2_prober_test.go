@@ -0,0 +1,155 @@
+package helpersinternal_test
+
+import (
+	"encoding/binary"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudfoundry/cf-test-helpers/v2/config"
+	. "github.com/cloudfoundry/cf-test-helpers/v2/helpers/internal"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HTTP2Prober", func() {
+	var cfg config.Config
+	var server *httptest.Server
+	var prober *HTTP2Prober
+	var grpcStatus string
+	var receivedService []byte
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/grpc.health.v1.Health/Check" {
+			_, _ = w.Write([]byte("hello from " + r.Proto))
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		receivedService = body[5:]
+
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		if grpcStatus != "0" {
+			w.Header().Set("Grpc-Status", grpcStatus)
+			w.Header().Set("Grpc-Message", "unknown service")
+			return
+		}
+
+		frame := make([]byte, 5)
+		binary.BigEndian.PutUint32(frame[1:], 2)
+		_, _ = w.Write(append(frame, 0x08, 0x01))
+		w.Header().Set("Grpc-Status", "0")
+	})
+
+	BeforeEach(func() {
+		cfg = config.Config{SkipSSLValidation: true}
+		grpcStatus = "0"
+		receivedService = nil
+	})
+
+	JustBeforeEach(func() {
+		serverUrl, err := url.Parse(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+
+		cfg.AppsDomain = serverUrl.Host
+		cfg.UseHttp = serverUrl.Scheme == "http"
+		prober = NewHTTP2Prober(&cfg, time.Second)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Context("when the app serves h2 over TLS", func() {
+		BeforeEach(func() {
+			server = httptest.NewUnstartedServer(handler)
+			server.EnableHTTP2 = true
+			server.StartTLS()
+		})
+
+		It("negotiates HTTP/2", func() {
+			result, err := prober.Probe(&cfg, "", "/path")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal(HTTP2ProbeResult{StatusCode: 200, Protocol: "HTTP/2.0", Body: "hello from HTTP/2.0"}))
+		})
+
+		Context("when SSL validation is not skipped", func() {
+			BeforeEach(func() {
+				cfg.SkipSSLValidation = false
+			})
+
+			It("rejects the self-signed certificate", func() {
+				_, err := prober.Probe(&cfg, "", "/path")
+				Expect(err).To(MatchError(ContainSubstring("certificate")))
+			})
+		})
+
+		Context("when the CA bundle is configured", func() {
+			BeforeEach(func() {
+				cfg.SkipSSLValidation = false
+				cfg.CACertFile = filepath.Join(GinkgoT().TempDir(), "ca.pem")
+				caCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+				Expect(os.WriteFile(cfg.CACertFile, caCert, 0600)).To(Succeed())
+			})
+
+			It("trusts the server certificate", func() {
+				result, err := prober.Probe(&cfg, "", "/path")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Protocol).To(Equal("HTTP/2.0"))
+			})
+		})
+	})
+
+	Context("when the app only serves HTTP/1.1 over TLS", func() {
+		BeforeEach(func() {
+			server = httptest.NewTLSServer(handler)
+		})
+
+		It("reports the protocol it fell back to", func() {
+			result, err := prober.Probe(&cfg, "", "/path")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Protocol).To(Equal("HTTP/1.1"))
+		})
+	})
+
+	Context("when the app serves h2c", func() {
+		BeforeEach(func() {
+			server = httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+		})
+
+		It("speaks HTTP/2 with prior knowledge", func() {
+			result, err := prober.Probe(&cfg, "", "/path")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Protocol).To(Equal("HTTP/2.0"))
+			Expect(result.Body).To(Equal("hello from HTTP/2.0"))
+		})
+
+		It("performs a gRPC health check", func() {
+			result, err := prober.GRPCHealthCheck(&cfg, "", "my.Service")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal(GRPCHealthResult{Protocol: "HTTP/2.0", Status: "SERVING"}))
+			Expect(receivedService).To(Equal(append([]byte{0x0a, 10}, "my.Service"...)))
+		})
+
+		Context("when the gRPC call fails", func() {
+			BeforeEach(func() {
+				grpcStatus = "5"
+			})
+
+			It("returns the gRPC status and message", func() {
+				_, err := prober.GRPCHealthCheck(&cfg, "", "")
+				Expect(err).To(MatchError("grpc health check failed with status 5: unknown service"))
+				Expect(receivedService).To(BeEmpty())
+			})
+		})
+	})
+})
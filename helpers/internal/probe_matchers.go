@@ -0,0 +1,47 @@
+package helpersinternal
+
+import (
+	"fmt"
+
+	"github.com/onsi/gomega/types"
+)
+
+// HitAllInstances succeeds when a ProbeResult counted responses from exactly
+// the given number of distinct keys and no request failed.
+func HitAllInstances(instances int) types.GomegaMatcher {
+	return &hitAllInstancesMatcher{instances: instances}
+}
+
+type hitAllInstancesMatcher struct {
+	instances int
+}
+
+func (matcher *hitAllInstancesMatcher) Match(actual interface{}) (bool, error) {
+	result, ok := actual.(ProbeResult)
+	if !ok {
+		return false, fmt.Errorf("HitAllInstances expects a ProbeResult, got %T", actual)
+	}
+
+	return len(result.Failures) == 0 && len(result.Counts) == matcher.instances, nil
+}
+
+func (matcher *hitAllInstancesMatcher) FailureMessage(actual interface{}) string {
+	return fmt.Sprintf("Expected probe to hit all %d instances, got %s", matcher.instances, describeProbe(actual))
+}
+
+func (matcher *hitAllInstancesMatcher) NegatedFailureMessage(actual interface{}) string {
+	return fmt.Sprintf("Expected probe not to hit all %d instances, got %s", matcher.instances, describeProbe(actual))
+}
+
+func describeProbe(actual interface{}) string {
+	result, ok := actual.(ProbeResult)
+	if !ok {
+		return fmt.Sprintf("%v", actual)
+	}
+
+	description := result.String()
+	for _, failure := range result.Failures {
+		description += "\n  " + failure
+	}
+	return description
+}
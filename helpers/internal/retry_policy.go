@@ -0,0 +1,129 @@
+package helpersinternal
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+const GorouterRouteNotFoundPattern = `Requested route \('[^']*'\) does not exist`
+
+// RetryPolicy describes how an app curl is retried while a route is still
+// propagating through the routing tier. A curl is retried when it exits
+// non-zero, writes to stderr, returns one of RetryOnStatusCodes or returns a
+// body matching one of RetryOnBodyPatterns.
+type RetryPolicy struct {
+	// MaxDuration bounds the total time spent across all attempts.
+	MaxDuration time.Duration
+
+	// InitialBackoff is the pause before the second attempt. Each further
+	// pause is multiplied by BackoffMultiplier, up to MaxBackoff.
+	InitialBackoff    time.Duration
+	MaxBackoff        time.Duration
+	BackoffMultiplier float64
+
+	// Jitter randomizes each pause by up to the given fraction (0 to 1) of
+	// its length in either direction.
+	Jitter float64
+
+	RetryOnStatusCodes  []int
+	RetryOnBodyPatterns []string
+}
+
+// DefaultRetryPolicy retries gorouter 404s for unknown routes as well as 502
+// and 503 responses for up to the given duration.
+func DefaultRetryPolicy(maxDuration time.Duration) RetryPolicy {
+	return RetryPolicy{
+		MaxDuration:         maxDuration,
+		InitialBackoff:      500 * time.Millisecond,
+		MaxBackoff:          5 * time.Second,
+		BackoffMultiplier:   2,
+		Jitter:              0.2,
+		RetryOnStatusCodes:  []int{502, 503},
+		RetryOnBodyPatterns: []string{GorouterRouteNotFoundPattern},
+	}
+}
+
+// retryConditions are the status codes and compiled body patterns of a
+// RetryPolicy, compiled once before the first attempt.
+type retryConditions struct {
+	statusCodes  []int
+	bodyPatterns []*regexp.Regexp
+}
+
+func (policy RetryPolicy) retryConditions() (retryConditions, error) {
+	conditions := retryConditions{statusCodes: policy.RetryOnStatusCodes}
+	for _, pattern := range policy.RetryOnBodyPatterns {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return retryConditions{}, fmt.Errorf("invalid retry body pattern %q: %w", pattern, err)
+		}
+		conditions.bodyPatterns = append(conditions.bodyPatterns, compiled)
+	}
+
+	return conditions, nil
+}
+
+func (conditions retryConditions) shouldRetry(statusCode int, body string) (bool, string) {
+	if slices.Contains(conditions.statusCodes, statusCode) {
+		return true, "retryable status code"
+	}
+
+	for _, pattern := range conditions.bodyPatterns {
+		if pattern.MatchString(body) {
+			return true, fmt.Sprintf("body matched %q", pattern)
+		}
+	}
+
+	return false, ""
+}
+
+func (policy RetryPolicy) backoff(previous time.Duration) time.Duration {
+	if previous == 0 {
+		return policy.InitialBackoff
+	}
+
+	next := previous
+	if policy.BackoffMultiplier > 1 {
+		next = time.Duration(float64(previous) * policy.BackoffMultiplier)
+	}
+	if policy.MaxBackoff > 0 && next > policy.MaxBackoff {
+		next = policy.MaxBackoff
+	}
+
+	return next
+}
+
+func (policy RetryPolicy) withJitter(pause time.Duration) time.Duration {
+	if policy.Jitter <= 0 || pause <= 0 {
+		return pause
+	}
+
+	delta := (rand.Float64()*2 - 1) * policy.Jitter * float64(pause)
+	return pause + time.Duration(delta)
+}
+
+type curlAttempt struct {
+	number     int
+	elapsed    time.Duration
+	exitCode   int
+	statusCode int
+	reason     string
+}
+
+func (attempt curlAttempt) String() string {
+	return fmt.Sprintf("attempt %d after %s: exit code %d, status code %d, %s",
+		attempt.number, attempt.elapsed.Round(time.Millisecond), attempt.exitCode, attempt.statusCode, attempt.reason)
+}
+
+func retrySummary(uri string, attempts []curlAttempt) string {
+	lines := make([]string, 0, len(attempts))
+	for _, attempt := range attempts {
+		lines = append(lines, "  "+attempt.String())
+	}
+
+	return fmt.Sprintf("curl %s did not succeed after %d attempts:\n%s", uri, len(attempts), strings.Join(lines, "\n"))
+}
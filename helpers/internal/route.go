@@ -0,0 +1,95 @@
+package helpersinternal
+
+import (
+	"net"
+	"strconv"
+	"strings"
+)
+
+type RouteProtocol string
+
+const (
+	RouteProtocolHTTP1 RouteProtocol = "http1"
+	RouteProtocolHTTP2 RouteProtocol = "http2"
+	RouteProtocolTCP   RouteProtocol = "tcp"
+)
+
+const InternalDomain = "apps.internal"
+
+// WildcardProbeLabel replaces the "*" of a wildcard host when a route is
+// turned into a URI, since any label is served by a wildcard route.
+const WildcardProbeLabel = "wildcard-probe"
+
+// Route describes how an app is reached. An empty Domain means the configured
+// apps domain, an empty Host a hostless route and a "*" Host a wildcard route.
+// TCP routes only use Domain and Port.
+type Route struct {
+	Host     string
+	Domain   string
+	Port     int
+	Path     string
+	Protocol RouteProtocol
+
+	// Internal routes are only reachable from other apps over the container
+	// network, which does not terminate TLS, so they always use http.
+	Internal bool
+}
+
+func NewInternalRoute(host string, port int) Route {
+	return Route{
+		Host:     host,
+		Domain:   InternalDomain,
+		Port:     port,
+		Internal: true,
+	}
+}
+
+func NewTCPRoute(domain string, port int) Route {
+	return Route{
+		Domain:   domain,
+		Port:     port,
+		Protocol: RouteProtocolTCP,
+	}
+}
+
+// Address returns the host and port to dial, without a scheme or path.
+func (route Route) Address(appsDomain string) string {
+	domain := route.Domain
+	if domain == "" {
+		domain = appsDomain
+	}
+
+	hostname := domain
+	if route.Protocol != RouteProtocolTCP && route.Host != "" {
+		hostname = strings.Replace(route.Host, "*", WildcardProbeLabel, 1) + "." + domain
+	}
+
+	if route.Port == 0 {
+		return hostname
+	}
+	return net.JoinHostPort(hostname, strconv.Itoa(route.Port))
+}
+
+// Scheme returns the scheme the route is reached with, given the configured
+// protocol.
+func (route Route) Scheme(protocol string) string {
+	if route.Internal {
+		return "http://"
+	}
+	return protocol
+}
+
+// CurlArgs returns the curl flags that select the route's HTTP version.
+func (route Route) CurlArgs(scheme string) []string {
+	switch route.Protocol {
+	case RouteProtocolHTTP1:
+		return []string{"--http1.1"}
+	case RouteProtocolHTTP2:
+		if scheme == "http://" {
+			return []string{"--http2-prior-knowledge"}
+		}
+		return []string{"--http2"}
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,55 @@
+package helpersinternal
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+// TCPRequest dials address, writes the payload and returns everything the
+// backend sends until it closes the connection or stops sending. The backend
+// has up to timeout to connect and start replying; after that, the reply is
+// considered complete once nothing arrives for readTimeout, since most TCP
+// test apps keep the connection open.
+func TCPRequest(address string, payload []byte, timeout, readTimeout time.Duration) ([]byte, error) {
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close() // nolint:errcheck
+
+	err = conn.SetDeadline(time.Now().Add(timeout))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(payload) > 0 {
+		_, err = conn.Write(payload)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var response []byte
+	buffer := make([]byte, 4096)
+	for {
+		n, err := conn.Read(buffer)
+		response = append(response, buffer[:n]...)
+		if err == io.EOF {
+			return response, nil
+		}
+		if errors.Is(err, os.ErrDeadlineExceeded) && len(response) > 0 {
+			return response, nil
+		}
+		if err != nil {
+			return response, err
+		}
+
+		err = conn.SetReadDeadline(time.Now().Add(readTimeout))
+		if err != nil {
+			return response, err
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package helpersinternal_test
+
+import (
+	"bufio"
+	"net"
+	"time"
+
+	. "github.com/cloudfoundry/cf-test-helpers/v2/helpers/internal"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TCPRequest", func() {
+	var listener net.Listener
+	var closeAfterReply bool
+
+	BeforeEach(func() {
+		var err error
+		listener, err = net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		closeAfterReply = true
+	})
+
+	JustBeforeEach(func() {
+		go func() {
+			defer GinkgoRecover()
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+
+				line, err := bufio.NewReader(conn).ReadString('\n')
+				Expect(err).NotTo(HaveOccurred())
+				_, err = conn.Write([]byte("echo: " + line))
+				Expect(err).NotTo(HaveOccurred())
+
+				if closeAfterReply {
+					Expect(conn.Close()).To(Succeed())
+				}
+			}
+		}()
+	})
+
+	AfterEach(func() {
+		Expect(listener.Close()).To(Succeed())
+	})
+
+	It("returns what the backend sends back", func() {
+		response, err := TCPRequest(listener.Addr().String(), []byte("hello\n"), time.Second, time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(response)).To(Equal("echo: hello\n"))
+	})
+
+	Context("when the backend keeps the connection open", func() {
+		BeforeEach(func() {
+			closeAfterReply = false
+		})
+
+		It("returns what was received once the backend stops sending", func() {
+			start := time.Now()
+			response, err := TCPRequest(listener.Addr().String(), []byte("hello\n"), time.Minute, 100*time.Millisecond)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(response)).To(Equal("echo: hello\n"))
+			Expect(time.Since(start)).To(BeNumerically("<", 5*time.Second))
+		})
+	})
+
+	Context("when nothing is listening", func() {
+		It("returns an error", func() {
+			closed, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(closed.Close()).To(Succeed())
+
+			_, err = TCPRequest(closed.Addr().String(), []byte("hello\n"), 100*time.Millisecond, 100*time.Millisecond)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
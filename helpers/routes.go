@@ -0,0 +1,51 @@
+package helpers
+
+import (
+	"time"
+
+	helpersinternal "github.com/cloudfoundry/cf-test-helpers/v2/helpers/internal"
+)
+
+type Route = helpersinternal.Route
+type RouteProtocol = helpersinternal.RouteProtocol
+
+const (
+	RouteProtocolHTTP1 = helpersinternal.RouteProtocolHTTP1
+	RouteProtocolHTTP2 = helpersinternal.RouteProtocolHTTP2
+	RouteProtocolTCP   = helpersinternal.RouteProtocolTCP
+
+	InternalDomain = helpersinternal.InternalDomain
+)
+
+// TCP_READ_TIMEOUT is how long TCPRequest waits for more of a reply before
+// treating it as complete, since most TCP test apps keep the connection open.
+const TCP_READ_TIMEOUT = 2 * time.Second
+
+// Returns a route on the internal domain, reachable only from other apps
+func InternalRoute(host string, port int) Route {
+	return helpersinternal.NewInternalRoute(host, port)
+}
+
+// Returns a route on a TCP domain
+func TCPRoute(domain string, port int) Route {
+	return helpersinternal.NewTCPRoute(domain, port)
+}
+
+// Gets the endpoint for a route; TCP routes are returned as host:port
+func RouteUri(route Route, config helpersinternal.CurlConfig) string {
+	uriCreator := &helpersinternal.AppUriCreator{CurlConfig: config}
+
+	return uriCreator.RouteUri(route)
+}
+
+// Curls a route and exit successfully before the default timeout
+func CurlRoute(cfg helpersinternal.CurlConfig, route Route, args ...string) string {
+	appCurler := helpersinternal.NewAppCurler(Curl, cfg)
+	return appCurler.CurlRouteAndWait(cfg, route, CURL_TIMEOUT, args...)
+}
+
+// Sends the payload to a TCP route and returns what the backend sends back until it goes quiet
+func TCPRequest(cfg helpersinternal.CurlConfig, route Route, payload string) (string, error) {
+	response, err := helpersinternal.TCPRequest(RouteUri(route, cfg), []byte(payload), CURL_TIMEOUT, TCP_READ_TIMEOUT)
+	return string(response), err
+}
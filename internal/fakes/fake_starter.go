@@ -13,6 +13,8 @@ import (
 type callToStartMethod struct {
 	Executable string
 	Args       []string
+	Env        []string
+	NoOutput   bool
 	Reporter   internal.Reporter
 }
 
@@ -37,7 +39,25 @@ func NewFakeCmdStarter() *FakeCmdStarter {
 	}
 }
 
+func (s *FakeCmdStarter) WithEnv(env ...string) internal.Starter {
+	return &fakeEnvCmdStarter{
+		starter: s,
+		env:     env,
+	}
+}
+
+func (s *FakeCmdStarter) WithoutOutput() internal.Starter {
+	return &fakeEnvCmdStarter{
+		starter:  s,
+		noOutput: true,
+	}
+}
+
 func (s *FakeCmdStarter) Start(reporter internal.Reporter, executable string, args ...string) (*gexec.Session, error) {
+	return s.start(reporter, nil, false, executable, args...)
+}
+
+func (s *FakeCmdStarter) start(reporter internal.Reporter, env []string, noOutput bool, executable string, args ...string) (*gexec.Session, error) {
 	output := s.ToReturn[s.TotalCallsToStart].Output
 	if output == "" {
 		output = `\{\}`
@@ -55,6 +75,8 @@ func (s *FakeCmdStarter) Start(reporter internal.Reporter, executable string, ar
 	callToStart := callToStartMethod{
 		Executable: executable,
 		Args:       args,
+		Env:        env,
+		NoOutput:   noOutput,
 		Reporter:   reporter,
 	}
 	s.CalledWith = append(s.CalledWith, callToStart)
@@ -71,6 +93,36 @@ func (s *FakeCmdStarter) Start(reporter internal.Reporter, executable string, ar
 			exitCode,
 		),
 	)
+	if noOutput {
+		session, _ := gexec.Start(cmd, nil, nil)
+		return session, err
+	}
 	session, _ := gexec.Start(cmd, ginkgo.GinkgoWriter, ginkgo.GinkgoWriter)
 	return session, err
 }
+
+type fakeEnvCmdStarter struct {
+	starter  *FakeCmdStarter
+	env      []string
+	noOutput bool
+}
+
+func (s *fakeEnvCmdStarter) WithEnv(env ...string) internal.Starter {
+	return &fakeEnvCmdStarter{
+		starter:  s.starter,
+		env:      append(append([]string{}, s.env...), env...),
+		noOutput: s.noOutput,
+	}
+}
+
+func (s *fakeEnvCmdStarter) WithoutOutput() internal.Starter {
+	return &fakeEnvCmdStarter{
+		starter:  s.starter,
+		env:      s.env,
+		noOutput: true,
+	}
+}
+
+func (s *fakeEnvCmdStarter) Start(reporter internal.Reporter, executable string, args ...string) (*gexec.Session, error) {
+	return s.starter.start(reporter, s.env, s.noOutput, executable, args...)
+}
@@ -1,6 +1,10 @@
 package internal
 
-import "strings"
+import (
+	"strings"
+
+	"github.com/cloudfoundry/cf-test-helpers/v2/internal/secrets"
+)
 
 type Redactor interface {
 	Redact(toRedact string) string
@@ -21,5 +25,5 @@ func (r *redactor) Redact(toRedact string) string {
 		toRedact = strings.ReplaceAll(toRedact, r, "[REDACTED]")
 	}
 
-	return toRedact
+	return secrets.Redact(toRedact)
 }
@@ -2,6 +2,7 @@ package internal_test
 
 import (
 	"github.com/cloudfoundry/cf-test-helpers/v2/internal"
+	"github.com/cloudfoundry/cf-test-helpers/v2/internal/secrets"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -62,5 +63,16 @@ var _ = Describe("Redactor", func() {
 			Expect(out).NotTo(ContainSubstring("secret"))
 			Expect(out).To(Equal("command [REDACTED] [REDACTED] other"))
 		})
+
+		It("the secrets registered by the helpers", func() {
+			secrets.Register("from-credentials")
+			DeferCleanup(secrets.Reset)
+			redactor := internal.NewRedactor("password")
+			in := "command password from-credentials"
+
+			out := redactor.Redact(in)
+
+			Expect(out).To(Equal("command [REDACTED] [REDACTED]"))
+		})
 	})
 })
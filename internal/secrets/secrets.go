@@ -0,0 +1,81 @@
+// Package secrets holds the secret values the helpers came across, such as
+// the credentials of service bindings, so that they are left out of the
+// commands and output written to the GinkgoWriter.
+package secrets
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const redacted = "[REDACTED]"
+
+var (
+	lock    sync.RWMutex
+	secrets []string
+)
+
+// Register adds the values to the secrets to redact, longest first, so that
+// a secret containing another one is redacted as a whole.
+func Register(values ...string) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	for _, value := range values {
+		if value == "" || contains(secrets, value) {
+			continue
+		}
+		secrets = append(secrets, value)
+	}
+	sort.SliceStable(secrets, func(i, j int) bool {
+		return len(secrets[i]) > len(secrets[j])
+	})
+}
+
+// Reset forgets the registered secrets.
+func Reset() {
+	lock.Lock()
+	defer lock.Unlock()
+	secrets = nil
+}
+
+// Redact replaces the registered secrets in the text.
+func Redact(text string) string {
+	lock.RLock()
+	defer lock.RUnlock()
+
+	for _, secret := range secrets {
+		text = strings.ReplaceAll(text, secret, redacted)
+	}
+	return text
+}
+
+// Writer redacts the registered secrets in everything written to the
+// writer. Each write is redacted on its own, so a secret written in parts
+// is not caught.
+func Writer(writer io.Writer) io.Writer {
+	return redactingWriter{writer: writer}
+}
+
+type redactingWriter struct {
+	writer io.Writer
+}
+
+func (w redactingWriter) Write(p []byte) (int, error) {
+	_, err := io.WriteString(w.writer, Redact(string(p)))
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
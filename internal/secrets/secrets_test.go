@@ -0,0 +1,43 @@
+package secrets_test
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/cloudfoundry/cf-test-helpers/v2/internal/secrets"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Secrets", func() {
+	BeforeEach(func() {
+		DeferCleanup(secrets.Reset)
+	})
+
+	It("redacts the registered secrets", func() {
+		secrets.Register("hunter2", "s3cr3t", "")
+
+		Expect(secrets.Redact("password hunter2, token s3cr3t, user admin")).To(Equal("password [REDACTED], token [REDACTED], user admin"))
+	})
+
+	It("redacts secrets that contain other secrets as a whole", func() {
+		secrets.Register("pass", "postgres://user:pass@db")
+
+		Expect(secrets.Redact("uri postgres://user:pass@db")).To(Equal("uri [REDACTED]"))
+	})
+
+	It("leaves text alone without secrets", func() {
+		Expect(secrets.Redact("nothing to hide")).To(Equal("nothing to hide"))
+	})
+
+	It("redacts the secrets in what is written to the writer", func() {
+		buffer := &bytes.Buffer{}
+		writer := secrets.Writer(buffer)
+		secrets.Register("hunter2")
+
+		n, err := io.WriteString(writer, `{"password":"hunter2"}`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(len(`{"password":"hunter2"}`)))
+		Expect(buffer.String()).To(Equal(`{"password":"[REDACTED]"}`))
+	})
+})
@@ -1,7 +1,61 @@
 package internal
 
-import "github.com/onsi/gomega/gexec"
+import (
+	"fmt"
+	"sync"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega/gexec"
+)
 
 type Starter interface {
 	Start(Reporter, string, ...string) (*gexec.Session, error)
 }
+
+// EnvStarter is implemented by starters that can run their commands with
+// additional environment variables, without touching the process environment.
+type EnvStarter interface {
+	Starter
+	WithEnv(env ...string) Starter
+}
+
+// QuietStarter is implemented by starters that can run their commands
+// without writing their output to the GinkgoWriter, for output that holds
+// secrets.
+type QuietStarter interface {
+	Starter
+	WithoutOutput() Starter
+}
+
+// StarterWithoutOutput returns a starter whose commands do not write their
+// output to the GinkgoWriter, or the starter itself if it cannot do that.
+func StarterWithoutOutput(starter Starter) Starter {
+	quietStarter, ok := starter.(QuietStarter)
+	if !ok {
+		return starter
+	}
+
+	return quietStarter.WithoutOutput()
+}
+
+// warnedStarterTypes keeps StarterWithEnv from reporting the same starter
+// type on every command.
+var warnedStarterTypes sync.Map
+
+// StarterWithEnv returns a starter whose commands run with the given KEY=value
+// pairs added to their environment. Starters that are not EnvStarters are
+// returned unchanged, and their commands run with the process environment,
+// which is reported once for each type of starter.
+func StarterWithEnv(starter Starter, env ...string) Starter {
+	envStarter, ok := starter.(EnvStarter)
+	if !ok {
+		starterType := fmt.Sprintf("%T", starter)
+		if _, warned := warnedStarterTypes.LoadOrStore(starterType, true); !warned {
+			ginkgo.AddReportEntry("Command environment ignored",
+				fmt.Sprintf("%s does not implement EnvStarter, so its commands run without %v and use the process environment instead", starterType, env))
+		}
+		return starter
+	}
+
+	return envStarter.WithEnv(env...)
+}
@@ -0,0 +1,40 @@
+package internal_test
+
+import (
+	"github.com/cloudfoundry/cf-test-helpers/v2/internal"
+	"github.com/cloudfoundry/cf-test-helpers/v2/internal/fakes"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+)
+
+// plainStarter only implements Starter, like the custom starters of suites.
+type plainStarter struct {
+	starter *fakes.FakeCmdStarter
+}
+
+func (s plainStarter) Start(reporter internal.Reporter, executable string, args ...string) (*gexec.Session, error) {
+	return s.starter.Start(reporter, executable, args...)
+}
+
+var _ = Describe("StarterWithEnv", func() {
+	var starter *fakes.FakeCmdStarter
+
+	BeforeEach(func() {
+		starter = fakes.NewFakeCmdStarter()
+	})
+
+	It("adds the env to the commands of an EnvStarter", func() {
+		Eventually(internal.Cf(internal.StarterWithEnv(starter, "CF_HOME=/some/cf/home"), "apps")).Should(gexec.Exit(0))
+		Expect(starter.CalledWith[0].Env).To(Equal([]string{"CF_HOME=/some/cf/home"}))
+	})
+
+	It("falls back to other starters unchanged and reports it", func() {
+		envStarter := internal.StarterWithEnv(plainStarter{starter}, "CF_HOME=/some/cf/home")
+
+		Expect(envStarter).To(Equal(plainStarter{starter}))
+		Eventually(internal.Cf(envStarter, "apps")).Should(gexec.Exit(0))
+		Expect(starter.CalledWith[0].Env).To(BeEmpty())
+		Expect(CurrentSpecReport().ReportEntries).To(ContainElement(HaveField("Name", "Command environment ignored")))
+	})
+})
@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// TLSConfig is optionally implemented by suite configs to trust a custom CA
+// bundle and to present a client certificate, e.g. for mTLS routes.
+type TLSConfig interface {
+	GetCACertFile() string
+	GetClientCertFile() string
+	GetClientKeyFile() string
+}
+
+// ClientTLSConfig builds the TLS configuration for Go HTTP clients, loading
+// the CA bundle and client certificate of cfg if it implements TLSConfig.
+// The CA bundle replaces the system roots, as it does for curl's --cacert
+// and the cf CLI's SSL_CERT_FILE. Like curl, it accepts a client certificate
+// file that also holds the key.
+func ClientTLSConfig(cfg interface{}, skipSSLValidation bool) (*tls.Config, error) {
+	clientConfig := &tls.Config{InsecureSkipVerify: skipSSLValidation} // #nosec G402 -- the suite config asks for it
+
+	tlsConfig, ok := cfg.(TLSConfig)
+	if !ok {
+		return clientConfig, nil
+	}
+
+	if tlsConfig.GetCACertFile() != "" {
+		caCert, err := os.ReadFile(tlsConfig.GetCACertFile())
+		if err != nil {
+			return nil, err
+		}
+
+		clientConfig.RootCAs = x509.NewCertPool()
+		if !clientConfig.RootCAs.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no certificates found in %s", tlsConfig.GetCACertFile())
+		}
+	}
+
+	if tlsConfig.GetClientCertFile() != "" {
+		clientCert, err := loadClientCert(tlsConfig.GetClientCertFile(), tlsConfig.GetClientKeyFile())
+		if err != nil {
+			return nil, err
+		}
+		clientConfig.Certificates = []tls.Certificate{clientCert}
+	}
+
+	return clientConfig, nil
+}
+
+// loadClientCert loads a client certificate and its key. Without a key file
+// the key is read from the certificate file, as curl's --cert does for a
+// combined PEM.
+func loadClientCert(certFile, keyFile string) (tls.Certificate, error) {
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	keyPEM := certPEM
+	if keyFile != "" {
+		keyPEM, err = os.ReadFile(keyFile)
+		if err != nil {
+			return tls.Certificate{}, err
+		}
+	}
+
+	clientCert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("could not load client certificate %s: %w", certFile, err)
+	}
+	return clientCert, nil
+}
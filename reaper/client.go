@@ -0,0 +1,246 @@
+package reaper
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/cf-test-helpers/v2/internal"
+)
+
+// Client is a minimal Cloud Controller v3 client for listing and deleting
+// resources with an existing OAuth token.
+type Client struct {
+	ApiUrl     string
+	Token      string
+	HTTPClient *http.Client
+
+	// UaaUrl is where users are deleted from UAA. It is looked up from the
+	// API's root when empty.
+	UaaUrl string
+
+	JobTimeout      time.Duration
+	JobPollInterval time.Duration
+}
+
+// caCertConfig trusts a CA bundle in place of the system roots, as the cf
+// CLI does for SSL_CERT_FILE.
+type caCertConfig string
+
+func (caCertFile caCertConfig) GetCACertFile() string     { return string(caCertFile) }
+func (caCertFile caCertConfig) GetClientCertFile() string { return "" }
+func (caCertFile caCertConfig) GetClientKeyFile() string  { return "" }
+
+// NewClient creates a client for the API. An empty caCertFile trusts the
+// system roots.
+func NewClient(apiUrl, token string, skipSSLValidation bool, caCertFile string) (*Client, error) {
+	if !strings.HasPrefix(apiUrl, "http://") && !strings.HasPrefix(apiUrl, "https://") {
+		apiUrl = "https://" + apiUrl
+	}
+	if !strings.HasPrefix(strings.ToLower(token), "bearer ") {
+		token = "bearer " + token
+	}
+
+	tlsConfig, err := internal.ClientTLSConfig(caCertConfig(caCertFile), skipSSLValidation)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		ApiUrl: strings.TrimSuffix(apiUrl, "/"),
+		Token:  token,
+		HTTPClient: &http.Client{
+			Timeout:   1 * time.Minute,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+		JobTimeout:      5 * time.Minute,
+		JobPollInterval: 1 * time.Second,
+	}, nil
+}
+
+type listResponse struct {
+	Pagination struct {
+		Next *struct {
+			Href string `json:"href"`
+		} `json:"next"`
+	} `json:"pagination"`
+	Resources []struct {
+		Guid      string    `json:"guid"`
+		Name      string    `json:"name"`
+		Username  string    `json:"username"`
+		CreatedAt time.Time `json:"created_at"`
+	} `json:"resources"`
+}
+
+type errorResponse struct {
+	Errors []struct {
+		Title  string `json:"title"`
+		Detail string `json:"detail"`
+	} `json:"errors"`
+}
+
+type rootResponse struct {
+	Links struct {
+		Uaa struct {
+			Href string `json:"href"`
+		} `json:"uaa"`
+	} `json:"links"`
+}
+
+type job struct {
+	State  string `json:"state"`
+	Errors []struct {
+		Detail string `json:"detail"`
+	} `json:"errors"`
+}
+
+// List returns every resource of the kind, following pagination.
+func (client *Client) List(kind Kind) ([]Resource, error) {
+	var resources []Resource
+
+	url := client.ApiUrl + "/v3/" + string(kind) + "?per_page=5000"
+	for url != "" {
+		var page listResponse
+		_, err := client.request(http.MethodGet, url, &page)
+		if err != nil {
+			return nil, fmt.Errorf("listing %s: %s", kind, err)
+		}
+
+		for _, resource := range page.Resources {
+			name := resource.Name
+			if kind == Users {
+				name = resource.Username
+			}
+			resources = append(resources, Resource{
+				Kind:      kind,
+				Guid:      resource.Guid,
+				Name:      name,
+				CreatedAt: resource.CreatedAt,
+			})
+		}
+
+		url = ""
+		if page.Pagination.Next != nil {
+			url = page.Pagination.Next.Href
+		}
+	}
+
+	return resources, nil
+}
+
+// Delete deletes the resource and waits for the job the Cloud Controller
+// runs to delete it, if any. Users are deleted from UAA first, as
+// cf delete-user does, so that a failure leaves them to be found again. A
+// resource that is gone already, such as the space quotas of an org deleted
+// before them, is taken to be deleted.
+func (client *Client) Delete(resource Resource) error {
+	if resource.Kind == Users {
+		err := client.deleteUaaUser(resource.Guid)
+		if err != nil {
+			return err
+		}
+	}
+
+	response, err := client.request(http.MethodDelete, client.ApiUrl+"/v3/"+string(resource.Kind)+"/"+resource.Guid, nil)
+	if err != nil {
+		if response != nil && response.StatusCode == http.StatusNotFound {
+			return nil
+		}
+		return err
+	}
+
+	location := response.Header.Get("Location")
+	if response.StatusCode != http.StatusAccepted || location == "" {
+		return nil
+	}
+	return client.waitForJob(location)
+}
+
+// deleteUaaUser deletes the UAA user of a Cloud Controller user, which share
+// their guid. A user that UAA does not know is taken to be deleted already.
+func (client *Client) deleteUaaUser(guid string) error {
+	if client.UaaUrl == "" {
+		var root rootResponse
+		_, err := client.request(http.MethodGet, client.ApiUrl+"/", &root)
+		if err != nil {
+			return fmt.Errorf("looking up UAA: %s", err)
+		}
+		if root.Links.Uaa.Href == "" {
+			return fmt.Errorf("the API at %s does not link to UAA", client.ApiUrl)
+		}
+		client.UaaUrl = strings.TrimSuffix(root.Links.Uaa.Href, "/")
+	}
+
+	response, err := client.request(http.MethodDelete, client.UaaUrl+"/Users/"+guid, nil)
+	if err != nil && (response == nil || response.StatusCode != http.StatusNotFound) {
+		return err
+	}
+	return nil
+}
+
+func (client *Client) waitForJob(location string) error {
+	deadline := time.Now().Add(client.JobTimeout)
+	for {
+		var deleteJob job
+		_, err := client.request(http.MethodGet, location, &deleteJob)
+		if err != nil {
+			return err
+		}
+
+		switch deleteJob.State {
+		case "COMPLETE":
+			return nil
+		case "FAILED":
+			if len(deleteJob.Errors) > 0 {
+				return fmt.Errorf("job failed: %s", deleteJob.Errors[0].Detail)
+			}
+			return fmt.Errorf("job failed")
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("job %s did not complete within %s", location, client.JobTimeout)
+		}
+		time.Sleep(client.JobPollInterval)
+	}
+}
+
+// request sends a request and decodes the response. The error for a failed
+// status comes with the response, for callers to tell statuses apart.
+func (client *Client) request(method, url string, response interface{}) (*http.Response, error) {
+	request, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", client.Token)
+	request.Header.Set("Accept", "application/json")
+
+	httpResponse, err := client.HTTPClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResponse.Body.Close() // nolint:errcheck
+
+	body, err := io.ReadAll(httpResponse.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if httpResponse.StatusCode >= 300 {
+		var apiErrors errorResponse
+		if json.Unmarshal(body, &apiErrors) == nil && len(apiErrors.Errors) > 0 {
+			return httpResponse, fmt.Errorf("%s %s returned status %d: %s", method, url, httpResponse.StatusCode, apiErrors.Errors[0].Detail)
+		}
+		return httpResponse, fmt.Errorf("%s %s returned status %d", method, url, httpResponse.StatusCode)
+	}
+
+	if response != nil && len(body) > 0 {
+		err = json.Unmarshal(body, response)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return httpResponse, nil
+}
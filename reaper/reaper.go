@@ -0,0 +1,195 @@
+// Package reaper finds and deletes Cloud Foundry resources left behind by
+// test suites that crashed before their teardown, recognising them by the
+// names generator.PrefixedRandomName gives them.
+package reaper
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type Kind string
+
+const (
+	ServiceBrokers Kind = "service_brokers"
+	SecurityGroups Kind = "security_groups"
+	Buildpacks     Kind = "buildpacks"
+	Domains        Kind = "domains"
+	Spaces         Kind = "spaces"
+	Organizations  Kind = "organizations"
+	SpaceQuotas    Kind = "space_quotas"
+	OrgQuotas      Kind = "organization_quotas"
+	Users          Kind = "users"
+)
+
+// AllKinds lists every kind of resource in the order they are deleted, so
+// that resources are gone before the resources they depend on.
+var AllKinds = []Kind{
+	ServiceBrokers,
+	SecurityGroups,
+	Buildpacks,
+	Domains,
+	Spaces,
+	Organizations,
+	SpaceQuotas,
+	OrgQuotas,
+	Users,
+}
+
+type Resource struct {
+	Kind      Kind
+	Guid      string
+	Name      string
+	CreatedAt time.Time
+}
+
+func (resource Resource) String() string {
+	return fmt.Sprintf("%s %s (%s, created %s)", resource.Kind, resource.Name, resource.Guid, resource.CreatedAt.Format(time.RFC3339))
+}
+
+// Reaper deletes the resources whose names match the naming scheme of
+// generator.PrefixedRandomName for NamePrefix, such as
+// CATS-3-ORG-0123456789abcdef, and which are older than OlderThan.
+type Reaper struct {
+	Client     *Client
+	NamePrefix string
+	OlderThan  time.Duration
+	Kinds      []Kind
+
+	// DryRun only reports what would be deleted.
+	DryRun bool
+
+	Out io.Writer
+	Now func() time.Time
+}
+
+func NewReaper(client *Client, namePrefix string, out io.Writer) *Reaper {
+	return &Reaper{
+		Client:     client,
+		NamePrefix: namePrefix,
+		Kinds:      AllKinds,
+		Out:        out,
+		Now:        time.Now,
+	}
+}
+
+// Find lists the matching resources in the order they would be deleted.
+func (reaper *Reaper) Find() ([]Resource, error) {
+	if reaper.NamePrefix == "" {
+		return nil, fmt.Errorf("a name prefix is required")
+	}
+
+	pattern := NamePattern(reaper.NamePrefix)
+	cutoff := reaper.Now().Add(-reaper.OlderThan)
+
+	var found []Resource
+	for _, kind := range orderedKinds(reaper.Kinds) {
+		resources, err := reaper.Client.List(kind)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, resource := range resources {
+			if !pattern.MatchString(nameToMatch(resource)) {
+				continue
+			}
+			if resource.CreatedAt.After(cutoff) {
+				continue
+			}
+			found = append(found, resource)
+		}
+	}
+
+	return found, nil
+}
+
+// Reap deletes the matching resources, or only reports them in a dry run. It
+// carries on past failures and returns them all at the end, together with
+// the resources it deleted.
+func (reaper *Reaper) Reap() ([]Resource, error) {
+	resources, err := reaper.Find()
+	if err != nil {
+		return nil, err
+	}
+
+	if reaper.DryRun {
+		for _, resource := range resources {
+			fmt.Fprintf(reaper.Out, "would delete %s\n", resource) // nolint:errcheck
+		}
+		return resources, nil
+	}
+
+	var deleted []Resource
+	var failures []string
+	for _, resource := range resources {
+		err := reaper.Client.Delete(resource)
+		if err != nil {
+			fmt.Fprintf(reaper.Out, "failed to delete %s: %s\n", resource, err) // nolint:errcheck
+			failures = append(failures, fmt.Sprintf("%s: %s", resource, err))
+			continue
+		}
+
+		fmt.Fprintf(reaper.Out, "deleted %s\n", resource) // nolint:errcheck
+		deleted = append(deleted, resource)
+	}
+
+	if len(failures) > 0 {
+		return deleted, fmt.Errorf("failed to delete %d resources:\n%s", len(failures), strings.Join(failures, "\n"))
+	}
+	return deleted, nil
+}
+
+// NamePattern matches the names generator.PrefixedRandomName generates for
+// the prefix, whatever the resource name and parallel node.
+func NamePattern(namePrefix string) *regexp.Regexp {
+	return regexp.MustCompile(`(?i)^` + regexp.QuoteMeta(namePrefix) + `-[0-9]+-[A-Z0-9_]+-[0-9a-f]{16}$`)
+}
+
+// nameToMatch returns the part of the name a generated name would be. Test
+// domains are usually a generated name under an existing domain.
+func nameToMatch(resource Resource) string {
+	if resource.Kind == Domains {
+		return strings.SplitN(resource.Name, ".", 2)[0]
+	}
+	return resource.Name
+}
+
+func orderedKinds(kinds []Kind) []Kind {
+	var ordered []Kind
+	for _, kind := range AllKinds {
+		for _, wanted := range kinds {
+			if kind == wanted {
+				ordered = append(ordered, kind)
+				break
+			}
+		}
+	}
+	return ordered
+}
+
+// ParseKinds parses a comma separated list of kinds, where "all" stands for
+// every kind.
+func ParseKinds(list string) ([]Kind, error) {
+	var kinds []Kind
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "all" {
+			return AllKinds, nil
+		}
+
+		known := false
+		for _, kind := range AllKinds {
+			if string(kind) == name {
+				kinds = append(kinds, kind)
+				known = true
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown kind %q", name)
+		}
+	}
+	return kinds, nil
+}
@@ -0,0 +1,359 @@
+package reaper_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry/cf-test-helpers/v2/reaper"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type fakeResource struct {
+	Guid      string    `json:"guid"`
+	Name      string    `json:"name,omitempty"`
+	Username  string    `json:"username,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type fakeCloudController struct {
+	server *httptest.Server
+
+	lock        sync.Mutex
+	resources   map[string][]fakeResource
+	deletes     []string
+	failDeletes map[string]bool
+	asyncGuids  map[string]bool
+	ownedBy     map[string]string
+	jobPolls    int
+	authHeaders []string
+
+	unknownToUaa map[string]bool
+}
+
+func newFakeCloudController() *fakeCloudController {
+	fake := &fakeCloudController{
+		resources:   map[string][]fakeResource{},
+		failDeletes: map[string]bool{},
+		asyncGuids:  map[string]bool{},
+		ownedBy:     map[string]string{},
+
+		unknownToUaa: map[string]bool{},
+	}
+	fake.server = httptest.NewServer(http.HandlerFunc(fake.serve))
+	return fake
+}
+
+func (fake *fakeCloudController) add(kind reaper.Kind, resources ...fakeResource) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	fake.resources[string(kind)] = append(fake.resources[string(kind)], resources...)
+}
+
+// remove removes the resource and those it owns, as the Cloud Controller
+// deletes the space quotas of an org with the org, and tells whether it
+// existed.
+func (fake *fakeCloudController) remove(guid string) bool {
+	found := false
+	for kind, resources := range fake.resources {
+		var kept []fakeResource
+		for _, resource := range resources {
+			if resource.Guid == guid {
+				found = true
+				continue
+			}
+			kept = append(kept, resource)
+		}
+		fake.resources[kind] = kept
+	}
+
+	for owned, owner := range fake.ownedBy {
+		if owner == guid {
+			delete(fake.ownedBy, owned)
+			fake.remove(owned)
+		}
+	}
+	return found
+}
+
+func (fake *fakeCloudController) deleted() []string {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	return append([]string{}, fake.deletes...)
+}
+
+func (fake *fakeCloudController) serve(w http.ResponseWriter, r *http.Request) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	fake.authHeaders = append(fake.authHeaders, r.Header.Get("Authorization"))
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v3/"), "/")
+	switch {
+	case r.URL.Path == "/":
+		json.NewEncoder(w).Encode(map[string]interface{}{ // nolint:errcheck
+			"links": map[string]interface{}{"uaa": map[string]string{"href": fake.server.URL + "/uaa"}},
+		})
+	case strings.HasPrefix(r.URL.Path, "/uaa/Users/"):
+		guid := strings.TrimPrefix(r.URL.Path, "/uaa/Users/")
+		if fake.failDeletes[guid] {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if fake.unknownToUaa[guid] {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fake.deletes = append(fake.deletes, "uaa/"+guid)
+	case parts[0] == "jobs":
+		fake.jobPolls++
+		state := "PROCESSING"
+		if fake.jobPolls > 1 {
+			state = "COMPLETE"
+		}
+		json.NewEncoder(w).Encode(map[string]string{"state": state}) // nolint:errcheck
+	case r.Method == http.MethodGet:
+		all := fake.resources[parts[0]]
+		page := all
+		next := interface{}(nil)
+		if r.URL.Query().Get("page") == "" && len(all) > 2 {
+			page = all[:2]
+			next = map[string]string{"href": fake.server.URL + r.URL.Path + "?page=2&per_page=5000"}
+		} else if r.URL.Query().Get("page") == "2" {
+			page = all[2:]
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{ // nolint:errcheck
+			"pagination": map[string]interface{}{"next": next},
+			"resources":  page,
+		})
+	case r.Method == http.MethodDelete:
+		guid := parts[1]
+		if fake.failDeletes[guid] {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			fmt.Fprintf(w, `{"errors":[{"title":"CF-UnprocessableEntity","detail":"%s is still in use"}]}`, guid) // nolint:errcheck
+			return
+		}
+		if !fake.remove(guid) {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, `{"errors":[{"title":"CF-ResourceNotFound","detail":"%s not found"}]}`, guid) // nolint:errcheck
+			return
+		}
+		fake.deletes = append(fake.deletes, parts[0]+"/"+guid)
+		if fake.asyncGuids[guid] {
+			w.Header().Set("Location", fake.server.URL+"/v3/jobs/"+guid)
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+var _ = Describe("Reaper", func() {
+	var (
+		fake   *fakeCloudController
+		out    *bytes.Buffer
+		r      *reaper.Reaper
+		now    time.Time
+		old    time.Time
+		recent time.Time
+	)
+
+	BeforeEach(func() {
+		fake = newFakeCloudController()
+		DeferCleanup(fake.server.Close)
+
+		now = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+		old = now.Add(-3 * time.Hour)
+		recent = now.Add(-10 * time.Minute)
+
+		client, err := reaper.NewClient(fake.server.URL, "some-token", false, "")
+		Expect(err).NotTo(HaveOccurred())
+		client.JobPollInterval = time.Millisecond
+		out = &bytes.Buffer{}
+		r = reaper.NewReaper(client, "CATS", out)
+		r.OlderThan = time.Hour
+		r.Now = func() time.Time { return now }
+	})
+
+	Describe("NewClient", func() {
+		It("fails when the CA bundle holds no certificates", func() {
+			caCertFile := filepath.Join(GinkgoT().TempDir(), "ca.pem")
+			Expect(os.WriteFile(caCertFile, []byte("not a certificate"), 0600)).To(Succeed())
+
+			_, err := reaper.NewClient(fake.server.URL, "some-token", false, caCertFile)
+			Expect(err).To(MatchError("no certificates found in " + caCertFile))
+		})
+
+		It("trusts the CA bundle", func() {
+			tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(map[string]interface{}{"resources": []fakeResource{}}) // nolint:errcheck
+			}))
+			DeferCleanup(tlsServer.Close)
+
+			caCertFile := filepath.Join(GinkgoT().TempDir(), "ca.pem")
+			Expect(os.WriteFile(caCertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tlsServer.Certificate().Raw}), 0600)).To(Succeed())
+
+			client, err := reaper.NewClient(tlsServer.URL, "some-token", false, caCertFile)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = client.List(reaper.Spaces)
+			Expect(err).NotTo(HaveOccurred())
+
+			client, err = reaper.NewClient(tlsServer.URL, "some-token", false, "")
+			Expect(err).NotTo(HaveOccurred())
+			_, err = client.List(reaper.Spaces)
+			Expect(err).To(MatchError(ContainSubstring("certificate")))
+		})
+	})
+
+	Describe("NamePattern", func() {
+		It("matches generated names of any kind and node", func() {
+			pattern := reaper.NamePattern("CATS")
+			Expect(pattern.MatchString("CATS-1-ORG-0123456789abcdef")).To(BeTrue())
+			Expect(pattern.MatchString("cats-12-space_quota-0123456789abcdef")).To(BeTrue())
+			Expect(pattern.MatchString("CATS-1-ORG-someone-elses")).To(BeFalse())
+			Expect(pattern.MatchString("CATSX-1-ORG-0123456789abcdef")).To(BeFalse())
+			Expect(pattern.MatchString("production-org")).To(BeFalse())
+		})
+	})
+
+	Describe("ParseKinds", func() {
+		It("parses a list of kinds", func() {
+			Expect(reaper.ParseKinds("spaces, users")).To(Equal([]reaper.Kind{reaper.Spaces, reaper.Users}))
+			Expect(reaper.ParseKinds("all")).To(Equal(reaper.AllKinds))
+		})
+
+		It("rejects unknown kinds", func() {
+			_, err := reaper.ParseKinds("spaces,apps")
+			Expect(err).To(MatchError(`unknown kind "apps"`))
+		})
+	})
+
+	Describe("Find", func() {
+		It("requires a name prefix", func() {
+			r.NamePrefix = ""
+			_, err := r.Find()
+			Expect(err).To(MatchError("a name prefix is required"))
+		})
+
+		It("finds old resources with generated names across pages, in deletion order", func() {
+			fake.add(reaper.Organizations,
+				fakeResource{Guid: "org-1", Name: "CATS-1-ORG-0123456789abcdef", CreatedAt: old},
+				fakeResource{Guid: "org-2", Name: "system", CreatedAt: old},
+				fakeResource{Guid: "org-3", Name: "CATS-2-ORG-fedcba9876543210", CreatedAt: old},
+				fakeResource{Guid: "org-4", Name: "CATS-3-ORG-aaaaaaaaaaaaaaaa", CreatedAt: recent},
+			)
+			fake.add(reaper.Spaces, fakeResource{Guid: "space-1", Name: "CATS-1-SPACE-0123456789abcdef", CreatedAt: old})
+			fake.add(reaper.Domains, fakeResource{Guid: "domain-1", Name: "cats-1-domain-0123456789abcdef.example.com", CreatedAt: old})
+			fake.add(reaper.Users, fakeResource{Guid: "user-1", Username: "CATS-1-USER-0123456789abcdef", CreatedAt: old})
+
+			resources, err := r.Find()
+			Expect(err).NotTo(HaveOccurred())
+
+			var guids []string
+			for _, resource := range resources {
+				guids = append(guids, resource.Guid)
+			}
+			Expect(guids).To(Equal([]string{"domain-1", "space-1", "org-1", "org-3", "user-1"}))
+			Expect(resources[4].Name).To(Equal("CATS-1-USER-0123456789abcdef"))
+			Expect(fake.authHeaders[0]).To(Equal("bearer some-token"))
+		})
+
+		It("only lists the requested kinds", func() {
+			fake.add(reaper.Organizations, fakeResource{Guid: "org-1", Name: "CATS-1-ORG-0123456789abcdef", CreatedAt: old})
+			fake.add(reaper.Spaces, fakeResource{Guid: "space-1", Name: "CATS-1-SPACE-0123456789abcdef", CreatedAt: old})
+			r.Kinds = []reaper.Kind{reaper.Spaces}
+
+			resources, err := r.Find()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resources).To(HaveLen(1))
+			Expect(resources[0].Guid).To(Equal("space-1"))
+		})
+	})
+
+	Describe("Reap", func() {
+		BeforeEach(func() {
+			fake.add(reaper.Spaces, fakeResource{Guid: "space-1", Name: "CATS-1-SPACE-0123456789abcdef", CreatedAt: old})
+			fake.add(reaper.Organizations, fakeResource{Guid: "org-1", Name: "CATS-1-ORG-0123456789abcdef", CreatedAt: old})
+			fake.add(reaper.OrgQuotas, fakeResource{Guid: "quota-1", Name: "CATS-1-QUOTA-0123456789abcdef", CreatedAt: old})
+		})
+
+		It("only reports the resources in a dry run", func() {
+			r.DryRun = true
+
+			resources, err := r.Reap()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resources).To(HaveLen(3))
+			Expect(fake.deleted()).To(BeEmpty())
+			Expect(out.String()).To(ContainSubstring("would delete spaces CATS-1-SPACE-0123456789abcdef (space-1, created 2024-05-01T09:00:00Z)"))
+		})
+
+		It("deletes the resources in dependency order, waiting for deletion jobs", func() {
+			fake.asyncGuids["org-1"] = true
+
+			resources, err := r.Reap()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resources).To(HaveLen(3))
+			Expect(fake.deleted()).To(Equal([]string{"spaces/space-1", "organizations/org-1", "organization_quotas/quota-1"}))
+			Expect(fake.jobPolls).To(Equal(2))
+			Expect(out.String()).To(ContainSubstring("deleted organizations CATS-1-ORG-0123456789abcdef"))
+		})
+
+		It("takes resources deleted along with others to be deleted", func() {
+			fake.add(reaper.SpaceQuotas, fakeResource{Guid: "space-quota-1", Name: "CATS-1-SPACE_QUOTA-0123456789abcdef", CreatedAt: old})
+			fake.ownedBy["space-quota-1"] = "org-1"
+
+			resources, err := r.Reap()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resources).To(HaveLen(4))
+			Expect(fake.deleted()).To(Equal([]string{"spaces/space-1", "organizations/org-1", "organization_quotas/quota-1"}))
+			Expect(out.String()).To(ContainSubstring("deleted space_quotas CATS-1-SPACE_QUOTA-0123456789abcdef"))
+		})
+
+		It("carries on past failures and returns them all", func() {
+			fake.failDeletes["org-1"] = true
+
+			resources, err := r.Reap()
+			Expect(err).To(MatchError(ContainSubstring("failed to delete 1 resources")))
+			Expect(err).To(MatchError(ContainSubstring("org-1 is still in use")))
+			Expect(resources).To(HaveLen(2))
+			Expect(fake.deleted()).To(Equal([]string{"spaces/space-1", "organization_quotas/quota-1"}))
+			Expect(out.String()).To(ContainSubstring("failed to delete organizations CATS-1-ORG-0123456789abcdef"))
+		})
+
+		Context("with users", func() {
+			BeforeEach(func() {
+				r.Kinds = []reaper.Kind{reaper.Users}
+				fake.add(reaper.Users,
+					fakeResource{Guid: "user-1", Username: "CATS-1-USER-0123456789abcdef", CreatedAt: old},
+					fakeResource{Guid: "user-2", Username: "CATS-2-USER-0123456789abcdef", CreatedAt: old},
+				)
+			})
+
+			It("deletes them from UAA before the Cloud Controller", func() {
+				fake.unknownToUaa["user-2"] = true
+
+				resources, err := r.Reap()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resources).To(HaveLen(2))
+				Expect(fake.deleted()).To(Equal([]string{"uaa/user-1", "users/user-1", "users/user-2"}))
+			})
+
+			It("leaves them in the Cloud Controller when UAA fails to delete them", func() {
+				fake.failDeletes["user-1"] = true
+
+				resources, err := r.Reap()
+				Expect(err).To(MatchError(ContainSubstring("/uaa/Users/user-1 returned status 403")))
+				Expect(resources).To(HaveLen(1))
+				Expect(fake.deleted()).To(Equal([]string{"uaa/user-2", "users/user-2"}))
+			})
+		})
+	})
+})
@@ -0,0 +1,368 @@
+package servicebroker
+
+import (
+	"bytes"
+	"crypto/rand"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/cf-test-helpers/v2/cf"
+	"github.com/cloudfoundry/cf-test-helpers/v2/generator"
+	"github.com/cloudfoundry/cf-test-helpers/v2/helpers"
+	"github.com/cloudfoundry/cf-test-helpers/v2/internal/secrets"
+	"github.com/cloudfoundry/cf-test-helpers/v2/servicebroker/osbfake"
+	"github.com/cloudfoundry/cf-test-helpers/v2/workflowhelpers"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+	"gopkg.in/yaml.v3"
+)
+
+// The broker app is the fakebroker main package with the osbfake package
+// it imports, laid out as a module of its own.
+//
+//go:embed fakebroker/main.go osbfake/*.go
+var fakeBrokerSources embed.FS
+
+const (
+	fakeBrokerGoMod      = "module fakebroker\n\ngo 1.22\n"
+	osbfakeImportPath    = "github.com/cloudfoundry/cf-test-helpers/v2/servicebroker/osbfake"
+	appOsbfakeImportPath = "fakebroker/osbfake"
+
+	timeFormat = "2006-01-02 15:04:05.00 (MST)"
+)
+
+type brokerConfig interface {
+	GetAppsDomain() string
+	Protocol() string
+	GetSkipSSLValidation() bool
+	GetNamePrefix() string
+	GetScaledTimeout(time.Duration) time.Duration
+	BrokerStartTimeoutDuration() time.Duration
+	AsyncServiceOperationTimeoutDuration() time.Duration
+}
+
+// Broker is an Open Service Broker API fake pushed as an app and registered
+// with the Cloud Controller. It can be created and destroyed by Setup and
+// Teardown, registered with their ResourceRegistry as the regular user
+// before Setup:
+//
+//	broker := servicebroker.NewGlobalSuiteBroker(cfg, testSetup)
+//	testSetup.Resources.Register("broker", broker, workflowhelpers.RegularUserExecution)
+type Broker struct {
+	Name     string
+	Username string
+	Password string
+
+	// SpaceScoped brokers are registered in the targeted space by the user,
+	// others globally by the admin, who also enables access to their plans.
+	SpaceScoped bool
+	Catalog     Catalog
+
+	// AsyncOperationDuration makes the broker complete provisioning,
+	// updates and deprovisioning asynchronously after the duration, when
+	// the platform accepts that.
+	AsyncOperationDuration time.Duration
+
+	// Credentials, VolumeMounts and SyslogDrainURL are returned for every
+	// binding to an app, the RouteServiceURL for every binding to a route.
+	Credentials     map[string]interface{}
+	VolumeMounts    []VolumeMount
+	RouteServiceURL string
+	SyslogDrainURL  string
+
+	// Failures make the broker fail operations, see osbfake.Failure.
+	Failures []osbfake.Failure
+
+	Buildpack string
+	Memory    string
+
+	// StartTimeout is how long the broker app gets to be pushed and start,
+	// AsyncTimeout how long specs should wait for its async operations.
+	StartTimeout time.Duration
+	AsyncTimeout time.Duration
+
+	config           brokerConfig
+	userContext      func() workflowhelpers.UserContext
+	adminUserContext func() workflowhelpers.UserContext
+	workDir          string
+}
+
+// suiteUserContexts hands out the contexts of a suite's users as they are
+// at the time, such as a ReproducibleTestSuiteSetup does.
+type suiteUserContexts interface {
+	RegularUserContext() workflowhelpers.UserContext
+	AdminUserContext() workflowhelpers.UserContext
+}
+
+// NewSpaceScopedBroker declares a broker the user of the context pushes and
+// registers in the space it targets, with one service and plan.
+func NewSpaceScopedBroker(config brokerConfig, userContext workflowhelpers.UserContext) *Broker {
+	broker := newBroker(config, fixedUserContext(userContext))
+	broker.SpaceScoped = true
+	return broker
+}
+
+// NewGlobalBroker declares a broker the user of the context pushes, and the
+// admin registers for every org, with one service and plan.
+func NewGlobalBroker(config brokerConfig, userContext, adminUserContext workflowhelpers.UserContext) *Broker {
+	broker := newBroker(config, fixedUserContext(userContext))
+	broker.adminUserContext = fixedUserContext(adminUserContext)
+	return broker
+}
+
+// NewSpaceScopedSuiteBroker is NewSpaceScopedBroker for the regular user of
+// the suite. It takes the user's context from the setup whenever it runs
+// commands, so that it can be declared before Setup prepares the context.
+func NewSpaceScopedSuiteBroker(config brokerConfig, testSetup suiteUserContexts) *Broker {
+	broker := newBroker(config, testSetup.RegularUserContext)
+	broker.SpaceScoped = true
+	return broker
+}
+
+// NewGlobalSuiteBroker is NewGlobalBroker for the regular user and the admin
+// of the suite, whose contexts it takes from the setup whenever it runs
+// commands.
+func NewGlobalSuiteBroker(config brokerConfig, testSetup suiteUserContexts) *Broker {
+	broker := newBroker(config, testSetup.RegularUserContext)
+	broker.adminUserContext = testSetup.AdminUserContext
+	return broker
+}
+
+func fixedUserContext(userContext workflowhelpers.UserContext) func() workflowhelpers.UserContext {
+	return func() workflowhelpers.UserContext {
+		return userContext
+	}
+}
+
+func newBroker(config brokerConfig, userContext func() workflowhelpers.UserContext) *Broker {
+	serviceName := generator.PrefixedRandomName(config.GetNamePrefix(), "SERVICE")
+	return &Broker{
+		Name:     generator.PrefixedRandomName(config.GetNamePrefix(), "BROKER"),
+		Username: "broker-user",
+		Password: randomID(),
+
+		Catalog: Catalog{Services: []Service{{
+			ID:          randomID(),
+			Name:        serviceName,
+			Description: "A fake service of " + config.GetNamePrefix(),
+			Bindable:    true,
+			Plans: []Plan{{
+				ID:          randomID(),
+				Name:        "fake-plan",
+				Description: "A fake plan of " + serviceName,
+			}},
+		}}},
+
+		Buildpack: "go_buildpack",
+		Memory:    "128M",
+
+		StartTimeout: config.GetScaledTimeout(config.BrokerStartTimeoutDuration()),
+		AsyncTimeout: config.GetScaledTimeout(config.AsyncServiceOperationTimeoutDuration()),
+
+		config:      config,
+		userContext: userContext,
+	}
+}
+
+// Create pushes the broker app and registers the broker.
+func (broker *Broker) Create() {
+	broker.Push()
+	broker.Register()
+}
+
+// Push pushes the broker app and waits up to the StartTimeout for it to
+// start.
+func (broker *Broker) Push() {
+	gomega.ExpectWithOffset(1, broker.AsyncOperationDuration).To(gomega.BeNumerically("<", broker.AsyncTimeout),
+		"The async operations of the broker would outlast the AsyncTimeout")
+
+	manifestPath, err := broker.writeApp()
+	gomega.ExpectWithOffset(1, err).NotTo(gomega.HaveOccurred(), "Failed to write the broker app")
+
+	secrets.Register(broker.Password)
+	session := broker.userContext().Cf("push", "-f", manifestPath)
+	gomega.EventuallyWithOffset(1, session, broker.StartTimeout).Should(gexec.Exit(0), "Failed to push broker app")
+}
+
+// Register registers the pushed broker, globally or in the targeted space.
+func (broker *Broker) Register() {
+	secrets.Register(broker.Password)
+	args := []string{"create-service-broker", broker.Name, broker.Username, broker.Password, broker.URL()}
+	if broker.SpaceScoped {
+		userContext := broker.userContext()
+		args = append(args, "--space-scoped")
+		session := userContext.Cf(args...)
+		gomega.EventuallyWithOffset(1, session, userContext.Timeout).Should(gexec.Exit(0), "Failed to register service broker")
+		return
+	}
+
+	adminUserContext := broker.adminUserContext()
+	workflowhelpers.AsUser(adminUserContext, adminUserContext.Timeout, func() {
+		session := adminUserContext.Cf(args...)
+		gomega.EventuallyWithOffset(3, session, adminUserContext.Timeout).Should(gexec.Exit(0), "Failed to register service broker")
+
+		for _, service := range broker.Catalog.Services {
+			session := adminUserContext.Cf("enable-service-access", service.Name, "-b", broker.Name)
+			gomega.EventuallyWithOffset(3, session, adminUserContext.Timeout).Should(gexec.Exit(0), "Failed to enable service access")
+		}
+	})
+}
+
+// Destroy unregisters the broker and deletes its app.
+func (broker *Broker) Destroy() {
+	userContext := broker.userContext()
+	if broker.SpaceScoped {
+		session := userContext.Cf("delete-service-broker", broker.Name, "-f")
+		gomega.EventuallyWithOffset(1, session, userContext.Timeout).Should(gexec.Exit(0), "Failed to delete service broker")
+	} else {
+		adminUserContext := broker.adminUserContext()
+		workflowhelpers.AsUser(adminUserContext, adminUserContext.Timeout, func() {
+			session := adminUserContext.Cf("delete-service-broker", broker.Name, "-f")
+			gomega.EventuallyWithOffset(3, session, adminUserContext.Timeout).Should(gexec.Exit(0), "Failed to delete service broker")
+		})
+	}
+
+	session := userContext.Cf("delete", broker.Name, "-f", "-r")
+	gomega.EventuallyWithOffset(1, session, userContext.Timeout).Should(gexec.Exit(0), "Failed to delete broker app")
+
+	if broker.workDir != "" {
+		gomega.ExpectWithOffset(1, os.RemoveAll(broker.workDir)).To(gomega.Succeed())
+		broker.workDir = ""
+	}
+}
+
+func (broker *Broker) ShouldRemain() bool {
+	return false
+}
+
+func (broker *Broker) URL() string {
+	return helpers.AppUri(broker.Name, "", broker.config)
+}
+
+// ServiceName and PlanName are the names of the first service and its first
+// plan, for the common case of a broker with a single plan.
+func (broker *Broker) ServiceName() string {
+	return broker.Catalog.Services[0].Name
+}
+
+func (broker *Broker) PlanName() string {
+	return broker.Catalog.Services[0].Plans[0].Name
+}
+
+// writeApp lays the broker app out in a directory of its own with its
+// configuration and manifest, and returns the path of the manifest.
+func (broker *Broker) writeApp() (string, error) {
+	if broker.workDir == "" {
+		workDir, err := os.MkdirTemp("", "fakebroker")
+		if err != nil {
+			return "", err
+		}
+		broker.workDir = workDir
+	}
+
+	// The manifest stays out of the app directory, so it is not pushed.
+	appDir := filepath.Join(broker.workDir, "app")
+	manifestPath := filepath.Join(broker.workDir, "manifest.yml")
+	err := os.MkdirAll(appDir, 0700)
+	if err != nil {
+		return "", err
+	}
+
+	appConfig, err := json.Marshal(osbfake.Config{
+		Username:               broker.Username,
+		Password:               broker.Password,
+		Catalog:                broker.Catalog,
+		AsyncOperationDuration: broker.AsyncOperationDuration,
+		Credentials:            broker.Credentials,
+		VolumeMounts:           broker.VolumeMounts,
+		RouteServiceURL:        broker.RouteServiceURL,
+		SyslogDrainURL:         broker.SyslogDrainURL,
+		Failures:               broker.Failures,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	app := cf.Application{
+		Name:       broker.Name,
+		Path:       appDir,
+		Buildpacks: []string{broker.Buildpack},
+		Memory:     broker.Memory,
+		Routes:     []map[string]string{{"route": broker.Name + "." + broker.config.GetAppsDomain()}},
+	}
+	if labels := broker.userContext().AppLabels; len(labels) > 0 {
+		app.Metadata = &cf.Metadata{Labels: labels}
+	}
+	manifest, err := yaml.Marshal(cf.Manifest{Applications: []cf.Application{app}})
+	if err != nil {
+		return "", err
+	}
+
+	files, err := fakeBrokerFiles()
+	if err != nil {
+		return "", err
+	}
+	files["config.json"] = appConfig
+	for name, contents := range files {
+		appFile := filepath.Join(appDir, filepath.FromSlash(name))
+		err = os.MkdirAll(filepath.Dir(appFile), 0700)
+		if err != nil {
+			return "", err
+		}
+		err = os.WriteFile(appFile, contents, 0600)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	err = os.WriteFile(manifestPath, manifest, 0600)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = fmt.Fprintf(ginkgo.GinkgoWriter, "\n[%s]> Generated broker manifest:\n%s\n", time.Now().UTC().Format(timeFormat), manifest)
+	return manifestPath, err
+}
+
+// fakeBrokerFiles returns the sources of the broker app by their path in the
+// app, with the import of osbfake pointing to its copy in the app.
+func fakeBrokerFiles() (map[string][]byte, error) {
+	files := map[string][]byte{"go.mod": []byte(fakeBrokerGoMod)}
+
+	mainSource, err := fakeBrokerSources.ReadFile("fakebroker/main.go")
+	if err != nil {
+		return nil, err
+	}
+	files["main.go"] = bytes.ReplaceAll(mainSource, []byte(`"`+osbfakeImportPath+`"`), []byte(`"`+appOsbfakeImportPath+`"`))
+
+	osbfakeSources, err := fs.Glob(fakeBrokerSources, "osbfake/*.go")
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range osbfakeSources {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		files[name], err = fakeBrokerSources.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+func randomID() string {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		panic(err)
+	}
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
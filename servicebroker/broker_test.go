@@ -0,0 +1,232 @@
+package servicebroker_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/cf-test-helpers/v2/config"
+	starterFakes "github.com/cloudfoundry/cf-test-helpers/v2/internal/fakes"
+	"github.com/cloudfoundry/cf-test-helpers/v2/internal/secrets"
+	. "github.com/cloudfoundry/cf-test-helpers/v2/servicebroker"
+	"github.com/cloudfoundry/cf-test-helpers/v2/workflowhelpers"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"gopkg.in/yaml.v3"
+)
+
+type user struct {
+	username, password string
+}
+
+func (u user) Username() string { return u.username }
+func (u user) Password() string { return u.password }
+func (u user) Origin() string   { return "" }
+
+// suiteContexts hands out whatever contexts the suite holds at the time.
+type suiteContexts struct {
+	regular, admin workflowhelpers.UserContext
+}
+
+func (contexts *suiteContexts) RegularUserContext() workflowhelpers.UserContext {
+	return contexts.regular
+}
+func (contexts *suiteContexts) AdminUserContext() workflowhelpers.UserContext { return contexts.admin }
+
+var _ = Describe("Broker", func() {
+	var cfg config.Config
+	var regularUserCmdStarter, adminUserCmdStarter *starterFakes.FakeCmdStarter
+	var regularUserContext, adminUserContext workflowhelpers.UserContext
+
+	var commands = func(cmdStarter *starterFakes.FakeCmdStarter) [][]string {
+		var commands [][]string
+		for _, call := range cmdStarter.CalledWith {
+			commands = append(commands, call.Args)
+		}
+		return commands
+	}
+
+	BeforeEach(func() {
+		cfg = config.Config{
+			NamePrefix:                   "UNIT-TESTS",
+			AppsDomain:                   "apps.example.com",
+			TimeoutScale:                 2,
+			BrokerStartTimeout:           5,
+			AsyncServiceOperationTimeout: 2,
+		}
+
+		regularUserCmdStarter = starterFakes.NewFakeCmdStarter()
+		adminUserCmdStarter = starterFakes.NewFakeCmdStarter()
+
+		regularUserContext = workflowhelpers.UserContext{
+			ApiUrl:         "api.example.com",
+			CommandStarter: regularUserCmdStarter,
+			TestUser:       user{"username", "password"},
+			Timeout:        2 * time.Second,
+		}
+		adminUserContext = workflowhelpers.UserContext{
+			ApiUrl:         "api.example.com",
+			CommandStarter: adminUserCmdStarter,
+			TestUser:       user{"admin", "admin"},
+			Timeout:        2 * time.Second,
+		}
+		DeferCleanup(secrets.Reset)
+	})
+
+	It("declares a broker with a service and plan and the timeouts of the config", func() {
+		broker := NewSpaceScopedBroker(&cfg, regularUserContext)
+
+		Expect(broker.Name).To(MatchRegexp("UNIT-TESTS-[0-9]+-BROKER-.*"))
+		Expect(broker.Password).NotTo(BeEmpty())
+		Expect(broker.ServiceName()).To(MatchRegexp("UNIT-TESTS-[0-9]+-SERVICE-.*"))
+		Expect(broker.PlanName()).To(Equal("fake-plan"))
+		Expect(broker.Catalog.Services[0].ID).NotTo(Equal(broker.Catalog.Services[0].Plans[0].ID))
+		Expect(broker.URL()).To(Equal("https://" + broker.Name + ".apps.example.com"))
+		Expect(broker.StartTimeout).To(Equal(10 * time.Minute))
+		Expect(broker.AsyncTimeout).To(Equal(4 * time.Minute))
+		Expect(broker.Buildpack).To(Equal("go_buildpack"))
+	})
+
+	Describe("Push", func() {
+		var broker *Broker
+
+		BeforeEach(func() {
+			broker = NewSpaceScopedBroker(&cfg, regularUserContext)
+			broker.Credentials = map[string]interface{}{"uri": "fake://service"}
+			broker.AsyncOperationDuration = 10 * time.Second
+		})
+
+		AfterEach(func() {
+			broker.Destroy()
+		})
+
+		It("pushes the fake broker app with its configuration", func() {
+			broker.Push()
+
+			Expect(regularUserCmdStarter.CalledWith).To(HaveLen(1))
+			args := regularUserCmdStarter.CalledWith[0].Args
+			Expect(args[:2]).To(Equal([]string{"push", "-f"}))
+
+			manifestText, err := os.ReadFile(args[2])
+			Expect(err).NotTo(HaveOccurred())
+			var manifest struct {
+				Applications []struct {
+					Name       string
+					Path       string
+					Buildpacks []string
+					Memory     string
+					Routes     []map[string]string
+				}
+			}
+			Expect(yaml.Unmarshal(manifestText, &manifest)).To(Succeed())
+			Expect(manifest.Applications).To(HaveLen(1))
+			app := manifest.Applications[0]
+			Expect(app.Name).To(Equal(broker.Name))
+			Expect(app.Buildpacks).To(Equal([]string{"go_buildpack"}))
+			Expect(app.Routes).To(Equal([]map[string]string{{"route": broker.Name + ".apps.example.com"}}))
+
+			mainSource, err := os.ReadFile(filepath.Join(app.Path, "main.go"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(mainSource)).To(HavePrefix("// fakebroker"))
+			Expect(string(mainSource)).To(ContainSubstring(`"fakebroker/osbfake"`))
+			Expect(filepath.Join(app.Path, "go.mod")).To(BeAnExistingFile())
+			Expect(filepath.Join(app.Path, "osbfake", "broker.go")).To(BeAnExistingFile())
+			testSources, err := filepath.Glob(filepath.Join(app.Path, "osbfake", "*_test.go"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(testSources).To(BeEmpty())
+
+			var appConfig map[string]interface{}
+			contents, err := os.ReadFile(filepath.Join(app.Path, "config.json"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(json.Unmarshal(contents, &appConfig)).To(Succeed())
+			Expect(appConfig).To(HaveKeyWithValue("username", broker.Username))
+			Expect(appConfig).To(HaveKeyWithValue("password", broker.Password))
+			Expect(appConfig).To(HaveKeyWithValue("async_operation_duration", BeEquivalentTo(10*time.Second)))
+			Expect(appConfig).To(HaveKeyWithValue("credentials", map[string]interface{}{"uri": "fake://service"}))
+			Expect(appConfig).To(HaveKey("catalog"))
+		})
+
+		It("fails when the async operations would outlast the async timeout", func() {
+			broker.AsyncOperationDuration = broker.AsyncTimeout
+
+			failures := InterceptGomegaFailures(broker.Push)
+			Expect(failures).To(ContainElement(ContainSubstring("would outlast the AsyncTimeout")))
+		})
+	})
+
+	Context("space-scoped", func() {
+		It("registers the broker in the space as the user and deletes it with its app", func() {
+			broker := NewSpaceScopedBroker(&cfg, regularUserContext)
+			broker.Create()
+			broker.Destroy()
+
+			Expect(commands(regularUserCmdStarter)[1:]).To(Equal([][]string{
+				{"create-service-broker", broker.Name, broker.Username, broker.Password, broker.URL(), "--space-scoped"},
+				{"delete-service-broker", broker.Name, "-f"},
+				{"delete", broker.Name, "-f", "-r"},
+			}))
+			Expect(adminUserCmdStarter.CalledWith).To(BeEmpty())
+		})
+	})
+
+	Context("global", func() {
+		It("registers the broker and enables access to its services as the admin", func() {
+			broker := NewGlobalBroker(&cfg, regularUserContext, adminUserContext)
+			broker.Create()
+
+			Expect(commands(regularUserCmdStarter)).To(HaveLen(1))
+			Expect(commands(adminUserCmdStarter)).To(ContainElements(
+				[]string{"create-service-broker", broker.Name, broker.Username, broker.Password, broker.URL()},
+				[]string{"enable-service-access", broker.ServiceName(), "-b", broker.Name},
+			))
+
+			broker.Destroy()
+			Expect(commands(adminUserCmdStarter)).To(ContainElement([]string{"delete-service-broker", broker.Name, "-f"}))
+			Expect(commands(regularUserCmdStarter)).To(ContainElement([]string{"delete", broker.Name, "-f", "-r"}))
+		})
+	})
+
+	Context("of a suite", func() {
+		It("runs as the users of the contexts the suite holds when it is created, not declared", func() {
+			contexts := &suiteContexts{}
+			broker := NewGlobalSuiteBroker(&cfg, contexts)
+
+			contexts.regular = regularUserContext
+			contexts.regular.AppLabels = map[string]string{"some-label": "some-value"}
+			contexts.admin = adminUserContext
+			broker.Create()
+
+			manifestText, err := os.ReadFile(regularUserCmdStarter.CalledWith[0].Args[2])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(manifestText)).To(ContainSubstring("some-label: some-value"))
+
+			broker.Destroy()
+
+			Expect(commands(regularUserCmdStarter)).To(ContainElement([]string{"delete", broker.Name, "-f", "-r"}))
+			Expect(commands(adminUserCmdStarter)).To(ContainElement([]string{"create-service-broker", broker.Name, broker.Username, broker.Password, broker.URL()}))
+		})
+
+		It("registers a space scoped broker as the regular user", func() {
+			contexts := &suiteContexts{}
+			broker := NewSpaceScopedSuiteBroker(&cfg, contexts)
+
+			contexts.regular = regularUserContext
+			broker.Create()
+
+			Expect(commands(regularUserCmdStarter)[1]).To(Equal([]string{"create-service-broker", broker.Name, broker.Username, broker.Password, broker.URL(), "--space-scoped"}))
+			Expect(adminUserCmdStarter.CalledWith).To(BeEmpty())
+		})
+	})
+
+	It("leaves the password out of the command output", func() {
+		broker := NewSpaceScopedBroker(&cfg, regularUserContext)
+		broker.Create()
+		defer broker.Destroy()
+
+		output := string(CurrentSpecReport().CapturedGinkgoWriterOutput)
+		Expect(output).To(ContainSubstring("create-service-broker"))
+		Expect(strings.Contains(output, broker.Password)).To(BeFalse())
+	})
+})
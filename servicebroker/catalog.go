@@ -0,0 +1,12 @@
+package servicebroker
+
+import "github.com/cloudfoundry/cf-test-helpers/v2/servicebroker/osbfake"
+
+// The catalog of a Broker is served by the osbfake package it pushes.
+type (
+	Catalog      = osbfake.Catalog
+	Service      = osbfake.Service
+	Plan         = osbfake.Plan
+	VolumeMount  = osbfake.VolumeMount
+	VolumeDevice = osbfake.VolumeDevice
+)
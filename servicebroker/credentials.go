@@ -0,0 +1,163 @@
+package servicebroker
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+
+	"github.com/cloudfoundry/cf-test-helpers/v2/internal/secrets"
+	"github.com/cloudfoundry/cf-test-helpers/v2/workflowhelpers"
+	"github.com/onsi/gomega"
+)
+
+// publicKeys are the credential names whose values are left in the output.
+// Any other value may hold a secret, like the password in the query of a
+// JDBC URL.
+var publicKeys = []string{"host", "hostname", "port", "name", "username"}
+
+// minSecretLength keeps values like "a" or "on" from being redacted all over
+// the output.
+const minSecretLength = 4
+
+// ServiceBinding is a binding of an app in its VCAP_SERVICES.
+type ServiceBinding struct {
+	Name           string                 `json:"name"`
+	InstanceName   string                 `json:"instance_name"`
+	InstanceGuid   string                 `json:"instance_guid"`
+	BindingName    string                 `json:"binding_name"`
+	BindingGuid    string                 `json:"binding_guid"`
+	Label          string                 `json:"label"`
+	Plan           string                 `json:"plan"`
+	Tags           []string               `json:"tags"`
+	Credentials    map[string]interface{} `json:"credentials"`
+	SyslogDrainURL string                 `json:"syslog_drain_url"`
+	VolumeMounts   []VolumeMount          `json:"volume_mounts"`
+}
+
+// DecodeCredentials decodes the credentials of the binding into a struct
+// or map, as json.Unmarshal would.
+func (binding ServiceBinding) DecodeCredentials(credentials interface{}) error {
+	return decodeCredentials(binding.Credentials, credentials)
+}
+
+type appEnv struct {
+	SystemEnvJSON struct {
+		VcapServices map[string][]ServiceBinding `json:"VCAP_SERVICES"`
+	} `json:"system_env_json"`
+}
+
+type credentialBindingDetails struct {
+	Credentials map[string]interface{} `json:"credentials"`
+}
+
+// AppServiceBindings returns the VCAP_SERVICES of the app in the targeted
+// space, the bindings by the label of their service offering. The secrets
+// in their credentials are left out of the output from then on.
+func AppServiceBindings(userContext workflowhelpers.UserContext, appName string) map[string][]ServiceBinding {
+	spaceGuid, err := targetedSpaceGuid(userContext)
+	gomega.ExpectWithOffset(1, err).NotTo(gomega.HaveOccurred(), "Failed to look up the space of app %q", appName)
+
+	appGuid, err := findOne(userContext, "/v3/apps", url.Values{"names": {appName}, "space_guids": {spaceGuid}}, "app "+appName)
+	gomega.ExpectWithOffset(1, err).NotTo(gomega.HaveOccurred(), "Failed to look up app %q", appName)
+
+	var env appEnv
+	err = userContext.CfCurlWithoutOutput("GET", "/v3/apps/"+appGuid+"/env", nil, &env)
+	gomega.ExpectWithOffset(1, err).NotTo(gomega.HaveOccurred(), "Failed to read the environment of app %q", appName)
+
+	for _, bindings := range env.SystemEnvJSON.VcapServices {
+		for _, binding := range bindings {
+			registerSecrets(binding.Credentials)
+		}
+	}
+	return env.SystemEnvJSON.VcapServices
+}
+
+// AppBindingCredentials decodes the credentials of the binding of the app
+// to the service instance into a struct or map[string]interface{}, as
+// json.Unmarshal would:
+//
+//	var credentials struct {
+//		URI string `json:"uri"`
+//	}
+//	servicebroker.AppBindingCredentials(userContext, "my-app", "my-db", &credentials)
+func AppBindingCredentials(userContext workflowhelpers.UserContext, appName, instanceName string, credentials interface{}) {
+	var bound *ServiceBinding
+	for _, bindings := range AppServiceBindings(userContext, appName) {
+		for _, binding := range bindings {
+			if binding.InstanceName == instanceName || (binding.InstanceName == "" && binding.Name == instanceName) {
+				bound = &binding
+			}
+		}
+	}
+	gomega.ExpectWithOffset(1, bound).NotTo(gomega.BeNil(), "App %q is not bound to service instance %q", appName, instanceName)
+
+	err := bound.DecodeCredentials(credentials)
+	gomega.ExpectWithOffset(1, err).NotTo(gomega.HaveOccurred(), "Failed to decode the credentials of service instance %q", instanceName)
+}
+
+// ServiceKeyCredentials decodes the credentials of the key of the service
+// instance into a struct or map[string]interface{}, as json.Unmarshal
+// would. The secrets in them are left out of the output from then on.
+func ServiceKeyCredentials(userContext workflowhelpers.UserContext, instanceName, keyName string, credentials interface{}) {
+	instance, found, err := findServiceInstance(userContext, instanceName)
+	gomega.ExpectWithOffset(1, err).NotTo(gomega.HaveOccurred(), "Failed to look up service instance %q", instanceName)
+	gomega.ExpectWithOffset(1, found).To(gomega.BeTrue(), "Service instance %q does not exist", instanceName)
+
+	key, found, err := findServiceKey(userContext, instance.Guid, keyName)
+	gomega.ExpectWithOffset(1, err).NotTo(gomega.HaveOccurred(), "Failed to look up service key %q", keyName)
+	gomega.ExpectWithOffset(1, found).To(gomega.BeTrue(), "Service key %q does not exist", keyName)
+
+	var details credentialBindingDetails
+	err = userContext.CfCurlWithoutOutput("GET", "/v3/service_credential_bindings/"+key.Guid+"/details", nil, &details)
+	gomega.ExpectWithOffset(1, err).NotTo(gomega.HaveOccurred(), "Failed to read the credentials of service key %q", keyName)
+
+	registerSecrets(details.Credentials)
+	err = decodeCredentials(details.Credentials, credentials)
+	gomega.ExpectWithOffset(1, err).NotTo(gomega.HaveOccurred(), "Failed to decode the credentials of service key %q", keyName)
+}
+
+func decodeCredentials(decoded map[string]interface{}, credentials interface{}) error {
+	contents, err := json.Marshal(decoded)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(contents, credentials)
+}
+
+// registerSecrets registers the values of credentials, however deeply
+// nested, apart from those with public names, and the passwords in URIs.
+func registerSecrets(credentials map[string]interface{}) {
+	var walk func(name string, value interface{})
+	walk = func(name string, value interface{}) {
+		switch value := value.(type) {
+		case map[string]interface{}:
+			for key, nested := range value {
+				walk(key, nested)
+			}
+		case []interface{}:
+			for _, nested := range value {
+				walk(name, nested)
+			}
+		case string:
+			if !isPublicName(name) && len(value) >= minSecretLength {
+				secrets.Register(value)
+			}
+			if uri, err := url.Parse(value); err == nil && uri.User != nil {
+				if password, ok := uri.User.Password(); ok && len(password) >= minSecretLength {
+					secrets.Register(password)
+				}
+			}
+		}
+	}
+	walk("", credentials)
+}
+
+func isPublicName(name string) bool {
+	name = strings.ToLower(name)
+	for _, publicKey := range publicKeys {
+		if name == publicKey {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,37 @@
+// fakebroker is the app servicebroker.Broker pushes. It serves the osbfake
+// broker with the config in config.json, and only depends on the standard
+// library so that the Go buildpack can build it on its own.
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/cloudfoundry/cf-test-helpers/v2/servicebroker/osbfake"
+)
+
+func main() {
+	contents, err := os.ReadFile("config.json")
+	if err != nil {
+		log.Fatalf("reading config.json: %s", err)
+	}
+
+	var config osbfake.Config
+	err = json.Unmarshal(contents, &config)
+	if err != nil {
+		log.Fatalf("parsing config.json: %s", err)
+	}
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+
+	broker := osbfake.New(config)
+	log.Fatal(http.ListenAndServe(":"+port, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s %s", r.Method, r.URL)
+		broker.ServeHTTP(w, r)
+	})))
+}
@@ -0,0 +1,516 @@
+// Package osbfake implements the Open Service Broker API v2 as a fake that
+// serves a configured catalog and keeps its instances and bindings in
+// memory. Unit tests run it in-process with NewServer, and the
+// servicebroker package pushes it as an app, so it only depends on the
+// standard library.
+package osbfake
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Operation names the broker operations a Failure applies to, and the
+// operations last_operation reports on.
+type Operation string
+
+const (
+	CatalogOperation     Operation = "catalog"
+	ProvisionOperation   Operation = "provision"
+	UpdateOperation      Operation = "update"
+	DeprovisionOperation Operation = "deprovision"
+	BindOperation        Operation = "bind"
+	UnbindOperation      Operation = "unbind"
+)
+
+// Config is what the broker serves. The servicebroker package writes it to
+// the config.json of the pushed app.
+type Config struct {
+	Username string  `json:"username"`
+	Password string  `json:"password"`
+	Catalog  Catalog `json:"catalog"`
+
+	// AsyncOperationDuration makes the broker complete provisioning,
+	// updates and deprovisioning asynchronously after the duration, when
+	// the platform accepts that.
+	AsyncOperationDuration time.Duration `json:"async_operation_duration,omitempty"`
+
+	// Credentials, VolumeMounts and SyslogDrainURL are returned for every
+	// binding to an app, the RouteServiceURL for every binding to a route.
+	Credentials     map[string]interface{} `json:"credentials,omitempty"`
+	VolumeMounts    []VolumeMount          `json:"volume_mounts,omitempty"`
+	RouteServiceURL string                 `json:"route_service_url,omitempty"`
+	SyslogDrainURL  string                 `json:"syslog_drain_url,omitempty"`
+
+	Failures []Failure `json:"failures,omitempty"`
+}
+
+// Failure makes the broker fail every request for an operation with the
+// status code. Without one, the broker accepts asynchronous operations and
+// reports them as failed on last_operation, and fails the others with a 500.
+type Failure struct {
+	Operation   Operation `json:"operation"`
+	StatusCode  int       `json:"status_code,omitempty"`
+	Description string    `json:"description"`
+}
+
+// Request is a request the broker received, recorded for assertions.
+type Request struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Header http.Header
+	Body   []byte
+}
+
+// Instance is a service instance the broker provisioned.
+type Instance struct {
+	ServiceID  string                 `json:"service_id"`
+	PlanID     string                 `json:"plan_id"`
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+
+	operation *operation
+}
+
+// Binding is a service binding the broker created.
+type Binding struct {
+	Credentials     map[string]interface{} `json:"credentials,omitempty"`
+	VolumeMounts    []VolumeMount          `json:"volume_mounts,omitempty"`
+	RouteServiceURL string                 `json:"route_service_url,omitempty"`
+	SyslogDrainURL  string                 `json:"syslog_drain_url,omitempty"`
+	Parameters      map[string]interface{} `json:"parameters,omitempty"`
+}
+
+type operation struct {
+	kind    Operation
+	readyAt time.Time
+	failure *Failure
+	// previous is the instance before an update, for a failed update to
+	// restore its plan and parameters together.
+	previous Instance
+}
+
+// Broker is the http.Handler of the fake.
+type Broker struct {
+	config Config
+
+	lock      sync.Mutex
+	instances map[string]*Instance
+	// bindings are keyed by the ID of their instance, then their own.
+	bindings map[string]map[string]*Binding
+	requests []Request
+}
+
+func New(config Config) *Broker {
+	return &Broker{
+		config:    config,
+		instances: map[string]*Instance{},
+		bindings:  map[string]map[string]*Binding{},
+	}
+}
+
+// Requests returns the requests the broker received so far, in order.
+func (b *Broker) Requests() []Request {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return append([]Request(nil), b.requests...)
+}
+
+// RequestsTo returns the requests the broker received with the method for
+// paths that start with the prefix.
+func (b *Broker) RequestsTo(method, pathPrefix string) []Request {
+	var matching []Request
+	for _, request := range b.Requests() {
+		if request.Method == method && strings.HasPrefix(request.Path, pathPrefix) {
+			matching = append(matching, request)
+		}
+	}
+	return matching
+}
+
+// Instance returns the service instance with the ID, if the broker has it.
+func (b *Broker) Instance(instanceID string) (Instance, bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	instance, ok := b.instances[instanceID]
+	if !ok {
+		return Instance{}, false
+	}
+	return *instance, true
+}
+
+// Binding returns the service binding with the ID of the instance, if the
+// broker has it.
+func (b *Broker) Binding(instanceID, bindingID string) (Binding, bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	binding := b.bindings[instanceID][bindingID]
+	if binding == nil {
+		return Binding{}, false
+	}
+	return *binding, true
+}
+
+// SetFailures replaces the failures of the config, for specs that break the
+// broker after setting things up.
+func (b *Broker) SetFailures(failures ...Failure) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.config.Failures = failures
+}
+
+func (b *Broker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		respond(w, http.StatusBadRequest, errorResponse(err.Error()))
+		return
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.requests = append(b.requests, Request{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Query:  r.URL.Query(),
+		Header: r.Header.Clone(),
+		Body:   body,
+	})
+
+	username, password, ok := r.BasicAuth()
+	if !ok || username != b.config.Username || password != b.config.Password {
+		respond(w, http.StatusUnauthorized, errorResponse("wrong credentials"))
+		return
+	}
+	if version := r.Header.Get("X-Broker-API-Version"); !strings.HasPrefix(version, "2.") {
+		respond(w, http.StatusPreconditionFailed, errorResponse(fmt.Sprintf("unsupported API version %q", version)))
+		return
+	}
+
+	// /v2/catalog, /v2/service_instances/:id[/last_operation],
+	// /v2/service_instances/:id/service_bindings/:id[/last_operation]
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	async := r.URL.Query().Get("accepts_incomplete") == "true"
+	switch {
+	case len(parts) == 2 && parts[0] == "v2" && parts[1] == "catalog" && r.Method == http.MethodGet:
+		b.serveCatalog(w)
+	case len(parts) == 3 && parts[0] == "v2" && parts[1] == "service_instances":
+		b.serveInstance(w, r.Method, parts[2], body, async)
+	case len(parts) == 4 && parts[0] == "v2" && parts[1] == "service_instances" && parts[3] == "last_operation" && r.Method == http.MethodGet:
+		b.serveLastOperation(w, parts[2])
+	case len(parts) == 5 && parts[0] == "v2" && parts[1] == "service_instances" && parts[3] == "service_bindings":
+		b.serveBinding(w, r.Method, parts[2], parts[4], body)
+	case len(parts) == 6 && parts[0] == "v2" && parts[1] == "service_instances" && parts[3] == "service_bindings" && parts[5] == "last_operation" && r.Method == http.MethodGet:
+		b.serveBindingLastOperation(w, parts[2], parts[4])
+	default:
+		respond(w, http.StatusNotFound, errorResponse("unknown endpoint "+r.Method+" "+r.URL.Path))
+	}
+}
+
+func (b *Broker) serveCatalog(w http.ResponseWriter) {
+	if b.failsRightAway(w, CatalogOperation, http.StatusInternalServerError) {
+		return
+	}
+	respond(w, http.StatusOK, b.config.Catalog)
+}
+
+func (b *Broker) serveInstance(w http.ResponseWriter, method, instanceID string, body []byte, async bool) {
+	existing := b.instances[instanceID]
+
+	switch method {
+	case http.MethodGet:
+		if existing == nil {
+			respond(w, http.StatusNotFound, errorResponse("unknown service instance "+instanceID))
+			return
+		}
+		respond(w, http.StatusOK, existing)
+
+	case http.MethodPut:
+		var provisioned Instance
+		err := json.Unmarshal(body, &provisioned)
+		if err != nil {
+			respond(w, http.StatusBadRequest, errorResponse(err.Error()))
+			return
+		}
+		if existing != nil {
+			if existing.ServiceID != provisioned.ServiceID || existing.PlanID != provisioned.PlanID {
+				respond(w, http.StatusConflict, errorResponse("service instance "+instanceID+" exists with another plan"))
+				return
+			}
+			if existing.operation != nil && existing.operation.kind == ProvisionOperation {
+				respond(w, http.StatusAccepted, map[string]string{"operation": string(ProvisionOperation)})
+				return
+			}
+			respond(w, http.StatusOK, struct{}{})
+			return
+		}
+		if !b.hasPlan(provisioned.ServiceID, provisioned.PlanID) {
+			respond(w, http.StatusBadRequest, errorResponse(fmt.Sprintf("unknown plan %q of service %q", provisioned.PlanID, provisioned.ServiceID)))
+			return
+		}
+		if b.failsRightAway(w, ProvisionOperation, 0) {
+			return
+		}
+		b.instances[instanceID] = &provisioned
+		b.respondToOperation(w, instanceID, &provisioned, ProvisionOperation, Instance{}, async, http.StatusCreated)
+
+	case http.MethodPatch:
+		if existing == nil {
+			respond(w, http.StatusNotFound, errorResponse("unknown service instance "+instanceID))
+			return
+		}
+		var update Instance
+		err := json.Unmarshal(body, &update)
+		if err != nil {
+			respond(w, http.StatusBadRequest, errorResponse(err.Error()))
+			return
+		}
+		if update.PlanID != "" && !b.hasPlan(existing.ServiceID, update.PlanID) {
+			respond(w, http.StatusBadRequest, errorResponse(fmt.Sprintf("unknown plan %q of service %q", update.PlanID, existing.ServiceID)))
+			return
+		}
+		if b.failsRightAway(w, UpdateOperation, 0) {
+			return
+		}
+		previous := *existing
+		if update.PlanID != "" {
+			existing.PlanID = update.PlanID
+		}
+		if update.Parameters != nil {
+			existing.Parameters = update.Parameters
+		}
+		b.respondToOperation(w, instanceID, existing, UpdateOperation, previous, async, http.StatusOK)
+
+	case http.MethodDelete:
+		if existing == nil {
+			respond(w, http.StatusGone, struct{}{})
+			return
+		}
+		if b.failsRightAway(w, DeprovisionOperation, 0) {
+			return
+		}
+		if b.respondToOperation(w, instanceID, existing, DeprovisionOperation, Instance{}, async, http.StatusOK) {
+			b.remove(instanceID)
+		}
+
+	default:
+		respond(w, http.StatusMethodNotAllowed, errorResponse("method not allowed"))
+	}
+}
+
+// respondToOperation completes the operation right away, or accepts it to
+// complete after the configured duration when the platform accepts that.
+// Failures without a status code fail asynchronous operations once they
+// complete, and synchronous ones right away. It tells whether the operation
+// completed successfully.
+func (b *Broker) respondToOperation(w http.ResponseWriter, instanceID string, instance *Instance, kind Operation, previous Instance, async bool, status int) bool {
+	failure := b.failure(kind)
+	if !async || b.config.AsyncOperationDuration <= 0 {
+		if failure != nil {
+			b.revert(instanceID, instance, kind, previous)
+			respond(w, http.StatusInternalServerError, errorResponse(failure.Description))
+			return false
+		}
+		respond(w, status, struct{}{})
+		return true
+	}
+
+	instance.operation = &operation{
+		kind:     kind,
+		readyAt:  time.Now().Add(b.config.AsyncOperationDuration),
+		failure:  failure,
+		previous: previous,
+	}
+	respond(w, http.StatusAccepted, map[string]string{"operation": string(kind)})
+	return false
+}
+
+func (b *Broker) serveLastOperation(w http.ResponseWriter, instanceID string) {
+	existing := b.instances[instanceID]
+	if existing == nil || existing.operation == nil {
+		respond(w, http.StatusGone, struct{}{})
+		return
+	}
+
+	current := existing.operation
+	if time.Now().Before(current.readyAt) {
+		respond(w, http.StatusOK, lastOperation{State: "in progress", Description: string(current.kind) + " in progress"})
+		return
+	}
+
+	existing.operation = nil
+	if current.failure != nil {
+		b.revert(instanceID, existing, current.kind, current.previous)
+		respond(w, http.StatusOK, lastOperation{State: "failed", Description: current.failure.Description})
+		return
+	}
+	if current.kind == DeprovisionOperation {
+		b.remove(instanceID)
+		respond(w, http.StatusGone, struct{}{})
+		return
+	}
+	respond(w, http.StatusOK, lastOperation{State: "succeeded", Description: string(current.kind) + " succeeded"})
+}
+
+// revert undoes what a failed operation did to the instance, as far as the
+// platform can tell.
+func (b *Broker) revert(instanceID string, instance *Instance, kind Operation, previous Instance) {
+	switch kind {
+	case ProvisionOperation:
+		b.remove(instanceID)
+	case UpdateOperation:
+		instance.PlanID = previous.PlanID
+		instance.Parameters = previous.Parameters
+	}
+}
+
+// remove drops the instance together with its bindings.
+func (b *Broker) remove(instanceID string) {
+	delete(b.instances, instanceID)
+	delete(b.bindings, instanceID)
+}
+
+func (b *Broker) serveBinding(w http.ResponseWriter, method, instanceID, bindingID string, body []byte) {
+	switch method {
+	case http.MethodGet:
+		existing := b.bindings[instanceID][bindingID]
+		if existing == nil {
+			respond(w, http.StatusNotFound, errorResponse("unknown service binding "+bindingID))
+			return
+		}
+		respond(w, http.StatusOK, existing)
+
+	case http.MethodPut:
+		if b.instances[instanceID] == nil {
+			respond(w, http.StatusNotFound, errorResponse("unknown service instance "+instanceID))
+			return
+		}
+		if existing := b.bindings[instanceID][bindingID]; existing != nil {
+			respond(w, http.StatusOK, existing)
+			return
+		}
+
+		var request struct {
+			BindResource struct {
+				Route string `json:"route"`
+			} `json:"bind_resource"`
+			Parameters map[string]interface{} `json:"parameters"`
+		}
+		err := json.Unmarshal(body, &request)
+		if err != nil {
+			respond(w, http.StatusBadRequest, errorResponse(err.Error()))
+			return
+		}
+		if b.failsRightAway(w, BindOperation, http.StatusInternalServerError) {
+			return
+		}
+
+		created := &Binding{
+			Credentials:    b.config.Credentials,
+			VolumeMounts:   b.config.VolumeMounts,
+			SyslogDrainURL: b.config.SyslogDrainURL,
+			Parameters:     request.Parameters,
+		}
+		if request.BindResource.Route != "" {
+			created = &Binding{RouteServiceURL: b.config.RouteServiceURL, Parameters: request.Parameters}
+		}
+		if b.bindings[instanceID] == nil {
+			b.bindings[instanceID] = map[string]*Binding{}
+		}
+		b.bindings[instanceID][bindingID] = created
+		respond(w, http.StatusCreated, created)
+
+	case http.MethodDelete:
+		if b.bindings[instanceID][bindingID] == nil {
+			respond(w, http.StatusGone, struct{}{})
+			return
+		}
+		if b.failsRightAway(w, UnbindOperation, http.StatusInternalServerError) {
+			return
+		}
+		delete(b.bindings[instanceID], bindingID)
+		respond(w, http.StatusOK, struct{}{})
+
+	default:
+		respond(w, http.StatusMethodNotAllowed, errorResponse("method not allowed"))
+	}
+}
+
+// serveBindingLastOperation reports on bindings, which the broker always
+// creates and deletes right away.
+func (b *Broker) serveBindingLastOperation(w http.ResponseWriter, instanceID, bindingID string) {
+	if b.bindings[instanceID][bindingID] == nil {
+		respond(w, http.StatusGone, struct{}{})
+		return
+	}
+	respond(w, http.StatusOK, lastOperation{State: "succeeded"})
+}
+
+func (b *Broker) hasPlan(serviceID, planID string) bool {
+	for _, service := range b.config.Catalog.Services {
+		if service.ID != serviceID {
+			continue
+		}
+		for _, plan := range service.Plans {
+			if plan.ID == planID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (b *Broker) failure(kind Operation) *Failure {
+	for _, failure := range b.config.Failures {
+		if failure.Operation == kind {
+			return &failure
+		}
+	}
+	return nil
+}
+
+// failsRightAway responds to the request with the status code of a failure
+// for the operation, or the default status code for failures without one.
+// Operations that can fail asynchronously have no default.
+func (b *Broker) failsRightAway(w http.ResponseWriter, kind Operation, defaultStatus int) bool {
+	failure := b.failure(kind)
+	if failure == nil {
+		return false
+	}
+
+	status := failure.StatusCode
+	if status == 0 {
+		status = defaultStatus
+	}
+	if status == 0 {
+		return false
+	}
+	respond(w, status, errorResponse(failure.Description))
+	return true
+}
+
+type lastOperation struct {
+	State       string `json:"state"`
+	Description string `json:"description,omitempty"`
+}
+
+func errorResponse(description string) map[string]string {
+	return map[string]string{"description": description}
+}
+
+func respond(w http.ResponseWriter, status int, body interface{}) {
+	contents, err := json.Marshal(body)
+	if err != nil {
+		status = http.StatusInternalServerError
+		contents = []byte(fmt.Sprintf(`{"description":%q}`, err.Error()))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(contents)
+}
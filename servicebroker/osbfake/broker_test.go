@@ -0,0 +1,315 @@
+package osbfake_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	. "github.com/cloudfoundry/cf-test-helpers/v2/servicebroker/osbfake"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Broker", func() {
+	var config Config
+	var server *Server
+
+	var request = func(method, path, body string) (int, map[string]interface{}) {
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		req.SetBasicAuth("user", "secret")
+		req.Header.Set("X-Broker-API-Version", "2.17")
+
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+
+		contents, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		var response map[string]interface{}
+		Expect(json.Unmarshal(contents, &response)).To(Succeed())
+		return resp.StatusCode, response
+	}
+
+	const provision = `{"service_id":"service-id","plan_id":"plan-id","parameters":{"size":"small"}}`
+
+	BeforeEach(func() {
+		config = Config{
+			Username: "user",
+			Password: "secret",
+			Catalog: Catalog{Services: []Service{{
+				ID:       "service-id",
+				Name:     "fake-service",
+				Bindable: true,
+				Plans: []Plan{
+					{ID: "plan-id", Name: "fake-plan"},
+					{ID: "other-plan-id", Name: "other-plan"},
+				},
+			}}},
+			Credentials: map[string]interface{}{"uri": "fake://service"},
+		}
+	})
+
+	JustBeforeEach(func() {
+		server = NewServer(config)
+		DeferCleanup(server.Close)
+	})
+
+	It("serves the catalog", func() {
+		status, catalog := request("GET", "/v2/catalog", "")
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(catalog).To(HaveKeyWithValue("services", ConsistOf(HaveKeyWithValue("name", "fake-service"))))
+	})
+
+	It("rejects requests with the wrong credentials", func() {
+		req, err := http.NewRequest("GET", server.URL+"/v2/catalog", nil)
+		Expect(err).NotTo(HaveOccurred())
+		req.SetBasicAuth("user", "wrong")
+		req.Header.Set("X-Broker-API-Version", "2.17")
+
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("rejects requests without a supported API version", func() {
+		req, err := http.NewRequest("GET", server.URL+"/v2/catalog", nil)
+		Expect(err).NotTo(HaveOccurred())
+		req.SetBasicAuth("user", "secret")
+
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusPreconditionFailed))
+	})
+
+	It("records the requests it receives", func() {
+		request("PUT", "/v2/service_instances/instance-id?accepts_incomplete=true", provision)
+		request("GET", "/v2/catalog", "")
+
+		requests := server.Broker.Requests()
+		Expect(requests).To(HaveLen(2))
+		Expect(requests[0].Method).To(Equal("PUT"))
+		Expect(requests[0].Path).To(Equal("/v2/service_instances/instance-id"))
+		Expect(requests[0].Query.Get("accepts_incomplete")).To(Equal("true"))
+		Expect(requests[0].Header.Get("X-Broker-API-Version")).To(Equal("2.17"))
+		Expect(string(requests[0].Body)).To(Equal(provision))
+
+		Expect(server.Broker.RequestsTo("PUT", "/v2/service_instances/")).To(HaveLen(1))
+	})
+
+	Describe("service instances", func() {
+		It("provisions, updates and deprovisions instances right away", func() {
+			status, _ := request("PUT", "/v2/service_instances/instance-id", provision)
+			Expect(status).To(Equal(http.StatusCreated))
+			instance, ok := server.Broker.Instance("instance-id")
+			Expect(ok).To(BeTrue())
+			Expect(instance.PlanID).To(Equal("plan-id"))
+			Expect(instance.Parameters).To(Equal(map[string]interface{}{"size": "small"}))
+
+			status, _ = request("PUT", "/v2/service_instances/instance-id", provision)
+			Expect(status).To(Equal(http.StatusOK))
+
+			status, _ = request("PATCH", "/v2/service_instances/instance-id", `{"plan_id":"other-plan-id"}`)
+			Expect(status).To(Equal(http.StatusOK))
+			instance, _ = server.Broker.Instance("instance-id")
+			Expect(instance.PlanID).To(Equal("other-plan-id"))
+
+			status, _ = request("DELETE", "/v2/service_instances/instance-id?service_id=service-id&plan_id=other-plan-id", "")
+			Expect(status).To(Equal(http.StatusOK))
+			_, ok = server.Broker.Instance("instance-id")
+			Expect(ok).To(BeFalse())
+
+			status, _ = request("DELETE", "/v2/service_instances/instance-id", "")
+			Expect(status).To(Equal(http.StatusGone))
+		})
+
+		It("rejects plans that are not in the catalog", func() {
+			status, response := request("PUT", "/v2/service_instances/instance-id", `{"service_id":"service-id","plan_id":"unknown"}`)
+			Expect(status).To(Equal(http.StatusBadRequest))
+			Expect(response).To(HaveKeyWithValue("description", ContainSubstring("unknown")))
+		})
+
+		It("conflicts with an existing instance of another plan", func() {
+			request("PUT", "/v2/service_instances/instance-id", provision)
+			status, _ := request("PUT", "/v2/service_instances/instance-id", `{"service_id":"service-id","plan_id":"other-plan-id"}`)
+			Expect(status).To(Equal(http.StatusConflict))
+		})
+
+		Context("with an async operation duration", func() {
+			BeforeEach(func() {
+				config.AsyncOperationDuration = 200 * time.Millisecond
+			})
+
+			It("completes operations after the duration, when the platform accepts that", func() {
+				status, response := request("PUT", "/v2/service_instances/instance-id?accepts_incomplete=true", provision)
+				Expect(status).To(Equal(http.StatusAccepted))
+				Expect(response).To(HaveKeyWithValue("operation", "provision"))
+
+				status, response = request("GET", "/v2/service_instances/instance-id/last_operation", "")
+				Expect(status).To(Equal(http.StatusOK))
+				Expect(response).To(HaveKeyWithValue("state", "in progress"))
+
+				status, response = request("PUT", "/v2/service_instances/instance-id?accepts_incomplete=true", provision)
+				Expect(status).To(Equal(http.StatusAccepted))
+				Expect(response).To(HaveKeyWithValue("operation", "provision"))
+
+				Eventually(func() interface{} {
+					_, response := request("GET", "/v2/service_instances/instance-id/last_operation", "")
+					return response["state"]
+				}).Should(Equal("succeeded"))
+
+				status, _ = request("DELETE", "/v2/service_instances/instance-id?accepts_incomplete=true", "")
+				Expect(status).To(Equal(http.StatusAccepted))
+				_, ok := server.Broker.Instance("instance-id")
+				Expect(ok).To(BeTrue())
+
+				Eventually(func() int {
+					status, _ := request("GET", "/v2/service_instances/instance-id/last_operation", "")
+					return status
+				}).Should(Equal(http.StatusGone))
+				_, ok = server.Broker.Instance("instance-id")
+				Expect(ok).To(BeFalse())
+			})
+
+			It("completes operations right away otherwise", func() {
+				status, _ := request("PUT", "/v2/service_instances/instance-id", provision)
+				Expect(status).To(Equal(http.StatusCreated))
+			})
+
+			It("reports failed operations on last_operation and reverts them", func() {
+				request("PUT", "/v2/service_instances/instance-id", provision)
+				server.Broker.SetFailures(Failure{Operation: UpdateOperation, Description: "no capacity left"})
+
+				status, _ := request("PATCH", "/v2/service_instances/instance-id?accepts_incomplete=true", `{"plan_id":"other-plan-id","parameters":{"size":"large"}}`)
+				Expect(status).To(Equal(http.StatusAccepted))
+
+				Eventually(func() map[string]interface{} {
+					_, response := request("GET", "/v2/service_instances/instance-id/last_operation", "")
+					return response
+				}).Should(Equal(map[string]interface{}{"state": "failed", "description": "no capacity left"}))
+
+				instance, _ := server.Broker.Instance("instance-id")
+				Expect(instance.PlanID).To(Equal("plan-id"))
+				Expect(instance.Parameters).To(Equal(map[string]interface{}{"size": "small"}))
+			})
+		})
+
+		Context("with failures in the config", func() {
+			BeforeEach(func() {
+				config.Failures = []Failure{{Operation: ProvisionOperation, StatusCode: http.StatusUnprocessableEntity, Description: "invalid parameters"}}
+			})
+
+			It("fails operations with the status code of the failure", func() {
+
+				status, response := request("PUT", "/v2/service_instances/instance-id?accepts_incomplete=true", provision)
+				Expect(status).To(Equal(http.StatusUnprocessableEntity))
+				Expect(response).To(HaveKeyWithValue("description", "invalid parameters"))
+				_, ok := server.Broker.Instance("instance-id")
+				Expect(ok).To(BeFalse())
+			})
+		})
+
+		It("fails synchronous operations without a status code with a 500", func() {
+			request("PUT", "/v2/service_instances/instance-id", provision)
+			server.Broker.SetFailures(Failure{Operation: DeprovisionOperation, Description: "stuck"})
+
+			status, _ := request("DELETE", "/v2/service_instances/instance-id", "")
+			Expect(status).To(Equal(http.StatusInternalServerError))
+			_, ok := server.Broker.Instance("instance-id")
+			Expect(ok).To(BeTrue())
+		})
+
+		It("reverts the plan and parameters of failed synchronous updates", func() {
+			request("PUT", "/v2/service_instances/instance-id", provision)
+			server.Broker.SetFailures(Failure{Operation: UpdateOperation, Description: "no capacity left"})
+
+			status, _ := request("PATCH", "/v2/service_instances/instance-id", `{"plan_id":"other-plan-id","parameters":{"size":"large"}}`)
+			Expect(status).To(Equal(http.StatusInternalServerError))
+			instance, _ := server.Broker.Instance("instance-id")
+			Expect(instance.PlanID).To(Equal("plan-id"))
+			Expect(instance.Parameters).To(Equal(map[string]interface{}{"size": "small"}))
+		})
+	})
+
+	Describe("service bindings", func() {
+		JustBeforeEach(func() {
+			request("PUT", "/v2/service_instances/instance-id", provision)
+		})
+
+		It("binds apps with the credentials and unbinds them", func() {
+			status, response := request("PUT", "/v2/service_instances/instance-id/service_bindings/binding-id", `{"bind_resource":{"app_guid":"app-guid"}}`)
+			Expect(status).To(Equal(http.StatusCreated))
+			Expect(response).To(HaveKeyWithValue("credentials", map[string]interface{}{"uri": "fake://service"}))
+
+			status, response = request("GET", "/v2/service_instances/instance-id/service_bindings/binding-id", "")
+			Expect(status).To(Equal(http.StatusOK))
+			Expect(response).To(HaveKey("credentials"))
+
+			status, response = request("GET", "/v2/service_instances/instance-id/service_bindings/binding-id/last_operation", "")
+			Expect(status).To(Equal(http.StatusOK))
+			Expect(response).To(HaveKeyWithValue("state", "succeeded"))
+
+			status, _ = request("DELETE", "/v2/service_instances/instance-id/service_bindings/binding-id", "")
+			Expect(status).To(Equal(http.StatusOK))
+			_, ok := server.Broker.Binding("instance-id", "binding-id")
+			Expect(ok).To(BeFalse())
+
+			status, _ = request("DELETE", "/v2/service_instances/instance-id/service_bindings/binding-id", "")
+			Expect(status).To(Equal(http.StatusGone))
+		})
+
+		Context("with a route service URL", func() {
+			BeforeEach(func() {
+				config.RouteServiceURL = "https://route-service.example.com"
+			})
+
+			It("binds routes to the route service without credentials", func() {
+				status, response := request("PUT", "/v2/service_instances/instance-id/service_bindings/binding-id", `{"bind_resource":{"route":"app.example.com"}}`)
+				Expect(status).To(Equal(http.StatusCreated))
+				Expect(response).To(Equal(map[string]interface{}{"route_service_url": "https://route-service.example.com"}))
+			})
+		})
+
+		It("keeps the bindings of each instance apart", func() {
+			request("PUT", "/v2/service_instances/other-instance-id", provision)
+			request("PUT", "/v2/service_instances/instance-id/service_bindings/binding-id", `{}`)
+
+			status, _ := request("GET", "/v2/service_instances/other-instance-id/service_bindings/binding-id", "")
+			Expect(status).To(Equal(http.StatusNotFound))
+			status, _ = request("DELETE", "/v2/service_instances/other-instance-id/service_bindings/binding-id", "")
+			Expect(status).To(Equal(http.StatusGone))
+			_, ok := server.Broker.Binding("instance-id", "binding-id")
+			Expect(ok).To(BeTrue())
+		})
+
+		It("drops the bindings of deprovisioned instances", func() {
+			request("PUT", "/v2/service_instances/instance-id/service_bindings/binding-id", `{}`)
+
+			status, _ := request("DELETE", "/v2/service_instances/instance-id", "")
+			Expect(status).To(Equal(http.StatusOK))
+			_, ok := server.Broker.Binding("instance-id", "binding-id")
+			Expect(ok).To(BeFalse())
+
+			request("PUT", "/v2/service_instances/instance-id", provision)
+			status, _ = request("GET", "/v2/service_instances/instance-id/service_bindings/binding-id", "")
+			Expect(status).To(Equal(http.StatusNotFound))
+		})
+
+		It("does not bind unknown instances", func() {
+			status, _ := request("PUT", "/v2/service_instances/unknown/service_bindings/binding-id", `{}`)
+			Expect(status).To(Equal(http.StatusNotFound))
+		})
+
+		It("fails binding with a failure", func() {
+			server.Broker.SetFailures(Failure{Operation: BindOperation, Description: "no credentials left"})
+
+			status, response := request("PUT", "/v2/service_instances/instance-id/service_bindings/binding-id", `{}`)
+			Expect(status).To(Equal(http.StatusInternalServerError))
+			Expect(response).To(HaveKeyWithValue("description", "no credentials left"))
+		})
+	})
+})
@@ -0,0 +1,45 @@
+package osbfake
+
+// Catalog is what the broker serves on /v2/catalog.
+type Catalog struct {
+	Services []Service `json:"services"`
+}
+
+type Service struct {
+	ID                   string   `json:"id"`
+	Name                 string   `json:"name"`
+	Description          string   `json:"description"`
+	Bindable             bool     `json:"bindable"`
+	PlanUpdateable       bool     `json:"plan_updateable,omitempty"`
+	InstancesRetrievable bool     `json:"instances_retrievable,omitempty"`
+	BindingsRetrievable  bool     `json:"bindings_retrievable,omitempty"`
+	Tags                 []string `json:"tags,omitempty"`
+
+	// Requires lists the permissions the service needs from the platform:
+	// "route_forwarding", "volume_mount" or "syslog_drain".
+	Requires []string `json:"requires,omitempty"`
+
+	Plans []Plan `json:"plans"`
+}
+
+type Plan struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Free        *bool  `json:"free,omitempty"`
+	Bindable    *bool  `json:"bindable,omitempty"`
+}
+
+// VolumeMount is returned with the bindings of volume services.
+type VolumeMount struct {
+	Driver       string       `json:"driver"`
+	ContainerDir string       `json:"container_dir"`
+	Mode         string       `json:"mode"`
+	DeviceType   string       `json:"device_type"`
+	Device       VolumeDevice `json:"device"`
+}
+
+type VolumeDevice struct {
+	VolumeID    string                 `json:"volume_id"`
+	MountConfig map[string]interface{} `json:"mount_config,omitempty"`
+}
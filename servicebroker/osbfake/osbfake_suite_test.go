@@ -0,0 +1,13 @@
+package osbfake_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestOsbfake(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Osbfake Suite")
+}
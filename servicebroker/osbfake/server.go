@@ -0,0 +1,22 @@
+package osbfake
+
+import (
+	"net/http/httptest"
+)
+
+// Server runs a Broker in-process, for unit tests of code that talks to
+// brokers.
+type Server struct {
+	*httptest.Server
+	Broker *Broker
+}
+
+// NewServer starts a broker with the config on a local port. Close it once
+// done.
+func NewServer(config Config) *Server {
+	broker := New(config)
+	return &Server{
+		Server: httptest.NewServer(broker),
+		Broker: broker,
+	}
+}
@@ -0,0 +1,343 @@
+package servicebroker
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/cf-test-helpers/v2/workflowhelpers"
+	"github.com/onsi/gomega"
+)
+
+// PollingInterval is how often the helpers below ask the Cloud Controller
+// how an operation is going.
+var PollingInterval = 2 * time.Second
+
+type asyncOperationConfig interface {
+	GetScaledTimeout(time.Duration) time.Duration
+	AsyncServiceOperationTimeoutDuration() time.Duration
+}
+
+// LastOperation is the latest create, update or delete of a service
+// instance or key, with the description the broker gave for it.
+type LastOperation struct {
+	Type        string `json:"type"`
+	State       string `json:"state"`
+	Description string `json:"description"`
+}
+
+type ServiceInstance struct {
+	Guid          string
+	Name          string
+	PlanGuid      string
+	LastOperation LastOperation
+}
+
+type ServiceKey struct {
+	Guid          string
+	Name          string
+	LastOperation LastOperation
+}
+
+type v3Resource struct {
+	Guid          string        `json:"guid"`
+	Name          string        `json:"name"`
+	LastOperation LastOperation `json:"last_operation"`
+	Relationships struct {
+		ServicePlan     v3Relationship `json:"service_plan"`
+		ServiceOffering v3Relationship `json:"service_offering"`
+	} `json:"relationships"`
+}
+
+type v3Relationship struct {
+	Data struct {
+		Guid string `json:"guid"`
+	} `json:"data"`
+}
+
+type v3Resources struct {
+	Resources []v3Resource `json:"resources"`
+}
+
+type v3Job struct {
+	State  string `json:"state"`
+	Errors []struct {
+		Detail string `json:"detail"`
+	} `json:"errors"`
+}
+
+func relationshipTo(guid string) map[string]interface{} {
+	return map[string]interface{}{"data": map[string]string{"guid": guid}}
+}
+
+// CreateServiceInstance creates a managed service instance of the plan in
+// the space the context targets, and waits for the broker to provision it.
+func CreateServiceInstance(config asyncOperationConfig, userContext workflowhelpers.UserContext, name, serviceOffering, plan string, parameters map[string]interface{}) ServiceInstance {
+	spaceGuid, err := targetedSpaceGuid(userContext)
+	gomega.ExpectWithOffset(1, err).NotTo(gomega.HaveOccurred(), "Failed to look up the space for service instance %q", name)
+
+	planGuid, err := findOne(userContext, "/v3/service_plans", url.Values{"names": {plan}, "service_offering_names": {serviceOffering}}, "plan "+plan+" of "+serviceOffering)
+	gomega.ExpectWithOffset(1, err).NotTo(gomega.HaveOccurred(), "Failed to look up the plan for service instance %q", name)
+
+	body := map[string]interface{}{
+		"type": "managed",
+		"name": name,
+		"relationships": map[string]interface{}{
+			"space":        relationshipTo(spaceGuid),
+			"service_plan": relationshipTo(planGuid),
+		},
+	}
+	if parameters != nil {
+		body["parameters"] = parameters
+	}
+	err = userContext.CfCurl("POST", "/v3/service_instances", body, nil)
+	gomega.ExpectWithOffset(1, err).NotTo(gomega.HaveOccurred(), "Failed to create service instance %q", name)
+
+	return waitForServiceInstance(config, userContext, name, "create")
+}
+
+// UpdateServiceInstance moves the service instance to another plan of its
+// service offering, unless the plan is empty, and updates its parameters,
+// unless they are nil. It waits for the broker to update it.
+func UpdateServiceInstance(config asyncOperationConfig, userContext workflowhelpers.UserContext, name, plan string, parameters map[string]interface{}) ServiceInstance {
+	instance, found, err := findServiceInstance(userContext, name)
+	gomega.ExpectWithOffset(1, err).NotTo(gomega.HaveOccurred(), "Failed to look up service instance %q", name)
+	gomega.ExpectWithOffset(1, found).To(gomega.BeTrue(), "Service instance %q does not exist", name)
+
+	body := map[string]interface{}{}
+	if plan != "" {
+		planGuid, err := findPlanOfSameOffering(userContext, instance.Relationships.ServicePlan.Data.Guid, plan)
+		gomega.ExpectWithOffset(1, err).NotTo(gomega.HaveOccurred(), "Failed to look up the plan for service instance %q", name)
+		body["relationships"] = map[string]interface{}{"service_plan": relationshipTo(planGuid)}
+	}
+	if parameters != nil {
+		body["parameters"] = parameters
+	}
+	err = userContext.CfCurl("PATCH", "/v3/service_instances/"+instance.Guid, body, nil)
+	gomega.ExpectWithOffset(1, err).NotTo(gomega.HaveOccurred(), "Failed to update service instance %q", name)
+
+	return waitForServiceInstance(config, userContext, name, "update")
+}
+
+// DeleteServiceInstance deletes the service instance, if there is one, and
+// waits for the broker to deprovision it.
+func DeleteServiceInstance(config asyncOperationConfig, userContext workflowhelpers.UserContext, name string) {
+	instance, found, err := findServiceInstance(userContext, name)
+	gomega.ExpectWithOffset(1, err).NotTo(gomega.HaveOccurred(), "Failed to look up service instance %q", name)
+	if !found {
+		return
+	}
+
+	err = userContext.CfCurl("DELETE", "/v3/service_instances/"+instance.Guid, nil, nil)
+	gomega.ExpectWithOffset(1, err).NotTo(gomega.HaveOccurred(), "Failed to delete service instance %q", name)
+
+	waitForLastOperation(config, "delete of service instance "+name, "delete", func() (LastOperation, bool, error) {
+		instance, found, err := findServiceInstance(userContext, name)
+		return instance.LastOperation, found, err
+	})
+}
+
+// WaitForServiceInstance waits for the latest operation on the service
+// instance to succeed, for instances created some other way, for instance
+// with cf create-service.
+func WaitForServiceInstance(config asyncOperationConfig, userContext workflowhelpers.UserContext, name string) ServiceInstance {
+	return waitForServiceInstance(config, userContext, name, "")
+}
+
+func waitForServiceInstance(config asyncOperationConfig, userContext workflowhelpers.UserContext, name, operationType string) ServiceInstance {
+	var instance v3Resource
+	description := "last operation on service instance " + name
+	if operationType != "" {
+		description = operationType + " of service instance " + name
+	}
+	waitForLastOperation(config, description, operationType, func() (LastOperation, bool, error) {
+		var found bool
+		var err error
+		instance, found, err = findServiceInstance(userContext, name)
+		return instance.LastOperation, found, err
+	})
+
+	return ServiceInstance{
+		Guid:          instance.Guid,
+		Name:          instance.Name,
+		PlanGuid:      instance.Relationships.ServicePlan.Data.Guid,
+		LastOperation: instance.LastOperation,
+	}
+}
+
+// CreateServiceKey creates a key for the service instance and waits for
+// the broker to create its credentials.
+func CreateServiceKey(config asyncOperationConfig, userContext workflowhelpers.UserContext, instanceName, keyName string, parameters map[string]interface{}) ServiceKey {
+	instance, found, err := findServiceInstance(userContext, instanceName)
+	gomega.ExpectWithOffset(1, err).NotTo(gomega.HaveOccurred(), "Failed to look up service instance %q", instanceName)
+	gomega.ExpectWithOffset(1, found).To(gomega.BeTrue(), "Service instance %q does not exist", instanceName)
+
+	body := map[string]interface{}{
+		"type": "key",
+		"name": keyName,
+		"relationships": map[string]interface{}{
+			"service_instance": relationshipTo(instance.Guid),
+		},
+	}
+	if parameters != nil {
+		body["parameters"] = parameters
+	}
+	err = userContext.CfCurl("POST", "/v3/service_credential_bindings", body, nil)
+	gomega.ExpectWithOffset(1, err).NotTo(gomega.HaveOccurred(), "Failed to create service key %q", keyName)
+
+	var key v3Resource
+	waitForLastOperation(config, "create of service key "+keyName, "create", func() (LastOperation, bool, error) {
+		var found bool
+		var err error
+		key, found, err = findServiceKey(userContext, instance.Guid, keyName)
+		return key.LastOperation, found, err
+	})
+	return ServiceKey{Guid: key.Guid, Name: key.Name, LastOperation: key.LastOperation}
+}
+
+// DeleteServiceKey deletes the key of the service instance, if there is
+// one, and waits for the broker to delete its credentials.
+func DeleteServiceKey(config asyncOperationConfig, userContext workflowhelpers.UserContext, instanceName, keyName string) {
+	instance, found, err := findServiceInstance(userContext, instanceName)
+	gomega.ExpectWithOffset(1, err).NotTo(gomega.HaveOccurred(), "Failed to look up service instance %q", instanceName)
+	if !found {
+		return
+	}
+
+	key, found, err := findServiceKey(userContext, instance.Guid, keyName)
+	gomega.ExpectWithOffset(1, err).NotTo(gomega.HaveOccurred(), "Failed to look up service key %q", keyName)
+	if !found {
+		return
+	}
+
+	err = userContext.CfCurl("DELETE", "/v3/service_credential_bindings/"+key.Guid, nil, nil)
+	gomega.ExpectWithOffset(1, err).NotTo(gomega.HaveOccurred(), "Failed to delete service key %q", keyName)
+
+	waitForLastOperation(config, "delete of service key "+keyName, "delete", func() (LastOperation, bool, error) {
+		key, found, err := findServiceKey(userContext, instance.Guid, keyName)
+		return key.LastOperation, found, err
+	})
+}
+
+// WaitForJob waits for the v3 job at the URL or path, as returned in the
+// Location header of asynchronous requests, to complete.
+func WaitForJob(config asyncOperationConfig, userContext workflowhelpers.UserContext, jobURL string) {
+	jobPath := jobURL
+	if index := strings.Index(jobPath, "/v3/jobs/"); index >= 0 {
+		jobPath = jobPath[index:]
+	}
+
+	gomega.EventuallyWithOffset(1, func() (string, error) {
+		job, err := getJob(userContext, jobPath)
+		if err != nil {
+			return "", err
+		}
+		if job.State == "FAILED" {
+			var details []string
+			for _, jobError := range job.Errors {
+				details = append(details, jobError.Detail)
+			}
+			return job.State, gomega.StopTrying(fmt.Sprintf("Job %s failed: %s", jobPath, strings.Join(details, "; ")))
+		}
+		return job.State, nil
+	}, config.GetScaledTimeout(config.AsyncServiceOperationTimeoutDuration()), PollingInterval).Should(gomega.Equal("COMPLETE"), "Job %s did not complete in time", jobPath)
+}
+
+// getJob reads the job without CfCurl, as the errors of failed jobs look
+// like the errors of a failed request.
+func getJob(userContext workflowhelpers.UserContext, jobPath string) (v3Job, error) {
+	var job v3Job
+	session := userContext.Cf("curl", jobPath)
+	select {
+	case <-session.Exited:
+	case <-time.After(userContext.Timeout):
+		<-session.Kill().Exited
+		return job, fmt.Errorf("cf curl %s timed out after %s", jobPath, userContext.Timeout)
+	}
+	if session.ExitCode() != 0 {
+		return job, fmt.Errorf("cf curl %s exited with %d", jobPath, session.ExitCode())
+	}
+
+	err := json.Unmarshal(session.Out.Contents(), &job)
+	return job, err
+}
+
+// waitForLastOperation polls the last operation of a resource until an
+// operation of the type succeeded, or of any type without one. Deletes are
+// done once the resource is gone. It stops right away when the operation
+// failed, with the description the broker gave.
+func waitForLastOperation(config asyncOperationConfig, description, operationType string, lastOperation func() (LastOperation, bool, error)) {
+	done := "succeeded"
+	if operationType == "delete" {
+		done = "gone"
+	}
+
+	gomega.EventuallyWithOffset(2, func() (string, error) {
+		operation, found, err := lastOperation()
+		if err != nil {
+			return "", err
+		}
+		if !found {
+			return "gone", nil
+		}
+		if operation.State == "failed" {
+			return operation.State, gomega.StopTrying(fmt.Sprintf("The %s failed: %s", description, operation.Description))
+		}
+		if operationType != "" && operation.Type != operationType {
+			return operation.Type + " " + operation.State, nil
+		}
+		return operation.State, nil
+	}, config.GetScaledTimeout(config.AsyncServiceOperationTimeoutDuration()), PollingInterval).Should(gomega.Equal(done), "The %s did not complete in time", description)
+}
+
+func targetedSpaceGuid(userContext workflowhelpers.UserContext) (string, error) {
+	return findOne(userContext, "/v3/spaces", url.Values{"names": {userContext.Space}, "organization_names": {userContext.Org}}, "space "+userContext.Space)
+}
+
+func findServiceInstance(userContext workflowhelpers.UserContext, name string) (v3Resource, bool, error) {
+	spaceGuid, err := targetedSpaceGuid(userContext)
+	if err != nil {
+		return v3Resource{}, false, err
+	}
+	return findResource(userContext, "/v3/service_instances", url.Values{"names": {name}, "space_guids": {spaceGuid}})
+}
+
+func findServiceKey(userContext workflowhelpers.UserContext, instanceGuid, name string) (v3Resource, bool, error) {
+	return findResource(userContext, "/v3/service_credential_bindings", url.Values{"names": {name}, "service_instance_guids": {instanceGuid}, "type": {"key"}})
+}
+
+// findPlanOfSameOffering looks up the plan with the name among the plans of
+// the service offering the other plan belongs to.
+func findPlanOfSameOffering(userContext workflowhelpers.UserContext, planGuid, name string) (string, error) {
+	var currentPlan v3Resource
+	err := userContext.CfCurl("GET", "/v3/service_plans/"+planGuid, nil, &currentPlan)
+	if err != nil {
+		return "", err
+	}
+
+	offeringGuid := currentPlan.Relationships.ServiceOffering.Data.Guid
+	return findOne(userContext, "/v3/service_plans", url.Values{"names": {name}, "service_offering_guids": {offeringGuid}}, "plan "+name)
+}
+
+func findResource(userContext workflowhelpers.UserContext, path string, query url.Values) (v3Resource, bool, error) {
+	var response v3Resources
+	err := userContext.CfCurl("GET", path+"?"+query.Encode(), nil, &response)
+	if err != nil || len(response.Resources) == 0 {
+		return v3Resource{}, false, err
+	}
+	return response.Resources[0], true, nil
+}
+
+func findOne(userContext workflowhelpers.UserContext, path string, query url.Values, description string) (string, error) {
+	var response v3Resources
+	err := userContext.CfCurl("GET", path+"?"+query.Encode(), nil, &response)
+	if err != nil {
+		return "", err
+	}
+	if len(response.Resources) != 1 {
+		return "", fmt.Errorf("expected to find one %s, found %d", description, len(response.Resources))
+	}
+	return response.Resources[0].Guid, nil
+}
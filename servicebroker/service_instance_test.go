@@ -0,0 +1,311 @@
+package servicebroker_test
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/cloudfoundry/cf-test-helpers/v2/config"
+	starterFakes "github.com/cloudfoundry/cf-test-helpers/v2/internal/fakes"
+	. "github.com/cloudfoundry/cf-test-helpers/v2/servicebroker"
+	"github.com/cloudfoundry/cf-test-helpers/v2/workflowhelpers"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Service instances", func() {
+	const space = `'{"resources":[{"guid":"space-guid"}]}'`
+	const noResources = `'{"resources":[]}'`
+
+	var cfg config.Config
+	var cmdStarter *starterFakes.FakeCmdStarter
+	var userContext workflowhelpers.UserContext
+
+	var returns = func(outputs ...string) {
+		for len(cmdStarter.ToReturn) < len(outputs) {
+			cmdStarter.ToReturn = append(cmdStarter.ToReturn, cmdStarter.ToReturn...)
+		}
+		for i, output := range outputs {
+			cmdStarter.ToReturn[i].Output = output
+		}
+	}
+
+	var instance = func(state string) string {
+		return `'{"resources":[{"guid":"instance-guid","name":"my-instance","last_operation":` + state + `,"relationships":{"service_plan":{"data":{"guid":"plan-guid"}}}}]}'`
+	}
+
+	var body = func(call int) map[string]interface{} {
+		args := cmdStarter.CalledWith[call].Args
+		Expect(args[len(args)-2]).To(Equal("-d"))
+
+		var decoded map[string]interface{}
+		Expect(json.Unmarshal([]byte(args[len(args)-1]), &decoded)).To(Succeed())
+		return decoded
+	}
+
+	BeforeEach(func() {
+		cfg = config.Config{TimeoutScale: 1, AsyncServiceOperationTimeout: 2}
+		cmdStarter = starterFakes.NewFakeCmdStarter()
+		userContext = workflowhelpers.UserContext{
+			CommandStarter: cmdStarter,
+			Org:            "my-org",
+			Space:          "my-space",
+			Timeout:        2 * time.Second,
+		}
+
+		pollingInterval := PollingInterval
+		PollingInterval = 10 * time.Millisecond
+		DeferCleanup(func() {
+			PollingInterval = pollingInterval
+		})
+	})
+
+	Describe("CreateServiceInstance", func() {
+		It("creates the instance in the targeted space and waits for it to be provisioned", func() {
+			returns(
+				space,
+				`'{"resources":[{"guid":"plan-guid"}]}'`,
+				"",
+				space, instance(`{"type":"create","state":"in progress"}`),
+				space, instance(`{"type":"create","state":"succeeded"}`),
+			)
+
+			created := CreateServiceInstance(&cfg, userContext, "my-instance", "my-service", "my-plan", map[string]interface{}{"size": "small"})
+
+			Expect(created).To(Equal(ServiceInstance{
+				Guid:          "instance-guid",
+				Name:          "my-instance",
+				PlanGuid:      "plan-guid",
+				LastOperation: LastOperation{Type: "create", State: "succeeded"},
+			}))
+			Expect(cmdStarter.CalledWith[0].Args).To(Equal([]string{"curl", "/v3/spaces?names=my-space&organization_names=my-org"}))
+			Expect(cmdStarter.CalledWith[1].Args).To(Equal([]string{"curl", "/v3/service_plans?names=my-plan&service_offering_names=my-service"}))
+			Expect(cmdStarter.CalledWith[2].Args[:4]).To(Equal([]string{"curl", "/v3/service_instances", "-X", "POST"}))
+			Expect(body(2)).To(Equal(map[string]interface{}{
+				"type": "managed",
+				"name": "my-instance",
+				"relationships": map[string]interface{}{
+					"space":        map[string]interface{}{"data": map[string]interface{}{"guid": "space-guid"}},
+					"service_plan": map[string]interface{}{"data": map[string]interface{}{"guid": "plan-guid"}},
+				},
+				"parameters": map[string]interface{}{"size": "small"},
+			}))
+			Expect(cmdStarter.CalledWith[4].Args).To(Equal([]string{"curl", "/v3/service_instances?names=my-instance&space_guids=space-guid"}))
+			Expect(cmdStarter.TotalCallsToStart).To(Equal(7))
+		})
+
+		It("fails right away with the description of the broker when provisioning fails", func() {
+			returns(
+				space,
+				`'{"resources":[{"guid":"plan-guid"}]}'`,
+				"",
+				space, instance(`{"type":"create","state":"failed","description":"no capacity left"}`),
+			)
+
+			err := InterceptGomegaFailure(func() {
+				CreateServiceInstance(&cfg, userContext, "my-instance", "my-service", "my-plan", nil)
+			})
+
+			Expect(err).To(MatchError(ContainSubstring("The create of service instance my-instance failed: no capacity left")))
+			Expect(cmdStarter.TotalCallsToStart).To(Equal(5))
+			Expect(body(2)).NotTo(HaveKey("parameters"))
+		})
+
+		It("fails when the plan does not exist", func() {
+			returns(space, noResources)
+
+			err := InterceptGomegaFailure(func() {
+				CreateServiceInstance(&cfg, userContext, "my-instance", "my-service", "my-plan", nil)
+			})
+
+			Expect(err).To(MatchError(ContainSubstring("expected to find one plan my-plan of my-service, found 0")))
+		})
+
+		It("gives up after the scaled async service operation timeout", func() {
+			cfg.AsyncServiceOperationTimeout = 1
+			cfg.TimeoutScale = 0.002
+			outputs := []string{space, `'{"resources":[{"guid":"plan-guid"}]}'`, ""}
+			for i := 0; i < 100; i++ {
+				outputs = append(outputs, space, instance(`{"type":"create","state":"in progress"}`))
+			}
+			returns(outputs...)
+
+			start := time.Now()
+			err := InterceptGomegaFailure(func() {
+				CreateServiceInstance(&cfg, userContext, "my-instance", "my-service", "my-plan", nil)
+			})
+
+			Expect(err).To(MatchError(ContainSubstring("The create of service instance my-instance did not complete in time")))
+			Expect(time.Since(start)).To(BeNumerically("<", 2*time.Second))
+		})
+	})
+
+	Describe("UpdateServiceInstance", func() {
+		It("moves the instance to the plan of the same offering and waits for the update", func() {
+			returns(
+				space, instance(`{"type":"create","state":"succeeded"}`),
+				`'{"guid":"plan-guid","relationships":{"service_offering":{"data":{"guid":"offering-guid"}}}}'`,
+				`'{"resources":[{"guid":"other-plan-guid"}]}'`,
+				"",
+				space, instance(`{"type":"create","state":"succeeded"}`),
+				space, instance(`{"type":"update","state":"succeeded"}`),
+			)
+
+			updated := UpdateServiceInstance(&cfg, userContext, "my-instance", "other-plan", map[string]interface{}{"size": "large"})
+
+			Expect(updated.LastOperation).To(Equal(LastOperation{Type: "update", State: "succeeded"}))
+			Expect(cmdStarter.CalledWith[2].Args).To(Equal([]string{"curl", "/v3/service_plans/plan-guid"}))
+			Expect(cmdStarter.CalledWith[3].Args).To(Equal([]string{"curl", "/v3/service_plans?names=other-plan&service_offering_guids=offering-guid"}))
+			Expect(cmdStarter.CalledWith[4].Args[:4]).To(Equal([]string{"curl", "/v3/service_instances/instance-guid", "-X", "PATCH"}))
+			Expect(body(4)).To(Equal(map[string]interface{}{
+				"relationships": map[string]interface{}{
+					"service_plan": map[string]interface{}{"data": map[string]interface{}{"guid": "other-plan-guid"}},
+				},
+				"parameters": map[string]interface{}{"size": "large"},
+			}))
+			Expect(cmdStarter.TotalCallsToStart).To(Equal(9))
+		})
+
+		It("only updates the parameters without a plan", func() {
+			returns(
+				space, instance(`{"type":"create","state":"succeeded"}`),
+				"",
+				space, instance(`{"type":"update","state":"succeeded"}`),
+			)
+
+			UpdateServiceInstance(&cfg, userContext, "my-instance", "", map[string]interface{}{"size": "large"})
+
+			Expect(body(2)).To(Equal(map[string]interface{}{"parameters": map[string]interface{}{"size": "large"}}))
+		})
+	})
+
+	Describe("DeleteServiceInstance", func() {
+		It("deletes the instance and waits for it to be gone", func() {
+			returns(
+				space, instance(`{"type":"create","state":"succeeded"}`),
+				"",
+				space, instance(`{"type":"delete","state":"in progress"}`),
+				space, noResources,
+			)
+
+			DeleteServiceInstance(&cfg, userContext, "my-instance")
+
+			Expect(cmdStarter.CalledWith[2].Args).To(Equal([]string{"curl", "/v3/service_instances/instance-guid", "-X", "DELETE"}))
+			Expect(cmdStarter.TotalCallsToStart).To(Equal(7))
+		})
+
+		It("fails with the description of the broker when deprovisioning fails", func() {
+			returns(
+				space, instance(`{"type":"create","state":"succeeded"}`),
+				"",
+				space, instance(`{"type":"delete","state":"failed","description":"still in use"}`),
+			)
+
+			err := InterceptGomegaFailure(func() {
+				DeleteServiceInstance(&cfg, userContext, "my-instance")
+			})
+
+			Expect(err).To(MatchError(ContainSubstring("The delete of service instance my-instance failed: still in use")))
+		})
+
+		It("does nothing without an instance", func() {
+			returns(space, noResources)
+
+			DeleteServiceInstance(&cfg, userContext, "my-instance")
+
+			Expect(cmdStarter.TotalCallsToStart).To(Equal(2))
+		})
+	})
+
+	Describe("WaitForServiceInstance", func() {
+		It("waits for the latest operation of any type to succeed", func() {
+			returns(
+				space, instance(`{"type":"update","state":"in progress"}`),
+				space, instance(`{"type":"update","state":"succeeded"}`),
+			)
+
+			waited := WaitForServiceInstance(&cfg, userContext, "my-instance")
+
+			Expect(waited.LastOperation.Type).To(Equal("update"))
+			Expect(cmdStarter.TotalCallsToStart).To(Equal(4))
+		})
+	})
+
+	Describe("service keys", func() {
+		var key = func(state string) string {
+			return `'{"resources":[{"guid":"key-guid","name":"my-key","last_operation":` + state + `}]}'`
+		}
+
+		It("creates a key for the instance and waits for its credentials", func() {
+			returns(
+				space, instance(`{"type":"create","state":"succeeded"}`),
+				"",
+				key(`{"type":"create","state":"in progress"}`),
+				key(`{"type":"create","state":"succeeded"}`),
+			)
+
+			created := CreateServiceKey(&cfg, userContext, "my-instance", "my-key", map[string]interface{}{"role": "reader"})
+
+			Expect(created).To(Equal(ServiceKey{Guid: "key-guid", Name: "my-key", LastOperation: LastOperation{Type: "create", State: "succeeded"}}))
+			Expect(cmdStarter.CalledWith[2].Args[:4]).To(Equal([]string{"curl", "/v3/service_credential_bindings", "-X", "POST"}))
+			Expect(body(2)).To(Equal(map[string]interface{}{
+				"type": "key",
+				"name": "my-key",
+				"relationships": map[string]interface{}{
+					"service_instance": map[string]interface{}{"data": map[string]interface{}{"guid": "instance-guid"}},
+				},
+				"parameters": map[string]interface{}{"role": "reader"},
+			}))
+			Expect(cmdStarter.CalledWith[3].Args).To(Equal([]string{"curl", "/v3/service_credential_bindings?names=my-key&service_instance_guids=instance-guid&type=key"}))
+		})
+
+		It("fails with the description of the broker when creating the key fails", func() {
+			returns(
+				space, instance(`{"type":"create","state":"succeeded"}`),
+				"",
+				key(`{"type":"create","state":"failed","description":"no credentials left"}`),
+			)
+
+			err := InterceptGomegaFailure(func() {
+				CreateServiceKey(&cfg, userContext, "my-instance", "my-key", nil)
+			})
+
+			Expect(err).To(MatchError(ContainSubstring("The create of service key my-key failed: no credentials left")))
+		})
+
+		It("deletes the key and waits for it to be gone", func() {
+			returns(
+				space, instance(`{"type":"create","state":"succeeded"}`),
+				key(`{"type":"create","state":"succeeded"}`),
+				"",
+				noResources,
+			)
+
+			DeleteServiceKey(&cfg, userContext, "my-instance", "my-key")
+
+			Expect(cmdStarter.CalledWith[3].Args).To(Equal([]string{"curl", "/v3/service_credential_bindings/key-guid", "-X", "DELETE"}))
+			Expect(cmdStarter.TotalCallsToStart).To(Equal(5))
+		})
+	})
+
+	Describe("WaitForJob", func() {
+		It("waits for the job at the URL to complete", func() {
+			returns(`'{"state":"PROCESSING"}'`, `'{"state":"POLLING"}'`, `'{"state":"COMPLETE"}'`)
+
+			WaitForJob(&cfg, userContext, "https://api.example.com/v3/jobs/job-guid")
+
+			Expect(cmdStarter.CalledWith[0].Args).To(Equal([]string{"curl", "/v3/jobs/job-guid"}))
+			Expect(cmdStarter.TotalCallsToStart).To(Equal(3))
+		})
+
+		It("fails right away with the errors of a failed job", func() {
+			returns(`'{"state":"FAILED","errors":[{"detail":"Service broker failed: no capacity left"}]}'`)
+
+			err := InterceptGomegaFailure(func() {
+				WaitForJob(&cfg, userContext, "/v3/jobs/job-guid")
+			})
+
+			Expect(err).To(MatchError(ContainSubstring("Job /v3/jobs/job-guid failed: Service broker failed: no capacity left")))
+			Expect(cmdStarter.TotalCallsToStart).To(Equal(1))
+		})
+	})
+})
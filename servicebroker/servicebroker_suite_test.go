@@ -0,0 +1,13 @@
+package servicebroker_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestServicebroker(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Servicebroker Suite")
+}
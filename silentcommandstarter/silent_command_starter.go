@@ -1,6 +1,7 @@
 package silentcommandstarter
 
 import (
+	"os"
 	"os/exec"
 	"time"
 
@@ -10,14 +11,32 @@ import (
 )
 
 type CommandStarter struct {
+	env []string
 }
 
 func NewCommandStarter() *CommandStarter {
 	return &CommandStarter{}
 }
 
+// WithEnv returns a copy of the starter that adds the given KEY=value pairs to
+// the environment of its commands, on top of any it already adds.
+func (r *CommandStarter) WithEnv(env ...string) internal.Starter {
+	return &CommandStarter{
+		env: append(append([]string{}, r.env...), env...),
+	}
+}
+
+// WithoutOutput returns the starter, as its commands never write their
+// output to the GinkgoWriter.
+func (r *CommandStarter) WithoutOutput() internal.Starter {
+	return r
+}
+
 func (r *CommandStarter) Start(reporter internal.Reporter, executable string, args ...string) (*gexec.Session, error) {
 	cmd := exec.Command(executable, args...)
+	if len(r.env) > 0 {
+		cmd.Env = append(os.Environ(), r.env...)
+	}
 	reporter.Report(time.Now(), cmd)
 
 	_, err := ginkgo.GinkgoWriter.Write([]byte("SILENCING COMMAND OUTPUT"))
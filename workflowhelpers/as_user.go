@@ -12,6 +12,10 @@ type userContext interface {
 	TargetSpace()
 }
 
+// AsUser logs in as the user of the context for the actions and logs out
+// again afterwards. The process CF_HOME points at the context's CF_HOME, or
+// a temporary one, in the meantime, so the actions can run cf commands as
+// the user with cf.Cf as well as with the context's Cf method.
 func AsUser(uc userContext, timeout time.Duration, actions func()) {
 	originalCfHomeDir, currentCfHomeDir := uc.SetCfHomeDir()
 	uc.Login()
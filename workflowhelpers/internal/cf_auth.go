@@ -6,7 +6,6 @@ import (
 	"time"
 
 	"github.com/cloudfoundry/cf-test-helpers/v2/internal"
-	"github.com/onsi/gomega"
 	"github.com/onsi/gomega/gexec"
 )
 
@@ -36,7 +35,7 @@ func CfClientAuth(cmdStarter internal.Starter, reporter internal.Reporter, clien
 func executeAuthWithRetries(cmdStarter internal.Starter, reporter internal.Reporter, args []string, timeout time.Duration) error {
 	var auth *gexec.Session
 	var err error
-	var failures []string
+	var timedOut bool
 
 	for i := 0; i < CFAuthRetries; i++ {
 		auth, err = cmdStarter.Start(reporter, "cf", args...)
@@ -44,19 +43,18 @@ func executeAuthWithRetries(cmdStarter internal.Starter, reporter internal.Repor
 			return err
 		}
 
-		failures = gomega.InterceptGomegaFailures(func() {
-			auth.Wait(timeout)
-		})
-
-		if len(failures) == 0 && auth.ExitCode() == 0 {
+		// Waiting on the session directly rather than through gomega keeps
+		// concurrent logins from racing on gomega's global fail handler.
+		timedOut = !waitForExit(auth, timeout)
+		if !timedOut && auth.ExitCode() == 0 {
 			return nil
 		}
 
 		time.Sleep(1 * time.Second)
 	}
 
-	if len(failures) != 0 {
-		return fmt.Errorf("cf auth command timed out: %s", failures)
+	if timedOut {
+		return fmt.Errorf("cf auth command timed out: Timed out after %.3fs waiting for the process to exit", timeout.Seconds())
 	}
 
 	if auth.ExitCode() != 0 {
@@ -65,3 +63,13 @@ func executeAuthWithRetries(cmdStarter internal.Starter, reporter internal.Repor
 
 	return nil
 }
+
+func waitForExit(session *gexec.Session, timeout time.Duration) bool {
+	select {
+	case <-session.Exited:
+		return true
+	case <-time.After(timeout):
+		<-session.Kill().Exited
+		return false
+	}
+}
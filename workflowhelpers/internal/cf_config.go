@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// CfConfig is the part of the cf CLI's config.json needed to tell whether a
+// CF_HOME still holds a usable login.
+type CfConfig struct {
+	Target       string `json:"Target"`
+	AccessToken  string `json:"AccessToken"`
+	RefreshToken string `json:"RefreshToken"`
+}
+
+func ReadCfConfig(cfHomeDir string) (CfConfig, error) {
+	var config CfConfig
+
+	contents, err := os.ReadFile(filepath.Join(cfHomeDir, ".cf", "config.json"))
+	if err != nil {
+		return config, err
+	}
+
+	err = json.Unmarshal(contents, &config)
+	return config, err
+}
+
+// TargetsApi tells whether the config targets the given API, ignoring the
+// scheme the cf CLI adds to it.
+func (config CfConfig) TargetsApi(apiUrl string) bool {
+	return trimScheme(config.Target) == trimScheme(apiUrl)
+}
+
+// AccessTokenExpiresAt reads the expiry from the claims of the access token.
+func (config CfConfig) AccessTokenExpiresAt() (time.Time, error) {
+	return tokenExpiresAt(config.AccessToken)
+}
+
+// RefreshTokenExpiresAt reads the expiry from the claims of the refresh
+// token, which fails for opaque refresh tokens.
+func (config CfConfig) RefreshTokenExpiresAt() (time.Time, error) {
+	return tokenExpiresAt(config.RefreshToken)
+}
+
+func tokenExpiresAt(token string) (time.Time, error) {
+	token = strings.TrimSpace(token)
+	if strings.HasPrefix(strings.ToLower(token), "bearer ") {
+		token = strings.TrimSpace(token[len("bearer "):])
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, fmt.Errorf("token is not a JWT")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	err = json.Unmarshal(payload, &claims)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if claims.Exp == 0 {
+		return time.Time{}, fmt.Errorf("token has no expiry")
+	}
+	return time.Unix(claims.Exp, 0), nil
+}
+
+func trimScheme(url string) string {
+	url = strings.TrimPrefix(url, "https://")
+	url = strings.TrimPrefix(url, "http://")
+	return strings.TrimSuffix(url, "/")
+}
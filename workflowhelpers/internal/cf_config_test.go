@@ -0,0 +1,72 @@
+package internal_test
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/cloudfoundry/cf-test-helpers/v2/workflowhelpers/internal"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func fakeJWT(expiresAt time.Time) string {
+	claims := fmt.Sprintf(`{"exp":%d}`, expiresAt.Unix())
+	return "eyJhbGciOiJSUzI1NiJ9." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + ".c2lnbmF0dXJl"
+}
+
+var _ = Describe("CfConfig", func() {
+	Describe("ReadCfConfig", func() {
+		var cfHomeDir string
+
+		BeforeEach(func() {
+			cfHomeDir = GinkgoT().TempDir()
+		})
+
+		It("reads the target and tokens from config.json", func() {
+			Expect(os.MkdirAll(filepath.Join(cfHomeDir, ".cf"), 0700)).To(Succeed())
+			contents := `{"Target":"https://api.my-cf.com","AccessToken":"bearer access","RefreshToken":"refresh","Other":1}`
+			Expect(os.WriteFile(filepath.Join(cfHomeDir, ".cf", "config.json"), []byte(contents), 0600)).To(Succeed())
+
+			config, err := ReadCfConfig(cfHomeDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config).To(Equal(CfConfig{Target: "https://api.my-cf.com", AccessToken: "bearer access", RefreshToken: "refresh"}))
+		})
+
+		It("returns an error when there is no config.json", func() {
+			_, err := ReadCfConfig(cfHomeDir)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("TargetsApi", func() {
+		It("ignores the scheme and trailing slash", func() {
+			config := CfConfig{Target: "https://api.my-cf.com"}
+			Expect(config.TargetsApi("api.my-cf.com")).To(BeTrue())
+			Expect(config.TargetsApi("https://api.my-cf.com/")).To(BeTrue())
+			Expect(config.TargetsApi("api.other-cf.com")).To(BeFalse())
+		})
+	})
+
+	Describe("token expiry", func() {
+		It("reads the expiry of bearer and bare tokens", func() {
+			expiresAt := time.Unix(time.Now().Add(time.Hour).Unix(), 0)
+			config := CfConfig{AccessToken: "bearer " + fakeJWT(expiresAt), RefreshToken: fakeJWT(expiresAt)}
+
+			Expect(config.AccessTokenExpiresAt()).To(Equal(expiresAt))
+			Expect(config.RefreshTokenExpiresAt()).To(Equal(expiresAt))
+		})
+
+		It("returns an error for opaque tokens", func() {
+			config := CfConfig{AccessToken: "bearer opaque", RefreshToken: "opaque-r"}
+
+			_, err := config.AccessTokenExpiresAt()
+			Expect(err).To(MatchError("token is not a JWT"))
+			_, err = config.RefreshTokenExpiresAt()
+			Expect(err).To(MatchError("token is not a JWT"))
+		})
+	})
+})
@@ -0,0 +1,72 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/cf-test-helpers/v2/internal"
+)
+
+type v3Errors struct {
+	Errors []struct {
+		Title  string `json:"title"`
+		Detail string `json:"detail"`
+	} `json:"errors"`
+}
+
+// cfCurl makes a v3 API request through cf curl, as whoever is logged in,
+// and decodes the response. cf curl exits 0 on API errors, so the errors in
+// the response body are returned instead.
+func cfCurl(cmdStarter internal.Starter, timeout time.Duration, method, path string, body, response interface{}) error {
+	args := []string{"curl", path}
+	if method != "GET" {
+		args = append(args, "-X", method)
+	}
+	if body != nil {
+		contents, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		args = append(args, "-d", string(contents))
+	}
+
+	session := internal.Cf(cmdStarter, args...)
+	if !waitForExit(session, timeout) {
+		return fmt.Errorf("cf curl %s timed out after %s", path, timeout)
+	}
+	if session.ExitCode() != 0 {
+		return fmt.Errorf("cf curl %s exited with %d: %s", path, session.ExitCode(), strings.TrimSpace(string(session.Err.Contents())))
+	}
+
+	output := session.Out.Contents()
+
+	var apiErrors v3Errors
+	if json.Unmarshal(output, &apiErrors) == nil && len(apiErrors.Errors) > 0 {
+		return fmt.Errorf("%s %s failed: %s: %s", method, path, apiErrors.Errors[0].Title, apiErrors.Errors[0].Detail)
+	}
+
+	if response == nil {
+		return nil
+	}
+	return json.Unmarshal(output, response)
+}
+
+// CfCurl is cfCurl for the packages built on this one.
+func CfCurl(cmdStarter internal.Starter, timeout time.Duration, method, path string, body, response interface{}) error {
+	return cfCurl(cmdStarter, timeout, method, path, body, response)
+}
+
+func findGuid(cmdStarter internal.Starter, timeout time.Duration, path string, query url.Values, description string) (string, error) {
+	var response v3Resources
+	err := cfCurl(cmdStarter, timeout, "GET", path+"?"+query.Encode(), nil, &response)
+	if err != nil {
+		return "", err
+	}
+	if len(response.Resources) != 1 {
+		return "", fmt.Errorf("expected to find one %s, found %d", description, len(response.Resources))
+	}
+	return response.Resources[0].Guid, nil
+}
@@ -0,0 +1,23 @@
+package internal
+
+import (
+	"github.com/cloudfoundry/cf-test-helpers/v2/commandstarter"
+	"github.com/cloudfoundry/cf-test-helpers/v2/internal"
+)
+
+// CACertConfig is optionally implemented by suite configs whose foundation
+// uses certificates signed by a custom CA.
+type CACertConfig interface {
+	GetCACertFile() string
+}
+
+// NewCommandStarter returns a starter for cf commands that trust the CA
+// bundle configured by cfg, if any. The cf CLI reads it from SSL_CERT_FILE.
+var NewCommandStarter = func(cfg interface{}) internal.Starter {
+	caConfig, ok := cfg.(CACertConfig)
+	if ok && caConfig.GetCACertFile() != "" {
+		return commandstarter.NewCommandStarterWithEnv("SSL_CERT_FILE=" + caConfig.GetCACertFile())
+	}
+
+	return commandstarter.NewCommandStarter()
+}
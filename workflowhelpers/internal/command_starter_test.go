@@ -0,0 +1,40 @@
+package internal_test
+
+import (
+	"time"
+
+	"github.com/cloudfoundry/cf-test-helpers/v2/commandreporter"
+	"github.com/cloudfoundry/cf-test-helpers/v2/config"
+	. "github.com/cloudfoundry/cf-test-helpers/v2/workflowhelpers/internal"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gbytes"
+	. "github.com/onsi/gomega/gexec"
+)
+
+var _ = Describe("NewCommandStarter", func() {
+	var cfg config.Config
+
+	BeforeEach(func() {
+		cfg = config.Config{}
+	})
+
+	It("points SSL_CERT_FILE at the configured CA bundle", func() {
+		cfg.CACertFile = "/path/to/ca.pem"
+
+		session, err := NewCommandStarter(&cfg).Start(commandreporter.NewCommandReporter(), "bash", "-c", "echo $SSL_CERT_FILE")
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(session, time.Second).Should(Exit(0))
+		Expect(session.Out).To(Say("/path/to/ca.pem"))
+	})
+
+	It("leaves the environment alone when no CA bundle is configured", func() {
+		GinkgoT().Setenv("SSL_CERT_FILE", "")
+
+		session, err := NewCommandStarter(&cfg).Start(commandreporter.NewCommandReporter(), "bash", "-c", "echo \"[$SSL_CERT_FILE]\"")
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(session, time.Second).Should(Exit(0))
+		Expect(session.Out).To(Say(`\[\]`))
+	})
+})
@@ -1,8 +1,13 @@
 package fakes
 
+import "github.com/onsi/gomega"
+
 type FakeRemoteResource struct {
 	ShouldRemainReturns bool
 
+	// DestroyFailure makes Destroy fail with the message.
+	DestroyFailure string
+
 	createCallCount  int
 	destroyCallCount int
 }
@@ -12,6 +17,7 @@ func (resource *FakeRemoteResource) Create() {
 }
 func (resource *FakeRemoteResource) Destroy() {
 	resource.destroyCallCount += 1
+	gomega.ExpectWithOffset(1, resource.DestroyFailure).To(gomega.BeEmpty())
 }
 
 func (resource *FakeRemoteResource) ShouldRemain() bool {
@@ -0,0 +1,314 @@
+package fakes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const FakeUAAToken = "fake-uaa-token"
+
+type FakeOAuthClient struct {
+	ClientId             string   `json:"client_id"`
+	ClientSecret         string   `json:"client_secret"`
+	AuthorizedGrantTypes []string `json:"authorized_grant_types"`
+	Authorities          []string `json:"authorities"`
+	Scope                []string `json:"scope"`
+}
+
+type fakeUAAUser struct {
+	id       string
+	origin   string
+	password string
+}
+
+// FakeUAA is a local stand-in for both the Cloud Controller endpoints used to
+// discover the UAA and the UAA endpoints used to manage clients and groups.
+type FakeUAA struct {
+	Server *httptest.Server
+
+	// PublishRootLinks makes the API root link to the UAA; without it the
+	// UAA can only be discovered from /v2/info.
+	PublishRootLinks bool
+
+	// TokenExpiresIn is the lifetime in seconds the tokens are issued with.
+	TokenExpiresIn int
+
+	lock          sync.Mutex
+	clients       map[string]FakeOAuthClient
+	clientSecrets map[string]string
+	users         map[string]fakeUAAUser
+	groups        map[string]string
+	members       map[string]map[string]bool
+	nextId        int
+	tokenRequests []string
+	revocations   int
+}
+
+var filterValue = regexp.MustCompile(`(\w+) eq "([^"]*)"`)
+
+func NewFakeUAA() *FakeUAA {
+	uaa := &FakeUAA{
+		PublishRootLinks: true,
+		TokenExpiresIn:   43199,
+		clients:          map[string]FakeOAuthClient{},
+		clientSecrets:    map[string]string{},
+		users:            map[string]fakeUAAUser{},
+		groups:           map[string]string{},
+		members:          map[string]map[string]bool{},
+	}
+	uaa.Server = httptest.NewServer(http.HandlerFunc(uaa.serveHTTP))
+	return uaa
+}
+
+func (uaa *FakeUAA) URL() string {
+	return uaa.Server.URL
+}
+
+func (uaa *FakeUAA) Close() {
+	uaa.Server.Close()
+}
+
+// AddClientCredentials lets the client authenticate with the client
+// credentials grant.
+func (uaa *FakeUAA) AddClientCredentials(clientId, clientSecret string) {
+	uaa.lock.Lock()
+	defer uaa.lock.Unlock()
+	uaa.clientSecrets[clientId] = clientSecret
+}
+
+func (uaa *FakeUAA) AddUser(username, origin, password string) {
+	uaa.lock.Lock()
+	defer uaa.lock.Unlock()
+	uaa.users[username] = fakeUAAUser{id: uaa.newId("user"), origin: origin, password: password}
+}
+
+func (uaa *FakeUAA) AddGroup(displayName string) {
+	uaa.lock.Lock()
+	defer uaa.lock.Unlock()
+	id := uaa.newId("group")
+	uaa.groups[displayName] = id
+	uaa.members[id] = map[string]bool{}
+}
+
+func (uaa *FakeUAA) Client(clientId string) (FakeOAuthClient, bool) {
+	uaa.lock.Lock()
+	defer uaa.lock.Unlock()
+	client, ok := uaa.clients[clientId]
+	return client, ok
+}
+
+// GroupMembers returns the usernames of the members of the group, sorted.
+func (uaa *FakeUAA) GroupMembers(displayName string) []string {
+	uaa.lock.Lock()
+	defer uaa.lock.Unlock()
+
+	members := []string{}
+	for username, user := range uaa.users {
+		if uaa.members[uaa.groups[displayName]][user.id] {
+			members = append(members, username)
+		}
+	}
+	sort.Strings(members)
+	return members
+}
+
+// TokenRequests returns the encoded forms posted to the token endpoint.
+func (uaa *FakeUAA) TokenRequests() []string {
+	uaa.lock.Lock()
+	defer uaa.lock.Unlock()
+	return append([]string{}, uaa.tokenRequests...)
+}
+
+// RevokeTokens makes the UAA reject the tokens issued so far, as it does
+// once they expire.
+func (uaa *FakeUAA) RevokeTokens() {
+	uaa.lock.Lock()
+	defer uaa.lock.Unlock()
+	uaa.revocations++
+}
+
+func (uaa *FakeUAA) validToken() string {
+	if uaa.revocations == 0 {
+		return FakeUAAToken
+	}
+	return fmt.Sprintf("%s-%d", FakeUAAToken, uaa.revocations)
+}
+
+func (uaa *FakeUAA) newId(kind string) string {
+	uaa.nextId++
+	return fmt.Sprintf("%s-%d", kind, uaa.nextId)
+}
+
+func (uaa *FakeUAA) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	uaa.lock.Lock()
+	defer uaa.lock.Unlock()
+
+	path := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	switch {
+	case r.URL.Path == "/" && r.Method == http.MethodGet:
+		if !uaa.PublishRootLinks {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"links": map[string]interface{}{"uaa": map[string]string{"href": uaa.Server.URL}},
+		})
+	case r.URL.Path == "/v2/info" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]string{"token_endpoint": uaa.Server.URL})
+	case r.URL.Path == "/oauth/token" && r.Method == http.MethodPost:
+		uaa.token(w, r)
+	case r.Header.Get("Authorization") != "bearer "+uaa.validToken():
+		writeError(w, http.StatusUnauthorized, "unauthorized", "Full authentication is required to access this resource")
+	case r.URL.Path == "/oauth/clients" && r.Method == http.MethodPost:
+		uaa.createClient(w, r)
+	case len(path) == 3 && path[0] == "oauth" && path[1] == "clients" && r.Method == http.MethodDelete:
+		uaa.deleteClient(w, path[2])
+	case r.URL.Path == "/Users" && r.Method == http.MethodGet:
+		uaa.listUsers(w, r)
+	case r.URL.Path == "/Groups" && r.Method == http.MethodGet:
+		uaa.listGroups(w, r)
+	case len(path) == 3 && path[0] == "Groups" && path[2] == "members" && r.Method == http.MethodPost:
+		uaa.addMember(w, r, path[1])
+	case len(path) == 4 && path[0] == "Groups" && path[2] == "members" && r.Method == http.MethodDelete:
+		uaa.removeMember(w, path[1], path[3])
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (uaa *FakeUAA) token(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	uaa.tokenRequests = append(uaa.tokenRequests, r.PostForm.Encode())
+
+	clientId, clientSecret, _ := r.BasicAuth()
+
+	authenticated := false
+	switch r.PostForm.Get("grant_type") {
+	case "client_credentials":
+		secret, ok := uaa.clientSecrets[clientId]
+		authenticated = ok && secret == clientSecret
+	case "password":
+		user, ok := uaa.users[r.PostForm.Get("username")]
+		authenticated = clientId == "cf" && ok && user.password == r.PostForm.Get("password")
+	}
+
+	if !authenticated {
+		writeError(w, http.StatusUnauthorized, "unauthorized", "Bad credentials")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"access_token": uaa.validToken(), "token_type": "bearer", "expires_in": uaa.TokenExpiresIn})
+}
+
+func (uaa *FakeUAA) createClient(w http.ResponseWriter, r *http.Request) {
+	var client FakeOAuthClient
+	err := json.NewDecoder(r.Body).Decode(&client)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_client", err.Error())
+		return
+	}
+
+	if _, ok := uaa.clients[client.ClientId]; ok {
+		writeError(w, http.StatusConflict, "invalid_client", "Client already exists: "+client.ClientId)
+		return
+	}
+
+	uaa.clients[client.ClientId] = client
+	writeJSON(w, http.StatusCreated, client)
+}
+
+func (uaa *FakeUAA) deleteClient(w http.ResponseWriter, clientId string) {
+	client, ok := uaa.clients[clientId]
+	if !ok {
+		writeError(w, http.StatusNotFound, "invalid_client", "No client with requested id: "+clientId)
+		return
+	}
+
+	delete(uaa.clients, clientId)
+	writeJSON(w, http.StatusOK, client)
+}
+
+func (uaa *FakeUAA) listUsers(w http.ResponseWriter, r *http.Request) {
+	filters := parseFilter(r.URL.Query().Get("filter"))
+
+	resources := []map[string]string{}
+	user, ok := uaa.users[filters["userName"]]
+	if ok && (filters["origin"] == "" || filters["origin"] == user.origin) {
+		resources = append(resources, map[string]string{"id": user.id, "userName": filters["userName"]})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"resources": resources})
+}
+
+func (uaa *FakeUAA) listGroups(w http.ResponseWriter, r *http.Request) {
+	filters := parseFilter(r.URL.Query().Get("filter"))
+
+	resources := []map[string]string{}
+	id, ok := uaa.groups[filters["displayName"]]
+	if ok {
+		resources = append(resources, map[string]string{"id": id, "displayName": filters["displayName"]})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"resources": resources})
+}
+
+func (uaa *FakeUAA) addMember(w http.ResponseWriter, r *http.Request, groupId string) {
+	members, ok := uaa.members[groupId]
+	if !ok {
+		writeError(w, http.StatusNotFound, "scim_resource_not_found", "Group "+groupId+" does not exist")
+		return
+	}
+
+	var member struct {
+		Value string `json:"value"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&member)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_scim_resource", err.Error())
+		return
+	}
+
+	if members[member.Value] {
+		writeError(w, http.StatusConflict, "member_already_exists", "Member "+member.Value+" already exists in group "+groupId)
+		return
+	}
+
+	members[member.Value] = true
+	writeJSON(w, http.StatusCreated, member)
+}
+
+func (uaa *FakeUAA) removeMember(w http.ResponseWriter, groupId, memberId string) {
+	if !uaa.members[groupId][memberId] {
+		writeError(w, http.StatusNotFound, "scim_resource_not_found", "Member "+memberId+" does not exist in group "+groupId)
+		return
+	}
+
+	delete(uaa.members[groupId], memberId)
+	writeJSON(w, http.StatusOK, map[string]string{"value": memberId})
+}
+
+func parseFilter(filter string) map[string]string {
+	values := map[string]string{}
+	for _, match := range filterValue.FindAllStringSubmatch(filter, -1) {
+		values[match[1]] = match[2]
+	}
+	return values
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, error, description string) {
+	writeJSON(w, status, map[string]string{"error": error, "error_description": description})
+}
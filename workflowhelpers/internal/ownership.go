@@ -0,0 +1,153 @@
+package internal
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+)
+
+// Ownership labels identify the suite run that created a resource, so that
+// resources can be found by label selector rather than by name.
+const (
+	SuiteLabel     = "cf-test-helpers.cloudfoundry.org/suite"
+	NodeLabel      = "cf-test-helpers.cloudfoundry.org/node"
+	RunIDLabel     = "cf-test-helpers.cloudfoundry.org/run-id"
+	CreatedAtLabel = "cf-test-helpers.cloudfoundry.org/created-at"
+	GitSHALabel    = "cf-test-helpers.cloudfoundry.org/git-sha"
+
+	// Quotas have no metadata in the v3 API, so the org or space they are
+	// applied to names them in an annotation instead.
+	QuotaAnnotation      = "cf-test-helpers.cloudfoundry.org/quota"
+	SpaceQuotaAnnotation = "cf-test-helpers.cloudfoundry.org/space-quota"
+)
+
+// RunIDEnvVar sets the run ID, for example to share one between the
+// parallel nodes of a suite or to match the ID of a CI build.
+const RunIDEnvVar = "CF_TEST_RUN_ID"
+
+const createdAtFormat = "20060102T150405Z"
+
+type Ownership struct {
+	Suite     string
+	Node      int
+	RunID     string
+	CreatedAt time.Time
+	GitSHA    string
+}
+
+// NewOwnership describes the current run of the suite. The git SHA comes from
+// $GIT_COMMIT or $GITHUB_SHA, or else from the git checkout the suite runs in,
+// and is left out when none of them has one.
+func NewOwnership(suite string) Ownership {
+	runID := os.Getenv(RunIDEnvVar)
+	if runID == "" {
+		runID = randomRunID()
+	}
+
+	return Ownership{
+		Suite:     suite,
+		Node:      ginkgo.GinkgoParallelProcess(),
+		RunID:     runID,
+		CreatedAt: time.Now().UTC(),
+		GitSHA:    gitSHA(),
+	}
+}
+
+// Labels returns the ownership as v3 metadata labels, with each value made
+// valid as a label value.
+func (ownership Ownership) Labels() map[string]string {
+	labels := map[string]string{
+		SuiteLabel:     labelValue(ownership.Suite),
+		NodeLabel:      strconv.Itoa(ownership.Node),
+		RunIDLabel:     labelValue(ownership.RunID),
+		CreatedAtLabel: ownership.CreatedAt.UTC().Format(createdAtFormat),
+		GitSHALabel:    labelValue(ownership.GitSHA),
+	}
+	for key, value := range labels {
+		if value == "" {
+			delete(labels, key)
+		}
+	}
+	return labels
+}
+
+// LabelSelector selects the resources created by this run, on any node.
+func (ownership Ownership) LabelSelector() string {
+	return RunIDLabel + "=" + labelValue(ownership.RunID)
+}
+
+var invalidLabelCharacters = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// labelValue replaces the characters label values cannot contain and trims
+// the value to the 63 characters they are limited to.
+func labelValue(value string) string {
+	value = invalidLabelCharacters.ReplaceAllString(value, "-")
+	if len(value) > 63 {
+		value = value[:63]
+	}
+	return strings.Trim(value, "_.-")
+}
+
+func mergeLabels(ownershipLabels, labels map[string]string) map[string]string {
+	if len(ownershipLabels) == 0 {
+		return labels
+	}
+
+	merged := make(map[string]string, len(ownershipLabels)+len(labels))
+	for key, value := range ownershipLabels {
+		merged[key] = value
+	}
+	for key, value := range labels {
+		merged[key] = value
+	}
+	return merged
+}
+
+func randomRunID() string {
+	b := make([]byte, 8)
+	_, err := rand.Read(b)
+	if err != nil {
+		panic(err)
+	}
+	return fmt.Sprintf("%x", b)
+}
+
+func gitSHA() string {
+	for _, name := range []string{"GIT_COMMIT", "GITHUB_SHA"} {
+		if sha := os.Getenv(name); sha != "" {
+			return sha
+		}
+	}
+
+	checkoutSHAOnce.Do(func() {
+		checkoutSHA = gitCheckoutSHA()
+	})
+	return checkoutSHA
+}
+
+// The checkout does not change while the suite runs, so git is only asked
+// once for its commit.
+var (
+	checkoutSHAOnce sync.Once
+	checkoutSHA     string
+)
+
+func gitCheckoutSHA() string {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, "git", "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
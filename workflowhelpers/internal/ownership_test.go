@@ -0,0 +1,75 @@
+package internal_test
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	. "github.com/cloudfoundry/cf-test-helpers/v2/workflowhelpers/internal"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Ownership", func() {
+	Describe("NewOwnership", func() {
+		It("describes the current run", func() {
+			ownership := NewOwnership("CATS")
+			Expect(ownership.Suite).To(Equal("CATS"))
+			Expect(ownership.Node).To(Equal(GinkgoParallelProcess()))
+			Expect(ownership.RunID).To(MatchRegexp("^[0-9a-f]{16}$"))
+			Expect(ownership.CreatedAt).To(BeTemporally("~", time.Now(), time.Minute))
+		})
+
+		It("gives every run a new ID", func() {
+			Expect(NewOwnership("CATS").RunID).NotTo(Equal(NewOwnership("CATS").RunID))
+		})
+
+		Context("when the run ID and git SHA are set in the environment", func() {
+			BeforeEach(func() {
+				for name, value := range map[string]string{RunIDEnvVar: "build-42", "GIT_COMMIT": "0123abcd"} {
+					original, ok := os.LookupEnv(name)
+					Expect(os.Setenv(name, value)).To(Succeed())
+					DeferCleanup(func() {
+						if ok {
+							os.Setenv(name, original) // nolint:errcheck
+						} else {
+							os.Unsetenv(name) // nolint:errcheck
+						}
+					})
+				}
+			})
+
+			It("uses them", func() {
+				ownership := NewOwnership("CATS")
+				Expect(ownership.RunID).To(Equal("build-42"))
+				Expect(ownership.GitSHA).To(Equal("0123abcd"))
+			})
+		})
+	})
+
+	Describe("Labels", func() {
+		It("returns valid label values", func() {
+			ownership := Ownership{
+				Suite:     "my suite/" + strings.Repeat("x", 70),
+				Node:      3,
+				RunID:     "run-1",
+				CreatedAt: time.Date(2024, 5, 1, 12, 30, 0, 0, time.FixedZone("CEST", 2*60*60)),
+				GitSHA:    "0123abcd",
+			}
+
+			Expect(ownership.Labels()).To(Equal(map[string]string{
+				SuiteLabel:     "my-suite-" + strings.Repeat("x", 54),
+				NodeLabel:      "3",
+				RunIDLabel:     "run-1",
+				CreatedAtLabel: "20240501T103000Z",
+				GitSHALabel:    "0123abcd",
+			}))
+			Expect(ownership.LabelSelector()).To(Equal("cf-test-helpers.cloudfoundry.org/run-id=run-1"))
+		})
+
+		It("leaves out the git SHA when there is none", func() {
+			ownership := Ownership{Suite: "CATS", Node: 1, RunID: "run-1", CreatedAt: time.Now()}
+			Expect(ownership.Labels()).NotTo(HaveKey(GitSHALabel))
+		})
+	})
+})
@@ -0,0 +1,211 @@
+package internal
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/cloudfoundry/cf-test-helpers/v2/internal"
+)
+
+// QuotaLimits mirrors the limits of the v3 organization and space quota
+// resources. A nil limit is unlimited.
+type QuotaLimits struct {
+	Apps     QuotaAppLimits     `json:"apps"`
+	Services QuotaServiceLimits `json:"services"`
+	Routes   QuotaRouteLimits   `json:"routes"`
+}
+
+type QuotaAppLimits struct {
+	TotalMemoryInMB              *int `json:"total_memory_in_mb"`
+	PerProcessMemoryInMB         *int `json:"per_process_memory_in_mb"`
+	TotalInstances               *int `json:"total_instances"`
+	PerAppTasks                  *int `json:"per_app_tasks"`
+	LogRateLimitInBytesPerSecond *int `json:"log_rate_limit_in_bytes_per_second"`
+}
+
+type QuotaServiceLimits struct {
+	PaidServicesAllowed   bool `json:"paid_services_allowed"`
+	TotalServiceInstances *int `json:"total_service_instances"`
+	TotalServiceKeys      *int `json:"total_service_keys"`
+}
+
+type QuotaRouteLimits struct {
+	TotalRoutes        *int `json:"total_routes"`
+	TotalReservedPorts *int `json:"total_reserved_ports"`
+}
+
+// QuotaBuilder declares an org or space quota. Its methods return an updated
+// copy, so a builder can be shared as the base of several quotas. Limits
+// that are never set are unlimited, and paid service plans are not allowed.
+type QuotaBuilder struct {
+	name   string
+	limits QuotaLimits
+	err    error
+}
+
+func NewQuotaBuilder(name string) QuotaBuilder {
+	return QuotaBuilder{name: name}
+}
+
+// DefaultOrgQuota declares the org quota TestSpace creates with cf
+// create-quota, limited to the given total memory.
+func DefaultOrgQuota(name, totalMemoryLimit string) QuotaBuilder {
+	return NewQuotaBuilder(name).
+		TotalMemory(totalMemoryLimit).
+		Routes(1000).
+		ServiceInstances(100).
+		ReservedRoutePorts(20).
+		PaidServicePlans(true)
+}
+
+func (builder QuotaBuilder) Name() string {
+	return builder.name
+}
+
+// Limits returns the declared limits, or the first error in declaring them.
+func (builder QuotaBuilder) Limits() (QuotaLimits, error) {
+	return builder.limits, builder.err
+}
+
+// TotalMemory takes a cf CLI memory limit such as "10G", or "-1" for
+// unlimited.
+func (builder QuotaBuilder) TotalMemory(limit string) QuotaBuilder {
+	builder.limits.Apps.TotalMemoryInMB = builder.memory(limit)
+	return builder
+}
+
+func (builder QuotaBuilder) InstanceMemory(limit string) QuotaBuilder {
+	builder.limits.Apps.PerProcessMemoryInMB = builder.memory(limit)
+	return builder
+}
+
+func (builder QuotaBuilder) AppInstances(limit int) QuotaBuilder {
+	builder.limits.Apps.TotalInstances = &limit
+	return builder
+}
+
+func (builder QuotaBuilder) PerAppTasks(limit int) QuotaBuilder {
+	builder.limits.Apps.PerAppTasks = &limit
+	return builder
+}
+
+func (builder QuotaBuilder) LogRateLimit(bytesPerSecond int) QuotaBuilder {
+	builder.limits.Apps.LogRateLimitInBytesPerSecond = &bytesPerSecond
+	return builder
+}
+
+func (builder QuotaBuilder) ServiceInstances(limit int) QuotaBuilder {
+	builder.limits.Services.TotalServiceInstances = &limit
+	return builder
+}
+
+func (builder QuotaBuilder) ServiceKeys(limit int) QuotaBuilder {
+	builder.limits.Services.TotalServiceKeys = &limit
+	return builder
+}
+
+func (builder QuotaBuilder) PaidServicePlans(allowed bool) QuotaBuilder {
+	builder.limits.Services.PaidServicesAllowed = allowed
+	return builder
+}
+
+func (builder QuotaBuilder) Routes(limit int) QuotaBuilder {
+	builder.limits.Routes.TotalRoutes = &limit
+	return builder
+}
+
+func (builder QuotaBuilder) ReservedRoutePorts(limit int) QuotaBuilder {
+	builder.limits.Routes.TotalReservedPorts = &limit
+	return builder
+}
+
+func (builder *QuotaBuilder) memory(limit string) *int {
+	memory, err := memoryInMB(limit)
+	if err != nil && builder.err == nil {
+		builder.err = err
+	}
+	return memory
+}
+
+type quotaRequest struct {
+	Name string `json:"name"`
+	QuotaLimits
+	Relationships map[string]interface{} `json:"relationships,omitempty"`
+}
+
+type quotaResource struct {
+	Guid string `json:"guid"`
+	QuotaLimits
+}
+
+// CreateOrgQuota creates the quota through the v3 API and checks that it
+// reads back with the declared limits.
+func CreateOrgQuota(cmdStarter internal.Starter, timeout time.Duration, builder QuotaBuilder) (string, error) {
+	return createQuota(cmdStarter, timeout, "/v3/organization_quotas", builder, nil)
+}
+
+// CreateSpaceQuota creates the quota in the org, applies it to the given
+// spaces and checks that it reads back with the declared limits.
+func CreateSpaceQuota(cmdStarter internal.Starter, timeout time.Duration, builder QuotaBuilder, orgGuid string, spaceGuids ...string) (string, error) {
+	spaces := make([]relationship, 0, len(spaceGuids))
+	for _, spaceGuid := range spaceGuids {
+		spaces = append(spaces, relationship{Guid: spaceGuid})
+	}
+
+	relationships := map[string]interface{}{
+		"organization": map[string]relationship{"data": {Guid: orgGuid}},
+	}
+	if len(spaces) > 0 {
+		relationships["spaces"] = map[string][]relationship{"data": spaces}
+	}
+
+	return createQuota(cmdStarter, timeout, "/v3/space_quotas", builder, relationships)
+}
+
+// ApplyOrgQuota applies the org quota to the org.
+func ApplyOrgQuota(cmdStarter internal.Starter, timeout time.Duration, quotaGuid, orgGuid string) error {
+	body := map[string][]relationship{"data": {{Guid: orgGuid}}}
+	return cfCurl(cmdStarter, timeout, "POST", "/v3/organization_quotas/"+quotaGuid+"/relationships/organizations", body, nil)
+}
+
+func createQuota(cmdStarter internal.Starter, timeout time.Duration, path string, builder QuotaBuilder, relationships map[string]interface{}) (string, error) {
+	limits, err := builder.Limits()
+	if err != nil {
+		return "", fmt.Errorf("invalid quota %s: %s", builder.Name(), err)
+	}
+
+	var created quotaResource
+	err = cfCurl(cmdStarter, timeout, "POST", path, quotaRequest{Name: builder.Name(), QuotaLimits: limits, Relationships: relationships}, &created)
+	if err != nil {
+		return "", err
+	}
+
+	var readBack quotaResource
+	err = cfCurl(cmdStarter, timeout, "GET", path+"/"+created.Guid, nil, &readBack)
+	if err != nil {
+		return created.Guid, err
+	}
+
+	if !reflect.DeepEqual(readBack.QuotaLimits, limits) {
+		return created.Guid, fmt.Errorf("quota %s was created with limits %s instead of %s", builder.Name(), describeLimits(readBack.QuotaLimits), describeLimits(limits))
+	}
+
+	return created.Guid, nil
+}
+
+func describeLimits(limits QuotaLimits) string {
+	limit := func(value *int) string {
+		if value == nil {
+			return "unlimited"
+		}
+		return fmt.Sprintf("%d", *value)
+	}
+
+	return fmt.Sprintf("{memory: %s MB, instance memory: %s MB, instances: %s, tasks per app: %s, log rate: %s B/s, "+
+		"paid plans: %t, service instances: %s, service keys: %s, routes: %s, reserved ports: %s}",
+		limit(limits.Apps.TotalMemoryInMB), limit(limits.Apps.PerProcessMemoryInMB), limit(limits.Apps.TotalInstances),
+		limit(limits.Apps.PerAppTasks), limit(limits.Apps.LogRateLimitInBytesPerSecond),
+		limits.Services.PaidServicesAllowed, limit(limits.Services.TotalServiceInstances), limit(limits.Services.TotalServiceKeys),
+		limit(limits.Routes.TotalRoutes), limit(limits.Routes.TotalReservedPorts))
+}
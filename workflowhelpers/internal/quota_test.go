@@ -0,0 +1,106 @@
+package internal_test
+
+import (
+	"time"
+
+	"github.com/cloudfoundry/cf-test-helpers/v2/internal/fakes"
+	. "github.com/cloudfoundry/cf-test-helpers/v2/workflowhelpers/internal"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("QuotaBuilder", func() {
+	var limit = func(value int) *int {
+		return &value
+	}
+
+	It("leaves limits that are never set unlimited", func() {
+		limits, err := NewQuotaBuilder("my-quota").Limits()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(limits).To(Equal(QuotaLimits{}))
+	})
+
+	It("declares every limit", func() {
+		builder := NewQuotaBuilder("my-quota").
+			TotalMemory("2G").
+			InstanceMemory("512M").
+			AppInstances(10).
+			PerAppTasks(3).
+			LogRateLimit(1024).
+			ServiceInstances(5).
+			ServiceKeys(2).
+			PaidServicePlans(true).
+			Routes(20).
+			ReservedRoutePorts(1)
+
+		limits, err := builder.Limits()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(builder.Name()).To(Equal("my-quota"))
+		Expect(limits).To(Equal(QuotaLimits{
+			Apps: QuotaAppLimits{
+				TotalMemoryInMB:              limit(2048),
+				PerProcessMemoryInMB:         limit(512),
+				TotalInstances:               limit(10),
+				PerAppTasks:                  limit(3),
+				LogRateLimitInBytesPerSecond: limit(1024),
+			},
+			Services: QuotaServiceLimits{
+				PaidServicesAllowed:   true,
+				TotalServiceInstances: limit(5),
+				TotalServiceKeys:      limit(2),
+			},
+			Routes: QuotaRouteLimits{
+				TotalRoutes:        limit(20),
+				TotalReservedPorts: limit(1),
+			},
+		}))
+	})
+
+	It("returns copies, so a builder can be the base of several quotas", func() {
+		base := DefaultOrgQuota("base", "10G")
+		runaway := base.TotalMemory("-1")
+
+		baseLimits, _ := base.Limits()
+		runawayLimits, _ := runaway.Limits()
+		Expect(*baseLimits.Apps.TotalMemoryInMB).To(Equal(10240))
+		Expect(runawayLimits.Apps.TotalMemoryInMB).To(BeNil())
+		Expect(*runawayLimits.Routes.TotalRoutes).To(Equal(1000))
+	})
+
+	It("returns the first invalid memory limit", func() {
+		_, err := NewQuotaBuilder("my-quota").TotalMemory("10 GB").InstanceMemory("1X").Limits()
+		Expect(err).To(MatchError(`invalid memory limit "10 GB"`))
+	})
+
+	Describe("CreateOrgQuota", func() {
+		var fakeStarter *fakes.FakeCmdStarter
+
+		BeforeEach(func() {
+			fakeStarter = fakes.NewFakeCmdStarter()
+			fakeStarter.ToReturn[0].Output = `'{"guid":"quota-guid"}'`
+			fakeStarter.ToReturn[1].Output = `'{"guid":"quota-guid","apps":{"per_app_tasks":3,"total_memory_in_mb":null}}'`
+		})
+
+		It("creates the quota and reads it back", func() {
+			guid, err := CreateOrgQuota(fakeStarter, time.Second, NewQuotaBuilder("my-quota").PerAppTasks(3))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(guid).To(Equal("quota-guid"))
+
+			Expect(fakeStarter.CalledWith[0].Args[:4]).To(Equal([]string{"curl", "/v3/organization_quotas", "-X", "POST"}))
+			Expect(fakeStarter.CalledWith[0].Args[5]).To(ContainSubstring(`"per_app_tasks":3`))
+			Expect(fakeStarter.CalledWith[1].Args).To(Equal([]string{"curl", "/v3/organization_quotas/quota-guid"}))
+		})
+
+		It("fails when the quota reads back with other limits", func() {
+			_, err := CreateOrgQuota(fakeStarter, time.Second, NewQuotaBuilder("my-quota").PerAppTasks(5))
+			Expect(err).To(MatchError(ContainSubstring("quota my-quota was created with limits {memory: unlimited MB, instance memory: unlimited MB, instances: unlimited, tasks per app: 3,")))
+			Expect(err).To(MatchError(ContainSubstring("instead of {memory: unlimited MB, instance memory: unlimited MB, instances: unlimited, tasks per app: 5,")))
+		})
+
+		It("does not create invalid quotas", func() {
+			_, err := CreateOrgQuota(fakeStarter, time.Second, NewQuotaBuilder("my-quota").TotalMemory("lots"))
+			Expect(err).To(MatchError(`invalid quota my-quota: memory limit "lots" must end in M, G or T`))
+			Expect(fakeStarter.CalledWith).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,67 @@
+package internal
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/cloudfoundry/cf-test-helpers/v2/internal"
+)
+
+var roleTypes = map[string]string{
+	"OrgManager":     "organization_manager",
+	"BillingManager": "organization_billing_manager",
+	"OrgAuditor":     "organization_auditor",
+	"SpaceManager":   "space_manager",
+	"SpaceDeveloper": "space_developer",
+	"SpaceAuditor":   "space_auditor",
+	"SpaceSupporter": "space_supporter",
+}
+
+type v3Resources struct {
+	Resources []struct {
+		Guid string `json:"guid"`
+	} `json:"resources"`
+	Included struct {
+		Users []struct {
+			Username string `json:"username"`
+		} `json:"users"`
+	} `json:"included"`
+}
+
+// HasSpaceRole asks the v3 API whether the user holds the role, named as in
+// cf set-space-role, in the given space.
+func HasSpaceRole(cmdStarter internal.Starter, timeout time.Duration, username, orgName, spaceName, role string) (bool, error) {
+	roleType, ok := roleTypes[role]
+	if !ok {
+		return false, fmt.Errorf("unknown role %s", role)
+	}
+
+	orgGuid, err := findGuid(cmdStarter, timeout, "/v3/organizations", url.Values{"names": {orgName}}, "org "+orgName)
+	if err != nil {
+		return false, err
+	}
+
+	spaceGuid, err := findGuid(cmdStarter, timeout, "/v3/spaces", url.Values{"names": {spaceName}, "organization_guids": {orgGuid}}, "space "+spaceName)
+	if err != nil {
+		return false, err
+	}
+
+	var roles v3Resources
+	err = cfCurl(cmdStarter, timeout, "GET", "/v3/roles?"+url.Values{
+		"types":       {roleType},
+		"space_guids": {spaceGuid},
+		"include":     {"user"},
+		"per_page":    {"5000"},
+	}.Encode(), nil, &roles)
+	if err != nil {
+		return false, err
+	}
+
+	for _, user := range roles.Included.Users {
+		if user.Username == username {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,57 @@
+package internal_test
+
+import (
+	"time"
+
+	"github.com/cloudfoundry/cf-test-helpers/v2/internal/fakes"
+	. "github.com/cloudfoundry/cf-test-helpers/v2/workflowhelpers/internal"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HasSpaceRole", func() {
+	var fakeStarter *fakes.FakeCmdStarter
+
+	BeforeEach(func() {
+		fakeStarter = fakes.NewFakeCmdStarter()
+		fakeStarter.ToReturn[0].Output = `'{"resources":[{"guid":"org-guid"}]}'`
+		fakeStarter.ToReturn[1].Output = `'{"resources":[{"guid":"space-guid"}]}'`
+		fakeStarter.ToReturn[2].Output = `'{"resources":[{"guid":"role-guid"}],"included":{"users":[{"username":"other-user"},{"username":"my-user"}]}}'`
+	})
+
+	It("finds the user among the holders of the role", func() {
+		held, err := HasSpaceRole(fakeStarter, time.Second, "my-user", "my org", "my-space", "SpaceManager")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(held).To(BeTrue())
+
+		Expect(fakeStarter.CalledWith[0].Args).To(Equal([]string{"curl", "/v3/organizations?names=my+org"}))
+		Expect(fakeStarter.CalledWith[2].Args).To(Equal([]string{"curl", "/v3/roles?include=user&per_page=5000&space_guids=space-guid&types=space_manager"}))
+	})
+
+	It("returns false when the user does not hold the role", func() {
+		held, err := HasSpaceRole(fakeStarter, time.Second, "another-user", "my-org", "my-space", "SpaceManager")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(held).To(BeFalse())
+	})
+
+	It("fails for unknown roles", func() {
+		_, err := HasSpaceRole(fakeStarter, time.Second, "my-user", "my-org", "my-space", "SpaceJanitor")
+		Expect(err).To(MatchError("unknown role SpaceJanitor"))
+		Expect(fakeStarter.CalledWith).To(BeEmpty())
+	})
+
+	It("fails when the org cannot be found", func() {
+		fakeStarter.ToReturn[0].Output = `'{"resources":[]}'`
+
+		_, err := HasSpaceRole(fakeStarter, time.Second, "my-user", "my-org", "my-space", "SpaceManager")
+		Expect(err).To(MatchError("expected to find one org my-org, found 0"))
+	})
+
+	It("fails when cf curl fails", func() {
+		fakeStarter.ToReturn[0].ExitCode = 1
+		fakeStarter.ToReturn[0].Stderr = "boom"
+
+		_, err := HasSpaceRole(fakeStarter, time.Second, "my-user", "my-org", "my-space", "SpaceManager")
+		Expect(err).To(MatchError("cf curl /v3/organizations?names=my-org exited with 1: boom"))
+	})
+})
@@ -1,13 +1,13 @@
 package internal
 
 import (
+	"net/url"
 	"time"
 
 	"github.com/cloudfoundry/cf-test-helpers/v2/generator"
 	"github.com/onsi/gomega"
 	"github.com/onsi/gomega/gexec"
 
-	"github.com/cloudfoundry/cf-test-helpers/v2/commandstarter"
 	"github.com/cloudfoundry/cf-test-helpers/v2/internal"
 )
 
@@ -26,6 +26,14 @@ type TestSpace struct {
 	QuotaDefinitionReservedRoutePorts    string
 	CommandStarter                       internal.Starter
 	Timeout                              time.Duration
+	Options                              SpaceOptions
+	TeardownOptions                      TeardownOptions
+
+	// OwnershipLabels are put on the org and space when Create creates them.
+	OwnershipLabels map[string]string
+
+	spaceQuotaGuid       string
+	originalFeatureFlags map[string]bool
 }
 
 type SpaceAndOrgConfig interface {
@@ -61,7 +69,7 @@ func NewRegularTestSpace(cfg spaceConfig, quotaLimit string) *TestSpace {
 		cfg.GetUseExistingOrganization(),
 		cfg.GetUseExistingSpace(),
 		cfg.GetScaledTimeout(1*time.Minute),
-		commandstarter.NewCommandStarter(),
+		NewCommandStarter(cfg),
 	)
 }
 
@@ -86,6 +94,34 @@ func NewBaseTestSpace(spaceName, organizationName, quotaDefinitionName, quotaDef
 }
 
 func (ts *TestSpace) Create() {
+	ts.setFeatureFlags()
+	ts.createOrganization()
+
+	if !ts.isExistingSpace {
+		createSpace := internal.Cf(ts.CommandStarter, "create-space", "-o", ts.organizationName, ts.spaceName)
+		gomega.EventuallyWithOffset(1, createSpace, ts.Timeout).Should(gexec.Exit(0), "Failed to create space")
+
+		ts.applySpaceOptions()
+	}
+}
+
+// CreateOrganization only creates the quota and org of Create, for orgs
+// whose spaces are created by other TestSpaces. Destroy deletes them again.
+func (ts *TestSpace) CreateOrganization() {
+	ts.createOrganization()
+}
+
+func (ts *TestSpace) createOrganization() {
+	if ts.isExistingOrganization {
+		return
+	}
+
+	if ts.Options.OrgQuota != nil {
+		ts.createOrgWithQuota()
+		ts.applyOrgOptions()
+		return
+	}
+
 	args := []string{
 		"create-quota",
 		ts.QuotaDefinitionName,
@@ -98,36 +134,64 @@ func (ts *TestSpace) Create() {
 		ts.QuotaDefinitionAllowPaidServicesFlag,
 	}
 
-	if !ts.isExistingOrganization {
-		createQuota := internal.Cf(ts.CommandStarter, args...)
-		gomega.EventuallyWithOffset(1, createQuota, ts.Timeout).Should(gexec.Exit(0), "Failed to create quota")
+	createQuota := internal.Cf(ts.CommandStarter, args...)
+	gomega.EventuallyWithOffset(2, createQuota, ts.Timeout).Should(gexec.Exit(0), "Failed to create quota")
 
-		createOrg := internal.Cf(ts.CommandStarter, "create-org", ts.organizationName)
-		gomega.EventuallyWithOffset(1, createOrg, ts.Timeout).Should(gexec.Exit(0), "Failed to create org")
+	createOrg := internal.Cf(ts.CommandStarter, "create-org", ts.organizationName)
+	gomega.EventuallyWithOffset(2, createOrg, ts.Timeout).Should(gexec.Exit(0), "Failed to create org")
 
-		setQuota := internal.Cf(ts.CommandStarter, "set-quota", ts.organizationName, ts.QuotaDefinitionName)
-		gomega.EventuallyWithOffset(1, setQuota, ts.Timeout).Should(gexec.Exit(0), "Failed to set org quota")
-	}
+	setQuota := internal.Cf(ts.CommandStarter, "set-quota", ts.organizationName, ts.QuotaDefinitionName)
+	gomega.EventuallyWithOffset(2, setQuota, ts.Timeout).Should(gexec.Exit(0), "Failed to set org quota")
+
+	ts.applyOrgOptions()
+}
 
+// Destroy deletes what Create created and restores the feature flags,
+// attempting every step before failing.
+func (ts *TestSpace) Destroy() {
+	teardown := NewTeardown(ts.TeardownOptions)
+	ts.RegisterCleanup(teardown)
+	gomega.ExpectWithOffset(1, teardown.Run()).NotTo(gomega.HaveOccurred())
+}
+
+// RegisterCleanup registers the steps of Destroy with the teardown.
+func (ts *TestSpace) RegisterCleanup(teardown *Teardown) {
 	if !ts.isExistingSpace {
-		createSpace := internal.Cf(ts.CommandStarter, "create-space", "-o", ts.organizationName, ts.spaceName)
-		gomega.EventuallyWithOffset(1, createSpace, ts.Timeout).Should(gexec.Exit(0), "Failed to create space")
+		if ts.isExistingOrganization {
+			teardown.Register("delete space quota", ts.deleteSpaceQuota)
+			teardown.RegisterCf("delete space "+ts.spaceName, ts.CommandStarter, ts.Timeout, "Failed to delete space", "delete-space", "-f", "-o", ts.organizationName, ts.spaceName)
+		} else {
+			teardown.RegisterCf("delete quota "+ts.QuotaDefinitionName, ts.CommandStarter, ts.Timeout, "Failed to delete quota", "delete-quota", "-f", ts.QuotaDefinitionName)
+			teardown.RegisterCf("delete org "+ts.organizationName, ts.CommandStarter, ts.Timeout, "Failed to delete org", "delete-org", "-f", ts.organizationName)
+		}
 	}
+
+	// Registered last to run first, as the flags do not depend on the org.
+	teardown.Register("restore feature flags", ts.restoreFeatureFlags)
 }
 
-func (ts *TestSpace) Destroy() {
-	if ts.isExistingSpace {
-		return
-	} else if ts.isExistingOrganization {
-		deleteSpace := internal.Cf(ts.CommandStarter, "delete-space", "-f", "-o", ts.organizationName, ts.spaceName)
-		gomega.EventuallyWithOffset(1, deleteSpace, ts.Timeout).Should(gexec.Exit(0), "Failed to delete space")
-	} else {
-		deleteOrg := internal.Cf(ts.CommandStarter, "delete-org", "-f", ts.organizationName)
-		gomega.EventuallyWithOffset(1, deleteOrg, ts.Timeout).Should(gexec.Exit(0), "Failed to delete org")
-
-		deleteQuota := internal.Cf(ts.CommandStarter, "delete-quota", "-f", ts.QuotaDefinitionName)
-		gomega.EventuallyWithOffset(1, deleteQuota, ts.Timeout).Should(gexec.Exit(0), "Failed to delete quota")
+// IsExistingOrganization and IsExistingSpace tell whether the org and space
+// were there before Create, and are left in place by Destroy.
+func (ts *TestSpace) IsExistingOrganization() bool {
+	return ts.isExistingOrganization
+}
+
+func (ts *TestSpace) IsExistingSpace() bool {
+	return ts.isExistingSpace
+}
+
+// Guids looks up the GUIDs of the org and space, as whoever is logged in.
+func (ts *TestSpace) Guids() (string, string, error) {
+	orgGuid, err := findGuid(ts.CommandStarter, ts.Timeout, "/v3/organizations", url.Values{"names": {ts.organizationName}}, "org "+ts.organizationName)
+	if err != nil {
+		return "", "", err
+	}
+
+	spaceGuid, err := findGuid(ts.CommandStarter, ts.Timeout, "/v3/spaces", url.Values{"names": {ts.spaceName}, "organization_guids": {orgGuid}}, "space "+ts.spaceName)
+	if err != nil {
+		return orgGuid, "", err
 	}
+	return orgGuid, spaceGuid, nil
 }
 
 func (ts *TestSpace) QuotaName() string {
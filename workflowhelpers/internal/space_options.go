@@ -0,0 +1,247 @@
+package internal
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cloudfoundry/cf-test-helpers/v2/internal"
+	"github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+)
+
+// SpaceOptions declare what Create sets up beyond the quota, org and space.
+// Org options only apply to orgs Create creates, and space options to spaces
+// it creates; feature flags always apply and are restored by Destroy.
+type SpaceOptions struct {
+	// OrgQuota, when set, replaces the org quota created from the
+	// QuotaDefinition fields of the TestSpace.
+	OrgQuota *QuotaBuilder
+
+	// SpaceQuota, when set, is created and applied to the space.
+	// SpaceQuotaName is a shorthand for a space quota only limited to
+	// SpaceQuotaTotalMemoryLimit (for example "1G", or "-1" for unlimited).
+	SpaceQuota                 *QuotaBuilder
+	SpaceQuotaName             string
+	SpaceQuotaTotalMemoryLimit string
+
+	// IsolationSegmentName entitles the org to an existing isolation segment
+	// and assigns it to the space.
+	IsolationSegmentName string
+
+	OrgLabels        map[string]string
+	OrgAnnotations   map[string]string
+	SpaceLabels      map[string]string
+	SpaceAnnotations map[string]string
+
+	EnableSSH bool
+
+	// FeatureFlags sets global feature flags, for example
+	// "diego_docker": true.
+	FeatureFlags map[string]bool
+}
+
+type relationship struct {
+	Guid string `json:"guid"`
+}
+
+type metadata struct {
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+func (ts *TestSpace) setFeatureFlags() {
+	names := make([]string, 0, len(ts.Options.FeatureFlags))
+	for name := range ts.Options.FeatureFlags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		var flag struct {
+			Enabled bool `json:"enabled"`
+		}
+		err := cfCurl(ts.CommandStarter, ts.Timeout, "GET", "/v3/feature_flags/"+name, nil, &flag)
+		gomega.ExpectWithOffset(2, err).NotTo(gomega.HaveOccurred(), "Failed to get feature flag "+name)
+
+		enabled := ts.Options.FeatureFlags[name]
+		if flag.Enabled == enabled {
+			continue
+		}
+
+		if ts.originalFeatureFlags == nil {
+			ts.originalFeatureFlags = map[string]bool{}
+		}
+		if _, ok := ts.originalFeatureFlags[name]; !ok {
+			ts.originalFeatureFlags[name] = flag.Enabled
+		}
+
+		err = cfCurl(ts.CommandStarter, ts.Timeout, "PATCH", "/v3/feature_flags/"+name, map[string]bool{"enabled": enabled}, nil)
+		gomega.ExpectWithOffset(2, err).NotTo(gomega.HaveOccurred(), "Failed to set feature flag "+name)
+	}
+}
+
+func (ts *TestSpace) restoreFeatureFlags() error {
+	names := make([]string, 0, len(ts.originalFeatureFlags))
+	for name := range ts.originalFeatureFlags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		err := cfCurl(ts.CommandStarter, ts.Timeout, "PATCH", "/v3/feature_flags/"+name, map[string]bool{"enabled": ts.originalFeatureFlags[name]}, nil)
+		if err != nil {
+			return fmt.Errorf("failed to restore feature flag %s: %s", name, err)
+		}
+		delete(ts.originalFeatureFlags, name)
+	}
+	ts.originalFeatureFlags = nil
+	return nil
+}
+
+func (options SpaceOptions) spaceQuota() *QuotaBuilder {
+	if options.SpaceQuota != nil || options.SpaceQuotaName == "" {
+		return options.SpaceQuota
+	}
+
+	spaceQuota := NewQuotaBuilder(options.SpaceQuotaName).TotalMemory(options.SpaceQuotaTotalMemoryLimit)
+	return &spaceQuota
+}
+
+func (ts *TestSpace) createOrgWithQuota() {
+	orgQuota := *ts.Options.OrgQuota
+	if orgQuota.name == "" {
+		orgQuota.name = ts.QuotaDefinitionName
+	}
+	ts.QuotaDefinitionName = orgQuota.name
+
+	quotaGuid, err := CreateOrgQuota(ts.CommandStarter, ts.Timeout, orgQuota)
+	gomega.ExpectWithOffset(3, err).NotTo(gomega.HaveOccurred(), "Failed to create quota")
+
+	createOrg := internal.Cf(ts.CommandStarter, "create-org", ts.organizationName)
+	gomega.EventuallyWithOffset(3, createOrg, ts.Timeout).Should(gexec.Exit(0), "Failed to create org")
+
+	err = ApplyOrgQuota(ts.CommandStarter, ts.Timeout, quotaGuid, ts.organizationGuid())
+	gomega.ExpectWithOffset(3, err).NotTo(gomega.HaveOccurred(), "Failed to set org quota")
+}
+
+func (ts *TestSpace) applyOrgOptions() {
+	options := ts.Options
+	labels := mergeLabels(ts.OwnershipLabels, options.OrgLabels)
+	annotations := options.OrgAnnotations
+	if len(ts.OwnershipLabels) > 0 {
+		annotations = mergeLabels(map[string]string{QuotaAnnotation: ts.QuotaDefinitionName}, annotations)
+	}
+	if len(labels) == 0 && len(annotations) == 0 && options.IsolationSegmentName == "" {
+		return
+	}
+
+	orgGuid := ts.organizationGuid()
+
+	if len(labels) > 0 || len(annotations) > 0 {
+		body := map[string]metadata{"metadata": {Labels: labels, Annotations: annotations}}
+		err := cfCurl(ts.CommandStarter, ts.Timeout, "PATCH", "/v3/organizations/"+orgGuid, body, nil)
+		gomega.ExpectWithOffset(3, err).NotTo(gomega.HaveOccurred(), "Failed to set org metadata")
+	}
+
+	if options.IsolationSegmentName != "" {
+		body := map[string][]relationship{"data": {{Guid: orgGuid}}}
+		err := cfCurl(ts.CommandStarter, ts.Timeout, "POST", "/v3/isolation_segments/"+ts.isolationSegmentGuid()+"/relationships/organizations", body, nil)
+		gomega.ExpectWithOffset(3, err).NotTo(gomega.HaveOccurred(), "Failed to entitle org to isolation segment")
+	}
+}
+
+func (ts *TestSpace) applySpaceOptions() {
+	options := ts.Options
+	spaceQuota := options.spaceQuota()
+	labels := mergeLabels(ts.OwnershipLabels, options.SpaceLabels)
+	annotations := options.SpaceAnnotations
+	if len(ts.OwnershipLabels) > 0 && spaceQuota != nil {
+		annotations = mergeLabels(map[string]string{SpaceQuotaAnnotation: spaceQuota.Name()}, annotations)
+	}
+	if spaceQuota == nil && options.IsolationSegmentName == "" && len(labels) == 0 && len(annotations) == 0 && !options.EnableSSH {
+		return
+	}
+
+	orgGuid := ts.organizationGuid()
+	spaceGuid, err := findGuid(ts.CommandStarter, ts.Timeout, "/v3/spaces", url.Values{"names": {ts.spaceName}, "organization_guids": {orgGuid}}, "space "+ts.spaceName)
+	gomega.ExpectWithOffset(2, err).NotTo(gomega.HaveOccurred())
+
+	if spaceQuota != nil {
+		ts.spaceQuotaGuid, err = CreateSpaceQuota(ts.CommandStarter, ts.Timeout, *spaceQuota, orgGuid, spaceGuid)
+		gomega.ExpectWithOffset(2, err).NotTo(gomega.HaveOccurred(), "Failed to create space quota")
+	}
+
+	if options.IsolationSegmentName != "" {
+		body := map[string]relationship{"data": {Guid: ts.isolationSegmentGuid()}}
+		err := cfCurl(ts.CommandStarter, ts.Timeout, "PATCH", "/v3/spaces/"+spaceGuid+"/relationships/isolation_segment", body, nil)
+		gomega.ExpectWithOffset(2, err).NotTo(gomega.HaveOccurred(), "Failed to set space isolation segment")
+	}
+
+	if len(labels) > 0 || len(annotations) > 0 {
+		body := map[string]metadata{"metadata": {Labels: labels, Annotations: annotations}}
+		err := cfCurl(ts.CommandStarter, ts.Timeout, "PATCH", "/v3/spaces/"+spaceGuid, body, nil)
+		gomega.ExpectWithOffset(2, err).NotTo(gomega.HaveOccurred(), "Failed to set space metadata")
+	}
+
+	if options.EnableSSH {
+		err := cfCurl(ts.CommandStarter, ts.Timeout, "PATCH", "/v3/spaces/"+spaceGuid+"/features/ssh", map[string]bool{"enabled": true}, nil)
+		gomega.ExpectWithOffset(2, err).NotTo(gomega.HaveOccurred(), "Failed to enable SSH for space")
+	}
+}
+
+func (ts *TestSpace) deleteSpaceQuota() error {
+	if ts.spaceQuotaGuid == "" {
+		return nil
+	}
+
+	err := cfCurl(ts.CommandStarter, ts.Timeout, "DELETE", "/v3/space_quotas/"+ts.spaceQuotaGuid, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete space quota: %s", err)
+	}
+	ts.spaceQuotaGuid = ""
+	return nil
+}
+
+func (ts *TestSpace) organizationGuid() string {
+	guid, err := findGuid(ts.CommandStarter, ts.Timeout, "/v3/organizations", url.Values{"names": {ts.organizationName}}, "org "+ts.organizationName)
+	gomega.ExpectWithOffset(3, err).NotTo(gomega.HaveOccurred())
+	return guid
+}
+
+func (ts *TestSpace) isolationSegmentGuid() string {
+	guid, err := findGuid(ts.CommandStarter, ts.Timeout, "/v3/isolation_segments", url.Values{"names": {ts.Options.IsolationSegmentName}}, "isolation segment "+ts.Options.IsolationSegmentName)
+	gomega.ExpectWithOffset(3, err).NotTo(gomega.HaveOccurred())
+	return guid
+}
+
+// memoryInMB converts a cf CLI memory limit such as "512M" or "10G" to
+// megabytes, returning nil for unlimited.
+func memoryInMB(original string) (*int, error) {
+	limit := strings.ToUpper(strings.TrimSpace(original))
+	if limit == "" || limit == "-1" {
+		return nil, nil
+	}
+
+	limit = strings.TrimSuffix(limit, "B")
+	multiplier := 1
+	switch {
+	case strings.HasSuffix(limit, "T"):
+		multiplier = 1024 * 1024
+	case strings.HasSuffix(limit, "G"):
+		multiplier = 1024
+	case strings.HasSuffix(limit, "M"):
+	default:
+		return nil, fmt.Errorf("memory limit %q must end in M, G or T", original)
+	}
+
+	value, err := strconv.Atoi(limit[:len(limit)-1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid memory limit %q", original)
+	}
+
+	memory := value * multiplier
+	return &memory, nil
+}
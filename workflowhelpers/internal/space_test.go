@@ -194,6 +194,17 @@ var _ = Describe("TestSpace", func() {
 			})
 		})
 
+		Describe("CreateOrganization", func() {
+			It("creates the quota and org, but not the space", func() {
+				testSpace.CreateOrganization()
+				var commands []string
+				for _, call := range fakeStarter.CalledWith {
+					commands = append(commands, call.Args[0])
+				}
+				Expect(commands).To(Equal([]string{"create-quota", "create-org", "set-quota"}))
+			})
+		})
+
 		Describe("failure cases", func() {
 			testFailureCase := func(callIndex int, errorMsg string) func() {
 				return func() {
@@ -292,6 +303,14 @@ var _ = Describe("TestSpace", func() {
 			Expect(fakeStarter.CalledWith[1].Args).To(Equal([]string{"delete-quota", "-f", testSpace.QuotaDefinitionName}))
 		})
 
+		It("still deletes the quota when deleting the org fails", func() {
+			fakeStarter.ToReturn[0].ExitCode = 1
+
+			failures := InterceptGomegaFailures(testSpace.Destroy)
+			Expect(failures).To(ConsistOf(ContainSubstring("delete org " + testSpace.OrganizationName())))
+			Expect(fakeStarter.CalledWith[1].Args).To(Equal([]string{"delete-quota", "-f", testSpace.QuotaDefinitionName}))
+		})
+
 		Context("when the config specifies that an existing organization should be used", func() {
 			BeforeEach(func() {
 				isExistingOrganization = true
@@ -382,6 +401,203 @@ var _ = Describe("TestSpace", func() {
 		})
 	})
 
+	Describe("Options", func() {
+		var testSpace *TestSpace
+		var fakeStarter *fakes.FakeCmdStarter
+		var isExistingOrganization bool
+
+		var cfCommands = func() [][]string {
+			var commands [][]string
+			for _, call := range fakeStarter.CalledWith {
+				commands = append(commands, call.Args)
+			}
+			return commands
+		}
+
+		BeforeEach(func() {
+			fakeStarter = fakes.NewFakeCmdStarter()
+			fakeStarter.ToReturn = append(fakeStarter.ToReturn, fakeStarter.ToReturn...)
+			fakeStarter.ToReturn = append(fakeStarter.ToReturn, fakeStarter.ToReturn...)
+			isExistingOrganization = false
+		})
+
+		JustBeforeEach(func() {
+			testSpace = NewBaseTestSpace("space", "org", "quota", "10G", isExistingOrganization, false, time.Second, fakeStarter)
+		})
+
+		Context("when creating the org and the space", func() {
+			BeforeEach(func() {
+				fakeStarter.ToReturn[0].Output = `'{"name":"diego_docker","enabled":false}'`
+				fakeStarter.ToReturn[5].Output = `'{"resources":[{"guid":"org-guid"}]}'`
+				fakeStarter.ToReturn[7].Output = `'{"resources":[{"guid":"segment-guid"}]}'`
+				fakeStarter.ToReturn[10].Output = `'{"resources":[{"guid":"org-guid"}]}'`
+				fakeStarter.ToReturn[11].Output = `'{"resources":[{"guid":"space-guid"}]}'`
+				fakeStarter.ToReturn[12].Output = `'{"guid":"space-quota-guid"}'`
+				fakeStarter.ToReturn[13].Output = `'{"guid":"space-quota-guid","apps":{"total_memory_in_mb":1024}}'`
+				fakeStarter.ToReturn[14].Output = `'{"resources":[{"guid":"segment-guid"}]}'`
+			})
+
+			JustBeforeEach(func() {
+				testSpace.Options = SpaceOptions{
+					SpaceQuotaName:             "space-quota",
+					SpaceQuotaTotalMemoryLimit: "1G",
+					IsolationSegmentName:       "segment",
+					OrgLabels:                  map[string]string{"team": "routing"},
+					SpaceAnnotations:           map[string]string{"purpose": "tests"},
+					EnableSSH:                  true,
+					FeatureFlags:               map[string]bool{"diego_docker": true},
+				}
+			})
+
+			It("applies the options to the org and the space", func() {
+				testSpace.Create()
+
+				Expect(cfCommands()).To(Equal([][]string{
+					{"curl", "/v3/feature_flags/diego_docker"},
+					{"curl", "/v3/feature_flags/diego_docker", "-X", "PATCH", "-d", `{"enabled":true}`},
+					{"create-quota", "quota", "-m", "10G", "-i", "-1", "-r", "1000", "-a", "-1", "-s", "100", "--reserved-route-ports", "20", "--allow-paid-service-plans"},
+					{"create-org", "org"},
+					{"set-quota", "org", "quota"},
+					{"curl", "/v3/organizations?names=org"},
+					{"curl", "/v3/organizations/org-guid", "-X", "PATCH", "-d", `{"metadata":{"labels":{"team":"routing"}}}`},
+					{"curl", "/v3/isolation_segments?names=segment"},
+					{"curl", "/v3/isolation_segments/segment-guid/relationships/organizations", "-X", "POST", "-d", `{"data":[{"guid":"org-guid"}]}`},
+					{"create-space", "-o", "org", "space"},
+					{"curl", "/v3/organizations?names=org"},
+					{"curl", "/v3/spaces?names=space&organization_guids=org-guid"},
+					{"curl", "/v3/space_quotas", "-X", "POST", "-d", `{"name":"space-quota","apps":{"total_memory_in_mb":1024,"per_process_memory_in_mb":null,"total_instances":null,"per_app_tasks":null,"log_rate_limit_in_bytes_per_second":null},"services":{"paid_services_allowed":false,"total_service_instances":null,"total_service_keys":null},"routes":{"total_routes":null,"total_reserved_ports":null},"relationships":{"organization":{"data":{"guid":"org-guid"}},"spaces":{"data":[{"guid":"space-guid"}]}}}`},
+					{"curl", "/v3/space_quotas/space-quota-guid"},
+					{"curl", "/v3/isolation_segments?names=segment"},
+					{"curl", "/v3/spaces/space-guid/relationships/isolation_segment", "-X", "PATCH", "-d", `{"data":{"guid":"segment-guid"}}`},
+					{"curl", "/v3/spaces/space-guid", "-X", "PATCH", "-d", `{"metadata":{"annotations":{"purpose":"tests"}}}`},
+					{"curl", "/v3/spaces/space-guid/features/ssh", "-X", "PATCH", "-d", `{"enabled":true}`},
+				}))
+			})
+
+			It("restores the feature flags it changed before deleting the org", func() {
+				testSpace.Create()
+				calls := len(fakeStarter.CalledWith)
+
+				testSpace.Destroy()
+				Expect(cfCommands()[calls:]).To(Equal([][]string{
+					{"curl", "/v3/feature_flags/diego_docker", "-X", "PATCH", "-d", `{"enabled":false}`},
+					{"delete-org", "-f", "org"},
+					{"delete-quota", "-f", "quota"},
+				}))
+			})
+
+			Context("when the API returns an error", func() {
+				BeforeEach(func() {
+					fakeStarter.ToReturn[6].Output = `'{"errors":[{"title":"CF-UnprocessableEntity","detail":"Metadata label key error"}]}'`
+				})
+
+				It("fails with a ginkgo error", func() {
+					failures := InterceptGomegaFailures(testSpace.Create)
+					Expect(failures).To(ConsistOf(ContainSubstring("PATCH /v3/organizations/org-guid failed: CF-UnprocessableEntity: Metadata label key error")))
+				})
+			})
+		})
+
+		Context("when an org quota is declared", func() {
+			BeforeEach(func() {
+				fakeStarter.ToReturn[0].Output = `'{"guid":"quota-guid"}'`
+				fakeStarter.ToReturn[1].Output = `'{"guid":"quota-guid","apps":{"log_rate_limit_in_bytes_per_second":1024}}'`
+				fakeStarter.ToReturn[3].Output = `'{"resources":[{"guid":"org-guid"}]}'`
+			})
+
+			JustBeforeEach(func() {
+				orgQuota := NewQuotaBuilder("").LogRateLimit(1024)
+				testSpace.Options = SpaceOptions{OrgQuota: &orgQuota}
+			})
+
+			It("creates it through the v3 API instead of cf create-quota", func() {
+				testSpace.Create()
+
+				commands := cfCommands()
+				Expect(commands).To(HaveLen(6))
+				Expect(commands[0][:4]).To(Equal([]string{"curl", "/v3/organization_quotas", "-X", "POST"}))
+				Expect(commands[0][5]).To(HavePrefix(`{"name":"quota","apps":{`))
+				Expect(commands[1:]).To(Equal([][]string{
+					{"curl", "/v3/organization_quotas/quota-guid"},
+					{"create-org", "org"},
+					{"curl", "/v3/organizations?names=org"},
+					{"curl", "/v3/organization_quotas/quota-guid/relationships/organizations", "-X", "POST", "-d", `{"data":[{"guid":"org-guid"}]}`},
+					{"create-space", "-o", "org", "space"},
+				}))
+			})
+
+			It("fails when the quota does not read back as declared", func() {
+				fakeStarter.ToReturn[1].Output = `'{"guid":"quota-guid"}'`
+
+				failures := InterceptGomegaFailures(testSpace.Create)
+				Expect(failures[0]).To(MatchRegexp("(?s)Failed to create quota.*quota quota was created with limits"))
+			})
+		})
+
+		Context("when ownership labels are set", func() {
+			BeforeEach(func() {
+				fakeStarter.ToReturn[3].Output = `'{"resources":[{"guid":"org-guid"}]}'`
+				fakeStarter.ToReturn[6].Output = `'{"resources":[{"guid":"org-guid"}]}'`
+				fakeStarter.ToReturn[7].Output = `'{"resources":[{"guid":"space-guid"}]}'`
+			})
+
+			JustBeforeEach(func() {
+				testSpace.OwnershipLabels = map[string]string{RunIDLabel: "run", SuiteLabel: "CATS"}
+				testSpace.Options = SpaceOptions{OrgLabels: map[string]string{"team": "routing", SuiteLabel: "mine"}}
+			})
+
+			It("labels the org and space it creates, naming the quota in an annotation", func() {
+				testSpace.Create()
+
+				Expect(cfCommands()[3:]).To(Equal([][]string{
+					{"curl", "/v3/organizations?names=org"},
+					{"curl", "/v3/organizations/org-guid", "-X", "PATCH", "-d", `{"metadata":{"labels":{"cf-test-helpers.cloudfoundry.org/run-id":"run","cf-test-helpers.cloudfoundry.org/suite":"mine","team":"routing"},"annotations":{"cf-test-helpers.cloudfoundry.org/quota":"quota"}}}`},
+					{"create-space", "-o", "org", "space"},
+					{"curl", "/v3/organizations?names=org"},
+					{"curl", "/v3/spaces?names=space&organization_guids=org-guid"},
+					{"curl", "/v3/spaces/space-guid", "-X", "PATCH", "-d", `{"metadata":{"labels":{"cf-test-helpers.cloudfoundry.org/run-id":"run","cf-test-helpers.cloudfoundry.org/suite":"CATS"}}}`},
+				}))
+			})
+		})
+
+		Context("when the org exists", func() {
+			BeforeEach(func() {
+				isExistingOrganization = true
+				fakeStarter.ToReturn[0].Output = `'{"name":"diego_docker","enabled":true}'`
+				fakeStarter.ToReturn[2].Output = `'{"resources":[{"guid":"org-guid"}]}'`
+				fakeStarter.ToReturn[3].Output = `'{"resources":[{"guid":"space-guid"}]}'`
+				fakeStarter.ToReturn[4].Output = `'{"guid":"space-quota-guid"}'`
+				fakeStarter.ToReturn[5].Output = `'{"guid":"space-quota-guid"}'`
+			})
+
+			JustBeforeEach(func() {
+				testSpace.Options = SpaceOptions{
+					SpaceQuotaName: "space-quota",
+					OrgLabels:      map[string]string{"team": "routing"},
+					FeatureFlags:   map[string]bool{"diego_docker": true},
+				}
+			})
+
+			It("leaves the org and unchanged feature flags alone and deletes the space quota after the space", func() {
+				testSpace.Create()
+				Expect(cfCommands()).To(Equal([][]string{
+					{"curl", "/v3/feature_flags/diego_docker"},
+					{"create-space", "-o", "org", "space"},
+					{"curl", "/v3/organizations?names=org"},
+					{"curl", "/v3/spaces?names=space&organization_guids=org-guid"},
+					{"curl", "/v3/space_quotas", "-X", "POST", "-d", `{"name":"space-quota","apps":{"total_memory_in_mb":null,"per_process_memory_in_mb":null,"total_instances":null,"per_app_tasks":null,"log_rate_limit_in_bytes_per_second":null},"services":{"paid_services_allowed":false,"total_service_instances":null,"total_service_keys":null},"routes":{"total_routes":null,"total_reserved_ports":null},"relationships":{"organization":{"data":{"guid":"org-guid"}},"spaces":{"data":[{"guid":"space-guid"}]}}}`},
+					{"curl", "/v3/space_quotas/space-quota-guid"},
+				}))
+
+				testSpace.Destroy()
+				Expect(cfCommands()[6:]).To(Equal([][]string{
+					{"delete-space", "-f", "-o", "org", "space"},
+					{"curl", "/v3/space_quotas/space-quota-guid", "-X", "DELETE"},
+				}))
+			})
+		})
+	})
+
 	Describe("QuotaName", func() {
 
 		var testSpace *TestSpace
@@ -0,0 +1,198 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry/cf-test-helpers/v2/internal"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+)
+
+type TeardownOptions struct {
+	// Attempts is how often a step that fails transiently is tried, 3 when
+	// unset. Other failures are not retried.
+	Attempts      int
+	RetryInterval time.Duration
+
+	// FailuresAsWarnings reports failed steps as warnings instead of
+	// returning them.
+	FailuresAsWarnings bool
+}
+
+// Teardown runs cleanup steps in the reverse order of their registration,
+// so steps registered as their resources are created run before the steps
+// of the resources they depend on. A failed step does not stop the steps
+// after it.
+type Teardown struct {
+	options TeardownOptions
+
+	lock  sync.Mutex
+	steps []teardownStep
+}
+
+type teardownStep struct {
+	name    string
+	cleanup func() error
+}
+
+// StepFailure is the last failure of a cleanup step.
+type StepFailure struct {
+	Step     string
+	Attempts int
+	Err      error
+}
+
+func (failure StepFailure) String() string {
+	return fmt.Sprintf("%s (after %d attempts): %s", failure.Step, failure.Attempts, failure.Err)
+}
+
+type TeardownError struct {
+	Steps    int
+	Failures []StepFailure
+}
+
+func (err *TeardownError) Error() string {
+	failures := make([]string, 0, len(err.Failures))
+	for _, failure := range err.Failures {
+		failures = append(failures, failure.String())
+	}
+	return fmt.Sprintf("%d of %d cleanup steps failed:\n%s", len(err.Failures), err.Steps, strings.Join(failures, "\n"))
+}
+
+// GomegaString keeps gomega from dumping the failures again after Error.
+func (err *TeardownError) GomegaString() string {
+	return fmt.Sprintf("%d failed cleanup steps", len(err.Failures))
+}
+
+func NewTeardown(options TeardownOptions) *Teardown {
+	if options.Attempts <= 0 {
+		options.Attempts = 3
+	}
+	return &Teardown{options: options}
+}
+
+func (teardown *Teardown) Register(name string, cleanup func() error) {
+	teardown.lock.Lock()
+	defer teardown.lock.Unlock()
+	teardown.steps = append(teardown.steps, teardownStep{name: name, cleanup: cleanup})
+}
+
+// RegisterAssertions registers a step that fails through gomega assertions,
+// such as the Destroy of a remote resource. It is not retried.
+func (teardown *Teardown) RegisterAssertions(name string, cleanup func()) {
+	teardown.Register(name, func() error {
+		err := gomega.InterceptGomegaFailure(cleanup)
+		if err != nil {
+			return permanentFailure{err}
+		}
+		return nil
+	})
+}
+
+// RegisterCf registers a step running the cf command, which is retried when
+// its output shows a transient failure.
+func (teardown *Teardown) RegisterCf(name string, cmdStarter internal.Starter, timeout time.Duration, failureMessage string, args ...string) {
+	teardown.Register(name, func() error {
+		session := internal.Cf(cmdStarter, args...)
+		err := gomega.InterceptGomegaFailure(func() {
+			gomega.Eventually(session, timeout).Should(gexec.Exit(0), failureMessage)
+		})
+		if err == nil {
+			return nil
+		}
+
+		output := strings.TrimSpace(string(session.Out.Contents()))
+		if output == "" {
+			return err
+		}
+		return fmt.Errorf("%s\n%s", err, output)
+	})
+}
+
+// Run runs the registered steps once each and forgets them. It returns a
+// *TeardownError with the failed steps, unless they are reported as
+// warnings.
+func (teardown *Teardown) Run() error {
+	teardown.lock.Lock()
+	steps := teardown.steps
+	teardown.steps = nil
+	teardown.lock.Unlock()
+
+	var failures []StepFailure
+	for i := len(steps) - 1; i >= 0; i-- {
+		failure := teardown.runStep(steps[i])
+		if failure != nil {
+			failures = append(failures, *failure)
+		}
+	}
+
+	if len(failures) == 0 {
+		return nil
+	}
+
+	if teardown.options.FailuresAsWarnings {
+		for _, failure := range failures {
+			ginkgo.AddReportEntry("Teardown warning", failure.String())
+		}
+		return nil
+	}
+	return &TeardownError{Steps: len(steps), Failures: failures}
+}
+
+func (teardown *Teardown) runStep(step teardownStep) *StepFailure {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = step.cleanup()
+		if err == nil {
+			return nil
+		}
+		if attempt >= teardown.options.Attempts || !IsTransientFailure(err) {
+			return &StepFailure{Step: step.name, Attempts: attempt, Err: err}
+		}
+		time.Sleep(teardown.options.RetryInterval)
+	}
+}
+
+type permanentFailure struct {
+	error
+}
+
+func (failure permanentFailure) Unwrap() error {
+	return failure.error
+}
+
+var transientFailures = []string{
+	"502 Bad Gateway",
+	"503 Service Unavailable",
+	"504 Gateway Timeout",
+	"connection refused",
+	"connection reset by peer",
+	"i/o timeout",
+	"TLS handshake timeout",
+	"unexpected EOF",
+	"operation in progress",
+	"is in progress",
+}
+
+// IsTransientFailure reports whether the failure looks like it could succeed
+// when tried again, such as a gateway error or a concurrent operation.
+func IsTransientFailure(err error) bool {
+	var permanent permanentFailure
+	var teardownErr *TeardownError
+	if err == nil || errors.As(err, &permanent) || errors.As(err, &teardownErr) {
+		return false
+	}
+
+	message := err.Error()
+	for _, transient := range transientFailures {
+		if strings.Contains(message, transient) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+package internal_test
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cloudfoundry/cf-test-helpers/v2/internal/fakes"
+	. "github.com/cloudfoundry/cf-test-helpers/v2/workflowhelpers/internal"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Teardown", func() {
+	var teardown *Teardown
+	var ran []string
+
+	var step = func(name string, errs ...error) func() error {
+		return func() error {
+			ran = append(ran, name)
+			if len(errs) == 0 {
+				return nil
+			}
+			err := errs[0]
+			errs = errs[1:]
+			return err
+		}
+	}
+
+	BeforeEach(func() {
+		ran = nil
+		teardown = NewTeardown(TeardownOptions{RetryInterval: time.Millisecond})
+	})
+
+	It("runs the steps in reverse order of their registration", func() {
+		teardown.Register("quota", step("quota"))
+		teardown.Register("org", step("org"))
+		teardown.Register("space", step("space"))
+
+		Expect(teardown.Run()).To(Succeed())
+		Expect(ran).To(Equal([]string{"space", "org", "quota"}))
+	})
+
+	It("forgets the steps once they ran", func() {
+		teardown.Register("org", step("org"))
+		Expect(teardown.Run()).To(Succeed())
+		Expect(teardown.Run()).To(Succeed())
+		Expect(ran).To(HaveLen(1))
+	})
+
+	It("carries on past failures and returns all of them", func() {
+		teardown.Register("quota", step("quota", errors.New("quota is in use")))
+		teardown.Register("org", step("org"))
+		teardown.Register("user", step("user", errors.New("user not found")))
+
+		err := teardown.Run()
+		Expect(ran).To(Equal([]string{"user", "org", "quota"}))
+
+		var teardownErr *TeardownError
+		Expect(errors.As(err, &teardownErr)).To(BeTrue())
+		Expect(teardownErr.Failures).To(HaveLen(2))
+		Expect(err).To(MatchError("2 of 3 cleanup steps failed:\n" +
+			"user (after 1 attempts): user not found\n" +
+			"quota (after 1 attempts): quota is in use"))
+	})
+
+	It("retries transient failures", func() {
+		teardown.Register("org", step("org", errors.New("502 Bad Gateway"), errors.New("connection reset by peer")))
+
+		Expect(teardown.Run()).To(Succeed())
+		Expect(ran).To(HaveLen(3))
+	})
+
+	It("gives up on transient failures after the configured attempts", func() {
+		teardown = NewTeardown(TeardownOptions{Attempts: 2, RetryInterval: time.Millisecond})
+		teardown.Register("org", step("org", errors.New("i/o timeout"), errors.New("i/o timeout"), nil))
+
+		Expect(teardown.Run()).To(MatchError(ContainSubstring("org (after 2 attempts): i/o timeout")))
+		Expect(ran).To(HaveLen(2))
+	})
+
+	It("turns gomega failures of steps into errors", func() {
+		teardown.RegisterAssertions("space", func() {
+			Expect("space").To(Equal("gone"), "Failed to delete space")
+		})
+		teardown.Register("org", step("org"))
+
+		Expect(teardown.Run()).To(MatchError(ContainSubstring("space (after 1 attempts): Failed to delete space")))
+		Expect(ran).To(Equal([]string{"org"}))
+	})
+
+	Context("when failures are warnings", func() {
+		BeforeEach(func() {
+			teardown = NewTeardown(TeardownOptions{FailuresAsWarnings: true})
+		})
+
+		It("reports them instead of returning them", func() {
+			teardown.Register("org", step("org", errors.New("org is in use")))
+
+			Expect(teardown.Run()).To(Succeed())
+			Expect(CurrentSpecReport().ReportEntries).To(ContainElement(And(
+				HaveField("Name", "Teardown warning"),
+				HaveField("Value.String()", "org (after 1 attempts): org is in use"),
+			)))
+		})
+	})
+
+	Describe("RegisterCf", func() {
+		var fakeStarter *fakes.FakeCmdStarter
+
+		BeforeEach(func() {
+			fakeStarter = fakes.NewFakeCmdStarter()
+		})
+
+		It("retries the command when its output shows a transient failure", func() {
+			fakeStarter.ToReturn[0].ExitCode = 1
+			fakeStarter.ToReturn[0].Output = "Server error, status code: 503 Service Unavailable"
+			teardown.RegisterCf("delete org", fakeStarter, time.Second, "Failed to delete org", "delete-org", "-f", "org")
+
+			Expect(teardown.Run()).To(Succeed())
+			Expect(fakeStarter.TotalCallsToStart).To(Equal(2))
+			Expect(fakeStarter.CalledWith[1].Args).To(Equal([]string{"delete-org", "-f", "org"}))
+		})
+
+		It("fails with the command's output otherwise", func() {
+			fakeStarter.ToReturn[0].ExitCode = 1
+			fakeStarter.ToReturn[0].Output = "Org is still in use"
+			teardown.RegisterCf("delete org", fakeStarter, time.Second, "Failed to delete org", "delete-org", "-f", "org")
+
+			err := teardown.Run()
+			Expect(err).To(MatchError(MatchRegexp("(?s)delete org \\(after 1 attempts\\): .*Failed to delete org.*Org is still in use")))
+			Expect(fakeStarter.TotalCallsToStart).To(Equal(1))
+		})
+	})
+
+	Describe("IsTransientFailure", func() {
+		It("does not retry failed teardowns", func() {
+			Expect(IsTransientFailure(&TeardownError{Failures: []StepFailure{{Step: "org", Err: errors.New("502 Bad Gateway")}}})).To(BeFalse())
+		})
+	})
+})
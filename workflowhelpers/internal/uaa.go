@@ -0,0 +1,388 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry/cf-test-helpers/v2/generator"
+	"github.com/cloudfoundry/cf-test-helpers/v2/internal"
+)
+
+// OAuthClient is a UAA client registration.
+type OAuthClient struct {
+	ClientId             string   `json:"client_id"`
+	ClientSecret         string   `json:"client_secret,omitempty"`
+	AuthorizedGrantTypes []string `json:"authorized_grant_types"`
+	Authorities          []string `json:"authorities,omitempty"`
+	Scope                []string `json:"scope,omitempty"`
+}
+
+// GenerateClientCredentials returns a random client id with the name prefix
+// and a random secret, for clients that only live as long as the suite.
+func GenerateClientCredentials(namePrefix string) (string, string) {
+	return generator.PrefixedRandomName(namePrefix, "CLIENT"), generatePassword()
+}
+
+// uaaTokenExpiryMargin is how long before its token expires the client
+// authenticates again, so that the token does not expire mid-request.
+const uaaTokenExpiryMargin = 1 * time.Minute
+
+// UAAClient talks to the UAA directly over HTTP, for the user and client
+// management the cf CLI does not offer. It authenticates again with the same
+// credentials when its token is about to expire or is rejected.
+type UAAClient struct {
+	Url        string
+	HTTPClient *http.Client
+
+	lock           sync.Mutex
+	token          string
+	tokenExpiresAt time.Time
+	reauthenticate func() error
+}
+
+type uaaErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+	Message          string `json:"message"`
+}
+
+type uaaStatusError struct {
+	statusCode  int
+	description string
+}
+
+func (err uaaStatusError) Error() string {
+	return fmt.Sprintf("UAA returned status %d: %s", err.statusCode, err.description)
+}
+
+// NewUAAHTTPClient returns a client that skips certificate validation when
+// asked to and otherwise trusts the CA bundle and presents the client
+// certificate configured by cfg, if any.
+func NewUAAHTTPClient(cfg interface{}, skipSSLValidation bool, timeout time.Duration) (*http.Client, error) {
+	tlsConfig, err := internal.ClientTLSConfig(cfg, skipSSLValidation)
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}, nil
+}
+
+// DiscoverUAAUrl finds the UAA of the foundation behind the given API from
+// the links of the API root, falling back to the token endpoint in /v2/info
+// for foundations that do not publish it there.
+func DiscoverUAAUrl(httpClient *http.Client, apiUrl string) (string, error) {
+	apiUrl = withScheme(apiUrl)
+
+	var root struct {
+		Links struct {
+			UAA struct {
+				Href string `json:"href"`
+			} `json:"uaa"`
+		} `json:"links"`
+	}
+	err := getJSON(httpClient, apiUrl+"/", &root)
+	if err == nil && root.Links.UAA.Href != "" {
+		return strings.TrimSuffix(root.Links.UAA.Href, "/"), nil
+	}
+
+	var info struct {
+		TokenEndpoint string `json:"token_endpoint"`
+	}
+	err = getJSON(httpClient, apiUrl+"/v2/info", &info)
+	if err != nil {
+		return "", fmt.Errorf("could not discover the UAA of %s: %s", apiUrl, err)
+	}
+	if info.TokenEndpoint == "" {
+		return "", fmt.Errorf("could not discover the UAA of %s: no token endpoint in /v2/info", apiUrl)
+	}
+
+	return strings.TrimSuffix(info.TokenEndpoint, "/"), nil
+}
+
+func NewUAAClient(uaaUrl string, httpClient *http.Client) *UAAClient {
+	return &UAAClient{
+		Url:        strings.TrimSuffix(uaaUrl, "/"),
+		HTTPClient: httpClient,
+	}
+}
+
+// AuthenticateClient fetches a token with the client credentials grant.
+func (uaa *UAAClient) AuthenticateClient(clientId, clientSecret string) error {
+	return uaa.authenticate(clientId, clientSecret, url.Values{
+		"grant_type": {"client_credentials"},
+	})
+}
+
+// AuthenticateUser fetches a token for the user with the password grant of
+// the cf CLI's client, so it holds the scopes the user's cf commands hold.
+func (uaa *UAAClient) AuthenticateUser(username, password, origin string) error {
+	form := url.Values{
+		"grant_type": {"password"},
+		"username":   {username},
+		"password":   {password},
+	}
+	if origin != "" {
+		form.Set("login_hint", fmt.Sprintf(`{"origin":%q}`, origin))
+	}
+
+	return uaa.authenticate("cf", "", form)
+}
+
+func (uaa *UAAClient) authenticate(clientId, clientSecret string, form url.Values) error {
+	uaa.lock.Lock()
+	defer uaa.lock.Unlock()
+
+	uaa.reauthenticate = func() error {
+		return uaa.fetchToken(clientId, clientSecret, form)
+	}
+	return uaa.fetchToken(clientId, clientSecret, form)
+}
+
+// fetchToken is called with the lock held.
+func (uaa *UAAClient) fetchToken(clientId, clientSecret string, form url.Values) error {
+	request, err := http.NewRequest(http.MethodPost, uaa.Url+"/oauth/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	request.SetBasicAuth(url.QueryEscape(clientId), url.QueryEscape(clientSecret))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	err = uaa.do(request, &token)
+	if err != nil {
+		return fmt.Errorf("could not authenticate %s with the UAA: %s", clientId, err)
+	}
+
+	uaa.token = token.AccessToken
+	uaa.tokenExpiresAt = time.Time{}
+	if token.ExpiresIn > 0 {
+		uaa.tokenExpiresAt = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+	return nil
+}
+
+// currentToken returns the token to send, authenticating again first when
+// it is about to expire or the UAA rejected it. It tells whether the token
+// is a new one.
+func (uaa *UAAClient) currentToken(rejected string) (string, bool, error) {
+	uaa.lock.Lock()
+	defer uaa.lock.Unlock()
+
+	if uaa.reauthenticate == nil {
+		return uaa.token, false, nil
+	}
+	if rejected != "" && rejected != uaa.token {
+		return uaa.token, true, nil
+	}
+
+	expiring := !uaa.tokenExpiresAt.IsZero() && time.Now().Add(uaaTokenExpiryMargin).After(uaa.tokenExpiresAt)
+	if !expiring && rejected == "" {
+		return uaa.token, false, nil
+	}
+
+	err := uaa.reauthenticate()
+	if err != nil {
+		return "", false, err
+	}
+	return uaa.token, true, nil
+}
+
+func (uaa *UAAClient) CreateClient(client OAuthClient) error {
+	return uaa.request(http.MethodPost, "/oauth/clients", client, nil)
+}
+
+func (uaa *UAAClient) DeleteClient(clientId string) error {
+	return uaa.request(http.MethodDelete, "/oauth/clients/"+url.PathEscape(clientId), nil, nil)
+}
+
+// AddUserToGroup makes the user a member of the group with the given display
+// name, for example cloud_controller.admin_read_only.
+func (uaa *UAAClient) AddUserToGroup(username, origin, group string) error {
+	userId, err := uaa.userId(username, origin)
+	if err != nil {
+		return err
+	}
+
+	groupId, err := uaa.groupId(group)
+	if err != nil {
+		return err
+	}
+
+	member := map[string]string{
+		"origin": originOrDefault(origin),
+		"type":   "USER",
+		"value":  userId,
+	}
+	return uaa.request(http.MethodPost, "/Groups/"+groupId+"/members", member, nil)
+}
+
+func (uaa *UAAClient) RemoveUserFromGroup(username, origin, group string) error {
+	userId, err := uaa.userId(username, origin)
+	if err != nil {
+		return err
+	}
+
+	groupId, err := uaa.groupId(group)
+	if err != nil {
+		return err
+	}
+
+	return uaa.request(http.MethodDelete, "/Groups/"+groupId+"/members/"+userId, nil, nil)
+}
+
+func (uaa *UAAClient) userId(username, origin string) (string, error) {
+	filter := fmt.Sprintf("userName eq %q and origin eq %q", username, originOrDefault(origin))
+	return uaa.findId("/Users", filter, "user "+username)
+}
+
+func (uaa *UAAClient) groupId(group string) (string, error) {
+	return uaa.findId("/Groups", fmt.Sprintf("displayName eq %q", group), "group "+group)
+}
+
+func (uaa *UAAClient) findId(path, filter, description string) (string, error) {
+	var list struct {
+		Resources []struct {
+			Id string `json:"id"`
+		} `json:"resources"`
+	}
+
+	err := uaa.request(http.MethodGet, path+"?"+url.Values{"filter": {filter}}.Encode(), nil, &list)
+	if err != nil {
+		return "", err
+	}
+	if len(list.Resources) != 1 {
+		return "", fmt.Errorf("expected to find one %s, found %d", description, len(list.Resources))
+	}
+
+	return list.Resources[0].Id, nil
+}
+
+func (uaa *UAAClient) request(method, path string, body, response interface{}) error {
+	var contents []byte
+	if body != nil {
+		var err error
+		contents, err = json.Marshal(body)
+		if err != nil {
+			return err
+		}
+	}
+
+	token, _, err := uaa.currentToken("")
+	if err != nil {
+		return err
+	}
+
+	err = uaa.send(method, path, contents, token, response)
+	var statusError uaaStatusError
+	if errors.As(err, &statusError) && statusError.statusCode == http.StatusUnauthorized {
+		var renewed bool
+		token, renewed, err = uaa.currentToken(token)
+		if err != nil {
+			return err
+		}
+		if renewed {
+			err = uaa.send(method, path, contents, token, response)
+		} else {
+			err = statusError
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+func (uaa *UAAClient) send(method, path string, contents []byte, token string, response interface{}) error {
+	var reader io.Reader
+	if contents != nil {
+		reader = bytes.NewReader(contents)
+	}
+
+	request, err := http.NewRequest(method, uaa.Url+path, reader)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "bearer "+token)
+	request.Header.Set("Accept", "application/json")
+	if contents != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	return uaa.do(request, response)
+}
+
+func (uaa *UAAClient) do(request *http.Request, response interface{}) error {
+	httpResponse, err := uaa.HTTPClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer httpResponse.Body.Close() // nolint:errcheck
+
+	contents, err := io.ReadAll(httpResponse.Body)
+	if err != nil {
+		return err
+	}
+
+	if httpResponse.StatusCode >= 300 {
+		var uaaError uaaErrorResponse
+		_ = json.Unmarshal(contents, &uaaError)
+
+		description := uaaError.ErrorDescription
+		if description == "" {
+			description = uaaError.Message
+		}
+		if description == "" {
+			description = strings.TrimSpace(string(contents))
+		}
+		return uaaStatusError{statusCode: httpResponse.StatusCode, description: description}
+	}
+
+	if response == nil || len(contents) == 0 {
+		return nil
+	}
+	return json.Unmarshal(contents, response)
+}
+
+func getJSON(httpClient *http.Client, url string, response interface{}) error {
+	httpResponse, err := httpClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer httpResponse.Body.Close() // nolint:errcheck
+
+	if httpResponse.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned status %d", url, httpResponse.StatusCode)
+	}
+
+	return json.NewDecoder(httpResponse.Body).Decode(response)
+}
+
+func withScheme(apiUrl string) string {
+	apiUrl = strings.TrimSuffix(apiUrl, "/")
+	if strings.HasPrefix(apiUrl, "http://") || strings.HasPrefix(apiUrl, "https://") {
+		return apiUrl
+	}
+	return "https://" + apiUrl
+}
+
+func originOrDefault(origin string) string {
+	if origin == "" {
+		return "uaa"
+	}
+	return origin
+}
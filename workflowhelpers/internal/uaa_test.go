@@ -0,0 +1,196 @@
+package internal_test
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/cf-test-helpers/v2/config"
+	. "github.com/cloudfoundry/cf-test-helpers/v2/workflowhelpers/internal"
+	"github.com/cloudfoundry/cf-test-helpers/v2/workflowhelpers/internal/fakes"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("UAAClient", func() {
+	var fakeUAA *fakes.FakeUAA
+
+	BeforeEach(func() {
+		fakeUAA = fakes.NewFakeUAA()
+		DeferCleanup(fakeUAA.Close)
+	})
+
+	Describe("DiscoverUAAUrl", func() {
+		It("uses the UAA link of the API root", func() {
+			uaaUrl, err := DiscoverUAAUrl(http.DefaultClient, fakeUAA.URL())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(uaaUrl).To(Equal(fakeUAA.URL()))
+		})
+
+		It("falls back to the token endpoint in /v2/info", func() {
+			fakeUAA.PublishRootLinks = false
+
+			uaaUrl, err := DiscoverUAAUrl(http.DefaultClient, fakeUAA.URL()+"/")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(uaaUrl).To(Equal(fakeUAA.URL()))
+		})
+
+		It("assumes https when the API has no scheme", func() {
+			_, err := DiscoverUAAUrl(http.DefaultClient, strings.TrimPrefix(fakeUAA.URL(), "http://"))
+			Expect(err).To(MatchError(ContainSubstring("could not discover the UAA of https://")))
+		})
+	})
+
+	Describe("authentication", func() {
+		var uaa *UAAClient
+
+		BeforeEach(func() {
+			uaa = NewUAAClient(fakeUAA.URL()+"/", http.DefaultClient)
+			fakeUAA.AddClientCredentials("admin-client", "admin-secret")
+			fakeUAA.AddUser("admin", "uaa", "admin-password")
+		})
+
+		It("authenticates clients with the client credentials grant", func() {
+			Expect(uaa.AuthenticateClient("admin-client", "admin-secret")).To(Succeed())
+			Expect(fakeUAA.TokenRequests()).To(Equal([]string{"grant_type=client_credentials"}))
+		})
+
+		It("authenticates users with the password grant of the cf client", func() {
+			Expect(uaa.AuthenticateUser("admin", "admin-password", "uaa")).To(Succeed())
+			Expect(fakeUAA.TokenRequests()).To(ConsistOf(And(
+				ContainSubstring("grant_type=password"),
+				ContainSubstring("username=admin"),
+				ContainSubstring("login_hint="),
+			)))
+		})
+
+		It("returns the UAA's error description", func() {
+			err := uaa.AuthenticateClient("admin-client", "wrong-secret")
+			Expect(err).To(MatchError("could not authenticate admin-client with the UAA: UAA returned status 401: Bad credentials"))
+		})
+
+		It("fails requests made without a token", func() {
+			err := uaa.DeleteClient("some-client")
+			Expect(err).To(MatchError(ContainSubstring("DELETE /oauth/clients/some-client: UAA returned status 401")))
+		})
+	})
+
+	Describe("clients and groups", func() {
+		var uaa *UAAClient
+
+		BeforeEach(func() {
+			fakeUAA.AddClientCredentials("admin-client", "admin-secret")
+			fakeUAA.AddUser("some-user", "uaa", "password")
+			fakeUAA.AddGroup("network.write")
+
+			uaa = NewUAAClient(fakeUAA.URL(), http.DefaultClient)
+			Expect(uaa.AuthenticateClient("admin-client", "admin-secret")).To(Succeed())
+		})
+
+		It("creates and deletes clients", func() {
+			Expect(uaa.CreateClient(OAuthClient{
+				ClientId:             "my-client",
+				ClientSecret:         "my-secret",
+				AuthorizedGrantTypes: []string{"client_credentials"},
+				Authorities:          []string{"cloud_controller.admin_read_only"},
+			})).To(Succeed())
+
+			client, ok := fakeUAA.Client("my-client")
+			Expect(ok).To(BeTrue())
+			Expect(client.AuthorizedGrantTypes).To(Equal([]string{"client_credentials"}))
+			Expect(client.Authorities).To(Equal([]string{"cloud_controller.admin_read_only"}))
+
+			Expect(uaa.DeleteClient("my-client")).To(Succeed())
+			_, ok = fakeUAA.Client("my-client")
+			Expect(ok).To(BeFalse())
+		})
+
+		It("adds users to groups and removes them", func() {
+			Expect(uaa.AddUserToGroup("some-user", "", "network.write")).To(Succeed())
+			Expect(fakeUAA.GroupMembers("network.write")).To(Equal([]string{"some-user"}))
+
+			Expect(uaa.RemoveUserFromGroup("some-user", "uaa", "network.write")).To(Succeed())
+			Expect(fakeUAA.GroupMembers("network.write")).To(BeEmpty())
+		})
+
+		It("fails for unknown users and groups", func() {
+			Expect(uaa.AddUserToGroup("other-user", "", "network.write")).To(MatchError("expected to find one user other-user, found 0"))
+			Expect(uaa.AddUserToGroup("some-user", "ldap", "network.write")).To(MatchError("expected to find one user some-user, found 0"))
+			Expect(uaa.AddUserToGroup("some-user", "", "network.admin")).To(MatchError("expected to find one group network.admin, found 0"))
+		})
+	})
+
+	Describe("token renewal", func() {
+		var uaa *UAAClient
+
+		BeforeEach(func() {
+			fakeUAA.AddClientCredentials("admin-client", "admin-secret")
+			uaa = NewUAAClient(fakeUAA.URL(), http.DefaultClient)
+		})
+
+		It("authenticates again when the UAA rejects the token", func() {
+			Expect(uaa.AuthenticateClient("admin-client", "admin-secret")).To(Succeed())
+			fakeUAA.RevokeTokens()
+
+			Expect(uaa.CreateClient(OAuthClient{ClientId: "my-client"})).To(Succeed())
+			Expect(fakeUAA.TokenRequests()).To(HaveLen(2))
+			_, ok := fakeUAA.Client("my-client")
+			Expect(ok).To(BeTrue())
+		})
+
+		It("authenticates again before using a token that is about to expire", func() {
+			fakeUAA.TokenExpiresIn = 30
+			Expect(uaa.AuthenticateClient("admin-client", "admin-secret")).To(Succeed())
+
+			Expect(uaa.CreateClient(OAuthClient{ClientId: "my-client"})).To(Succeed())
+			Expect(fakeUAA.TokenRequests()).To(HaveLen(2))
+		})
+
+		It("keeps using a token that is far from expiring", func() {
+			Expect(uaa.AuthenticateClient("admin-client", "admin-secret")).To(Succeed())
+
+			Expect(uaa.CreateClient(OAuthClient{ClientId: "my-client"})).To(Succeed())
+			Expect(uaa.DeleteClient("my-client")).To(Succeed())
+			Expect(fakeUAA.TokenRequests()).To(HaveLen(1))
+		})
+
+		It("fails when the credentials no longer work", func() {
+			Expect(uaa.AuthenticateClient("admin-client", "admin-secret")).To(Succeed())
+			fakeUAA.AddClientCredentials("admin-client", "rotated-secret")
+			fakeUAA.RevokeTokens()
+
+			err := uaa.DeleteClient("some-client")
+			Expect(err).To(MatchError("could not authenticate admin-client with the UAA: UAA returned status 401: Bad credentials"))
+		})
+	})
+
+	Describe("NewUAAHTTPClient", func() {
+		It("skips certificate validation when asked to", func() {
+			httpClient, err := NewUAAHTTPClient(&config.Config{}, true, time.Second)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(httpClient.Timeout).To(Equal(time.Second))
+			Expect(httpClient.Transport.(*http.Transport).TLSClientConfig.InsecureSkipVerify).To(BeTrue())
+		})
+
+		It("loads the TLS files of the config like the other Go clients", func() {
+			caCertFile := filepath.Join(GinkgoT().TempDir(), "ca.pem")
+			Expect(os.WriteFile(caCertFile, []byte("not a certificate"), 0600)).To(Succeed())
+
+			_, err := NewUAAHTTPClient(&config.Config{CACertFile: caCertFile}, false, time.Second)
+			Expect(err).To(MatchError("no certificates found in " + caCertFile))
+
+			_, err = NewUAAHTTPClient(&config.Config{ClientCertFile: caCertFile}, false, time.Second)
+			Expect(err).To(MatchError(ContainSubstring("could not load client certificate " + caCertFile)))
+		})
+	})
+
+	Describe("GenerateClientCredentials", func() {
+		It("prefixes the client id and generates a secret", func() {
+			clientId, clientSecret := GenerateClientCredentials("UNIT-TESTS")
+			Expect(clientId).To(MatchRegexp("UNIT-TESTS-[0-9]+-CLIENT-.*"))
+			Expect(clientSecret).To(HaveLen(20))
+		})
+	})
+})
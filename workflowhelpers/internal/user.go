@@ -81,6 +81,41 @@ func NewTestUser(config userConfig, cmdStarter internal.Starter) *TestUser {
 	}
 }
 
+// NewGeneratedTestUser always generates a new user, even when the config
+// asks for an existing one, for tests that need several users of their own.
+func NewGeneratedTestUser(config userConfig, cmdStarter internal.Starter) *TestUser {
+	password := generatePassword()
+	if config.GetConfigurableTestPassword() != "" {
+		password = config.GetConfigurableTestPassword()
+	}
+
+	return &TestUser{
+		username:       generator.PrefixedRandomName(config.GetNamePrefix(), "USER"),
+		password:       password,
+		origin:         config.GetUserOrigin(),
+		cmdStarter:     cmdStarter,
+		timeout:        config.GetScaledTimeout(1 * time.Minute),
+		shouldKeepUser: config.GetShouldKeepUser(),
+	}
+}
+
+// NewExistingTestUser refers to a user created elsewhere, such as by the
+// node that provisioned a space pool.
+func NewExistingTestUser(username, password, origin string, timeout time.Duration, cmdStarter internal.Starter) *TestUser {
+	return NewBaseTestUser(username, password, origin, timeout, cmdStarter, true)
+}
+
+func NewBaseTestUser(username, password, origin string, timeout time.Duration, cmdStarter internal.Starter, shouldKeepUser bool) *TestUser {
+	return &TestUser{
+		username:       username,
+		password:       password,
+		origin:         origin,
+		cmdStarter:     cmdStarter,
+		timeout:        timeout,
+		shouldKeepUser: shouldKeepUser,
+	}
+}
+
 func NewAdminUser(config AdminUserConfig, cmdStarter internal.Starter) *TestUser {
 	return &TestUser{
 		username:   config.GetAdminUser(),
@@ -123,10 +158,31 @@ func (user *TestUser) Destroy() {
 	gomega.EventuallyWithOffset(1, session, user.timeout).Should(gexec.Exit(0), "Failed to delete user")
 }
 
+// RegisterCleanup registers deleting the user with the teardown.
+func (user *TestUser) RegisterCleanup(teardown *Teardown) {
+	teardown.RegisterCf("delete user "+user.username, user.cmdStarter, user.timeout, "Failed to delete user", "delete-user", "-f", user.username)
+}
+
+func (user *TestUser) SetOrgRole(orgName, role string) {
+	session := internal.Cf(user.cmdStarter, "set-org-role", user.username, orgName, role)
+	gomega.EventuallyWithOffset(1, session, user.timeout).Should(gexec.Exit(0), "Failed to set org role "+role)
+}
+
+func (user *TestUser) SetSpaceRole(orgName, spaceName, role string) {
+	session := internal.Cf(user.cmdStarter, "set-space-role", user.username, orgName, spaceName, role)
+	gomega.EventuallyWithOffset(1, session, user.timeout).Should(gexec.Exit(0), "Failed to set space role "+role)
+}
+
 func (user *TestUser) Username() string {
 	return user.username
 }
 
+// SetCommandStarter makes the user's commands run with the starter, such as
+// the one of the admin context that creates and deletes the user.
+func (user *TestUser) SetCommandStarter(cmdStarter internal.Starter) {
+	user.cmdStarter = cmdStarter
+}
+
 func (user *TestUser) Password() string {
 	return user.password
 }
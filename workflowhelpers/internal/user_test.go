@@ -86,6 +86,23 @@ var _ = Describe("User", func() {
 		})
 	})
 
+	Describe("NewGeneratedTestUser", func() {
+		It("generates a user even when the config asks for an existing one", func() {
+			cfg = &config.Config{
+				NamePrefix:           "UNIT-TESTS",
+				UseExistingUser:      true,
+				ExistingUser:         "my-test-user",
+				ExistingUserPassword: "my-test-password",
+				UserOrigin:           "my-test-user-origin",
+			}
+
+			user := NewGeneratedTestUser(cfg, &fakes.FakeCmdStarter{})
+			Expect(user.Username()).To(MatchRegexp("UNIT-TESTS-[0-9]+-USER-.*"))
+			Expect(len(user.Password())).To(Equal(20))
+			Expect(user.Origin()).To(Equal("my-test-user-origin"))
+		})
+	})
+
 	Describe("NewAdminUser", func() {
 		It("copies the username and password from the config", func() {
 			cfg := &config.Config{AdminUser: "admin", AdminPassword: "admin-password"}
@@ -256,6 +273,41 @@ var _ = Describe("User", func() {
 		})
 	})
 
+	Describe("SetOrgRole and SetSpaceRole", func() {
+		var user *TestUser
+		var fakeStarter *fakes.FakeCmdStarter
+
+		BeforeEach(func() {
+			fakeStarter = fakes.NewFakeCmdStarter()
+			cfg = &config.Config{TimeoutScale: 1.0}
+			user = NewTestUser(cfg, fakeStarter)
+		})
+
+		It("sets the roles", func() {
+			user.SetOrgRole("my-org", "BillingManager")
+			user.SetSpaceRole("my-org", "my-space", "SpaceSupporter")
+
+			Expect(fakeStarter.CalledWith).To(HaveLen(2))
+			Expect(fakeStarter.CalledWith[0].Args).To(Equal([]string{"set-org-role", user.Username(), "my-org", "BillingManager"}))
+			Expect(fakeStarter.CalledWith[1].Args).To(Equal([]string{"set-space-role", user.Username(), "my-org", "my-space", "SpaceSupporter"}))
+		})
+
+		Context("when setting the role fails", func() {
+			BeforeEach(func() {
+				fakeStarter.ToReturn[0].ExitCode = 1
+			})
+
+			It("fails with a ginkgo error", func() {
+				failures := InterceptGomegaFailures(func() {
+					user.SetSpaceRole("my-org", "my-space", "SpaceSupporter")
+				})
+
+				Expect(failures).To(HaveLen(1))
+				Expect(failures[0]).To(MatchRegexp("(?s)Failed to set space role SpaceSupporter.*to match exit code:.*0"))
+			})
+		})
+	})
+
 	Describe("ShouldRemain", func() {
 		var user *TestUser
 		var fakeStarter *fakes.FakeCmdStarter
@@ -0,0 +1,94 @@
+package workflowhelpers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/ginkgo/v2/types"
+)
+
+type keepResourcesOnFailureConfig interface {
+	GetKeepResourcesOnFailure() bool
+}
+
+func keepResourcesOnFailure(config testSuiteConfig) bool {
+	keepConfig, ok := config.(keepResourcesOnFailureConfig)
+	return ok && keepConfig.GetKeepResourcesOnFailure()
+}
+
+// RecordSpecReport records whether the spec failed, for Teardown to keep the
+// resources of a failed suite. Suites call it from a ReportAfterEach of
+// their own, as it only sees the specs that ran on this Ginkgo node:
+//
+//	var _ = ReportAfterEach(func(report SpecReport) {
+//		testSetup.RecordSpecReport(report)
+//	})
+func (testSetup *ReproducibleTestSuiteSetup) RecordSpecReport(report types.SpecReport) {
+	testSetup.specReportRecorded = true
+	if report.Failed() {
+		testSetup.specFailed = true
+	}
+}
+
+// SpecFailed tells whether RecordSpecReport recorded a failed spec.
+func (testSetup *ReproducibleTestSuiteSetup) SpecFailed() bool {
+	return testSetup.specFailed
+}
+
+// keepsResources tells whether Teardown leaves the space and user in place.
+func (testSetup *ReproducibleTestSuiteSetup) keepsResources() bool {
+	if !testSetup.KeepResourcesOnFailure {
+		return false
+	}
+	if testSetup.HasFailed != nil {
+		return testSetup.HasFailed()
+	}
+	return testSetup.SpecFailed()
+}
+
+// warnUnlessSpecOutcomeKnown warns when KeepResourcesOnFailure cannot work
+// because neither HasFailed nor RecordSpecReport tell whether a spec failed.
+// A suite whose specs all ran on other nodes legitimately records nothing,
+// so this is not a failure.
+func (testSetup *ReproducibleTestSuiteSetup) warnUnlessSpecOutcomeKnown() {
+	if !testSetup.KeepResourcesOnFailure || testSetup.HasFailed != nil || testSetup.specReportRecorded {
+		return
+	}
+
+	ginkgo.AddReportEntry("Spec outcome unknown", "KeepResourcesOnFailure is set, but no spec report was recorded, so the test resources are deleted whether specs failed or not. Call RecordSpecReport from a ReportAfterEach, or set HasFailed.")
+}
+
+// reportKeptResources tells engineers where to find the resources Teardown
+// kept and how to log in, leaving the password out of the report.
+func (testSetup *ReproducibleTestSuiteSetup) reportKeptResources() {
+	regularUserContext := testSetup.regularUserContext
+	orgName := testSetup.TestSpace.OrganizationName()
+	spaceName := testSetup.TestSpace.SpaceName()
+	username := regularUserContext.TestUser.Username()
+
+	loginArgs := []string{"cf", "login", "-a", regularUserContext.ApiUrl}
+	if regularUserContext.SkipSSLValidation {
+		loginArgs = append(loginArgs, "--skip-ssl-validation")
+	}
+	loginArgs = append(loginArgs, "-u", username, "-p", "[REDACTED]")
+	if origin := regularUserContext.TestUser.Origin(); origin != "" {
+		loginArgs = append(loginArgs, "--origin", origin)
+	}
+	loginArgs = append(loginArgs, "-o", orgName, "-s", spaceName)
+	if regularUserContext.UseClientCredentials {
+		loginArgs = []string{"cf", "api", regularUserContext.ApiUrl, "&&", "cf", "auth", username, "[REDACTED]", "--client-credentials", "&&", "cf", "target", "-o", orgName, "-s", spaceName}
+	}
+
+	var message strings.Builder
+	fmt.Fprintf(&message, "A spec failed, so the test resources are kept for inspection:\n")
+	fmt.Fprintf(&message, "  org:   %s\n", orgName)
+	fmt.Fprintf(&message, "  space: %s\n", spaceName)
+	fmt.Fprintf(&message, "  user:  %s\n", username)
+	fmt.Fprintf(&message, "Log in with:\n  %s\n", strings.Join(loginArgs, " "))
+	if testSetup.StateFile != "" {
+		fmt.Fprintf(&message, "Delete them with TeardownFromState(%q) once done.\n", testSetup.StateFile)
+	}
+
+	ginkgo.AddReportEntry("Kept test resources", message.String(), ginkgo.ReportEntryVisibilityAlways)
+}
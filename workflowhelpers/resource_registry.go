@@ -0,0 +1,167 @@
+package workflowhelpers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cloudfoundry/cf-test-helpers/v2/workflowhelpers/internal"
+	"github.com/onsi/gomega"
+)
+
+// ExecutionContext is the user a registered resource is created and
+// destroyed as.
+type ExecutionContext int
+
+const (
+	// AdminExecution creates the resource as the admin, for brokers,
+	// security groups, shared domains, buildpacks and the like.
+	AdminExecution ExecutionContext = iota
+	// RegularUserExecution creates the resource as the regular user, in the
+	// suite's space.
+	RegularUserExecution
+)
+
+func (context ExecutionContext) String() string {
+	switch context {
+	case AdminExecution:
+		return "admin"
+	case RegularUserExecution:
+		return "regular user"
+	default:
+		return fmt.Sprintf("ExecutionContext(%d)", int(context))
+	}
+}
+
+// ResourceRegistry holds the resources a suite needs beyond its user and
+// space. Setup creates them once the space and user exist, each after the
+// resources it depends on, and Teardown destroys them in reverse.
+type ResourceRegistry struct {
+	resources []*registeredResource
+}
+
+type registeredResource struct {
+	name      string
+	resource  RemoteResource
+	context   ExecutionContext
+	dependsOn []string
+	created   bool
+}
+
+// Register adds a resource under a name unique to the suite, created after
+// the resources named in dependsOn.
+func (registry *ResourceRegistry) Register(name string, resource RemoteResource, context ExecutionContext, dependsOn ...string) {
+	gomega.ExpectWithOffset(1, registry.find(name)).To(gomega.BeNil(), fmt.Sprintf("resource %q is already registered", name))
+
+	registry.resources = append(registry.resources, &registeredResource{
+		name:      name,
+		resource:  resource,
+		context:   context,
+		dependsOn: dependsOn,
+	})
+}
+
+// Resource returns the resource registered under the name, or nil.
+func (registry *ResourceRegistry) Resource(name string) RemoteResource {
+	registered := registry.find(name)
+	if registered == nil {
+		return nil
+	}
+	return registered.resource
+}
+
+func (registry *ResourceRegistry) find(name string) *registeredResource {
+	for _, registered := range registry.resources {
+		if registered.name == name {
+			return registered
+		}
+	}
+	return nil
+}
+
+// creationOrder sorts the resources so that each comes after the resources
+// it depends on, and otherwise in the order they were registered.
+func (registry *ResourceRegistry) creationOrder() ([]*registeredResource, error) {
+	for _, registered := range registry.resources {
+		for _, dependency := range registered.dependsOn {
+			if registry.find(dependency) == nil {
+				return nil, fmt.Errorf("resource %q depends on unknown resource %q", registered.name, dependency)
+			}
+		}
+	}
+
+	var ordered []*registeredResource
+	placed := map[string]bool{}
+	for len(ordered) < len(registry.resources) {
+		progress := false
+		for _, registered := range registry.resources {
+			if placed[registered.name] || !allPlaced(registered.dependsOn, placed) {
+				continue
+			}
+			ordered = append(ordered, registered)
+			placed[registered.name] = true
+			progress = true
+			break
+		}
+
+		if !progress {
+			var cyclic []string
+			for _, registered := range registry.resources {
+				if !placed[registered.name] {
+					cyclic = append(cyclic, registered.name)
+				}
+			}
+			return nil, fmt.Errorf("resources depend on each other in a cycle: %s", strings.Join(cyclic, ", "))
+		}
+	}
+	return ordered, nil
+}
+
+func allPlaced(names []string, placed map[string]bool) bool {
+	for _, name := range names {
+		if !placed[name] {
+			return false
+		}
+	}
+	return true
+}
+
+func (testSetup *ReproducibleTestSuiteSetup) createResources() {
+	ordered, _ := testSetup.Resources.creationOrder()
+
+	for _, registered := range ordered {
+		// Marked before creating it, so that Teardown also destroys whatever
+		// a Create that fails part way left behind.
+		registered.created = true
+		AsUser(testSetup.executionContext(registered.context), testSetup.shortTimeout, registered.resource.Create)
+	}
+}
+
+// registerResourceCleanup registers destroying the resources Setup created
+// with the teardown, in the order they were created so that they are
+// destroyed in reverse.
+func (testSetup *ReproducibleTestSuiteSetup) registerResourceCleanup(teardown *internal.Teardown) {
+	ordered, err := testSetup.Resources.creationOrder()
+	if err != nil {
+		return
+	}
+
+	for _, registered := range ordered {
+		if !registered.created || registered.resource.ShouldRemain() {
+			continue
+		}
+
+		teardown.RegisterAssertions("destroy "+registered.name, func() {
+			AsUser(testSetup.executionContext(registered.context), testSetup.shortTimeout, registered.resource.Destroy)
+			registered.created = false
+		})
+	}
+}
+
+// executionContext is the context resources of the ExecutionContext are
+// created and destroyed as.
+func (testSetup *ReproducibleTestSuiteSetup) executionContext(context ExecutionContext) UserContext {
+	if context == AdminExecution {
+		return testSetup.AdminUserContext()
+	}
+	return testSetup.RegularUserContext()
+}
@@ -0,0 +1,184 @@
+package workflowhelpers_test
+
+import (
+	"os"
+	"time"
+
+	"github.com/cloudfoundry/cf-test-helpers/v2/config"
+	starterFakes "github.com/cloudfoundry/cf-test-helpers/v2/internal/fakes"
+	. "github.com/cloudfoundry/cf-test-helpers/v2/workflowhelpers"
+	"github.com/cloudfoundry/cf-test-helpers/v2/workflowhelpers/internal/fakes"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type recordedEvent struct {
+	Event  string
+	CfHome string
+}
+
+type recordingResource struct {
+	name    string
+	events  *[]recordedEvent
+	remain  bool
+	failing string
+}
+
+func (resource *recordingResource) Create() {
+	*resource.events = append(*resource.events, recordedEvent{"create " + resource.name, os.Getenv("CF_HOME")})
+	Expect(resource.failing).NotTo(Equal("create"), "failed to create "+resource.name)
+}
+
+func (resource *recordingResource) Destroy() {
+	*resource.events = append(*resource.events, recordedEvent{"destroy " + resource.name, os.Getenv("CF_HOME")})
+}
+
+func (resource *recordingResource) ShouldRemain() bool {
+	return resource.remain
+}
+
+var _ = Describe("ResourceRegistry", func() {
+	var events []recordedEvent
+	var regularUserCmdStarter *starterFakes.FakeCmdStarter
+	var testSetup *ReproducibleTestSuiteSetup
+
+	var newResource = func(name string) *recordingResource {
+		return &recordingResource{name: name, events: &events}
+	}
+
+	var eventNames = func() []string {
+		var names []string
+		for _, event := range events {
+			names = append(names, event.Event)
+		}
+		return names
+	}
+
+	var newCmdStarter = func() *starterFakes.FakeCmdStarter {
+		cmdStarter := starterFakes.NewFakeCmdStarter()
+		for i := 0; i < 3; i++ {
+			cmdStarter.ToReturn = append(cmdStarter.ToReturn, cmdStarter.ToReturn...)
+		}
+		return cmdStarter
+	}
+
+	BeforeEach(func() {
+		events = nil
+		regularUserCmdStarter = newCmdStarter()
+
+		regularUserContext := UserContext{
+			ApiUrl:         "api-url.com",
+			CommandStarter: regularUserCmdStarter,
+			TestUser:       fakes.NewFakeUserValues("username", "password", ""),
+			Timeout:        2 * time.Second,
+			TestSpace:      fakes.NewFakeSpaceValues("org", "space"),
+		}
+		adminUserContext := UserContext{
+			ApiUrl:         "api-url.com",
+			CommandStarter: newCmdStarter(),
+			TestUser:       fakes.NewFakeUserValues("admin", "admin", ""),
+			Timeout:        2 * time.Second,
+		}
+
+		testSetup = NewBaseTestSuiteSetup(&config.Config{}, &fakes.FakeSpace{}, &fakes.FakeRemoteResource{}, regularUserContext, adminUserContext, false)
+	})
+
+	It("creates the resources after their dependencies and destroys them in reverse", func() {
+		testSetup.Resources.Register("service instance", newResource("service instance"), RegularUserExecution, "broker")
+		testSetup.Resources.Register("broker", newResource("broker"), AdminExecution, "security group")
+		testSetup.Resources.Register("security group", newResource("security group"), AdminExecution)
+		testSetup.Resources.Register("buildpack", newResource("buildpack"), AdminExecution)
+
+		testSetup.Setup()
+		Expect(eventNames()).To(Equal([]string{
+			"create security group",
+			"create broker",
+			"create service instance",
+			"create buildpack",
+		}))
+
+		events = nil
+		testSetup.Teardown()
+		Expect(eventNames()).To(Equal([]string{
+			"destroy buildpack",
+			"destroy service instance",
+			"destroy broker",
+			"destroy security group",
+		}))
+	})
+
+	It("creates and destroys admin resources as the admin and the others as the regular user", func() {
+		testSetup.IsolateCfHomes = true
+		testSetup.Resources.Register("buildpack", newResource("buildpack"), AdminExecution)
+		testSetup.Resources.Register("app", newResource("app"), RegularUserExecution)
+
+		testSetup.Setup()
+		adminCfHome := testSetup.AdminUserContext().CfHomeDir
+		regularCfHome := testSetup.RegularUserContext().CfHomeDir
+		Expect(events).To(Equal([]recordedEvent{
+			{"create buildpack", adminCfHome},
+			{"create app", regularCfHome},
+		}))
+		Expect(regularUserCmdStarter.CalledWith[1].Args).To(Equal([]string{"auth", "username", "password"}))
+		Expect(regularUserCmdStarter.CalledWith[1].Env).To(Equal([]string{"CF_HOME=" + regularCfHome}))
+
+		events = nil
+		testSetup.Teardown()
+		Expect(events).To(Equal([]recordedEvent{
+			{"destroy app", regularCfHome},
+			{"destroy buildpack", adminCfHome},
+		}))
+	})
+
+	It("destroys a resource whose creation failed part way, but none that should remain or were not created", func() {
+		remaining := newResource("remaining")
+		remaining.remain = true
+		failing := newResource("failing")
+		failing.failing = "create"
+
+		testSetup.Resources.Register("remaining", remaining, AdminExecution)
+		testSetup.Resources.Register("failing", failing, AdminExecution)
+		testSetup.Resources.Register("dependent", newResource("dependent"), AdminExecution, "failing")
+
+		Expect(InterceptGomegaFailure(testSetup.Setup)).To(MatchError(ContainSubstring("failed to create failing")))
+		events = nil
+
+		testSetup.Teardown()
+		Expect(eventNames()).To(Equal([]string{"destroy failing"}))
+	})
+
+	It("returns the registered resources by name", func() {
+		broker := newResource("broker")
+		testSetup.Resources.Register("broker", broker, AdminExecution)
+
+		Expect(testSetup.Resources.Resource("broker")).To(BeIdenticalTo(broker))
+		Expect(testSetup.Resources.Resource("unknown")).To(BeNil())
+	})
+
+	It("fails to register a name twice", func() {
+		testSetup.Resources.Register("broker", newResource("broker"), AdminExecution)
+
+		failures := InterceptGomegaFailures(func() {
+			testSetup.Resources.Register("broker", newResource("broker"), AdminExecution)
+		})
+		Expect(failures).To(ConsistOf(ContainSubstring(`resource "broker" is already registered`)))
+	})
+
+	It("fails before creating anything for unknown dependencies", func() {
+		testSetup.Resources.Register("broker", newResource("broker"), AdminExecution, "app")
+
+		err := InterceptGomegaFailure(testSetup.Setup)
+		Expect(err).To(MatchError(ContainSubstring(`resource "broker" depends on unknown resource "app"`)))
+		Expect(testSetup.TestSpace.(*fakes.FakeSpace).CreateCallCount()).To(Equal(0))
+	})
+
+	It("fails before creating anything for dependency cycles", func() {
+		testSetup.Resources.Register("buildpack", newResource("buildpack"), AdminExecution)
+		testSetup.Resources.Register("broker", newResource("broker"), AdminExecution, "app")
+		testSetup.Resources.Register("app", newResource("app"), RegularUserExecution, "broker")
+
+		err := InterceptGomegaFailure(testSetup.Setup)
+		Expect(err).To(MatchError(ContainSubstring("resources depend on each other in a cycle: broker, app")))
+		Expect(events).To(BeEmpty())
+	})
+})
@@ -0,0 +1,23 @@
+package workflowhelpers
+
+type RoleAssignmentMode int
+
+const (
+	// LenientRoleAssignment skips roles the acting user is not authorized to
+	// assign, recording them in the Ginkgo report, and fails on any other
+	// error.
+	LenientRoleAssignment RoleAssignmentMode = iota
+
+	// StrictRoleAssignment fails on any error.
+	StrictRoleAssignment
+)
+
+// RoleAssignmentResult is the outcome of assigning a single role. Verified is
+// only set when the context verifies role assignments.
+type RoleAssignmentResult struct {
+	Role     SpaceRole
+	Assigned bool
+	Skipped  bool
+	Reason   string
+	Verified bool
+}
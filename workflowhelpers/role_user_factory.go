@@ -0,0 +1,135 @@
+package workflowhelpers
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry/cf-test-helpers/v2/workflowhelpers/internal"
+)
+
+type OrgRole string
+
+const (
+	OrgManager     OrgRole = "OrgManager"
+	BillingManager OrgRole = "BillingManager"
+	OrgAuditor     OrgRole = "OrgAuditor"
+)
+
+type SpaceRole string
+
+const (
+	SpaceManager   SpaceRole = "SpaceManager"
+	SpaceDeveloper SpaceRole = "SpaceDeveloper"
+	SpaceAuditor   SpaceRole = "SpaceAuditor"
+	SpaceSupporter SpaceRole = "SpaceSupporter"
+)
+
+// UserRoles is the exact set of roles a user created by a RoleUserFactory
+// holds. A user without roles is not even a member of the org.
+type UserRoles struct {
+	OrgRoles   []OrgRole
+	SpaceRoles []SpaceRole
+}
+
+type roleUserFactoryConfig interface {
+	internal.UserConfig
+
+	GetNamePrefix() string
+	GetScaledTimeout(time.Duration) time.Duration
+}
+
+// RoleUserFactory creates users holding exactly the given roles in the test
+// space and its org, so that permission tests can check what each role is and
+// is not allowed to do.
+type RoleUserFactory struct {
+	config           roleUserFactoryConfig
+	adminUserContext UserContext
+	testSpace        spaceValues
+
+	lock       sync.Mutex
+	users      []*internal.TestUser
+	cfHomeDirs []string
+}
+
+func NewRoleUserFactory(config roleUserFactoryConfig, adminUserContext UserContext, testSpace spaceValues) *RoleUserFactory {
+	return &RoleUserFactory{
+		config:           config,
+		adminUserContext: adminUserContext,
+		testSpace:        testSpace,
+	}
+}
+
+// CreateUser creates a user as admin, gives it the roles and returns a
+// context for it. The context targets the test space only when the user holds
+// a space role, since targeting fails for users who cannot see the space.
+// When the admin context has a CF_HOME of its own, so does the returned one.
+func (factory *RoleUserFactory) CreateUser(roles UserRoles) UserContext {
+	testUser := internal.NewGeneratedTestUser(factory.config, factory.adminUserContext.commandStarter())
+
+	factory.lock.Lock()
+	factory.users = append(factory.users, testUser)
+	factory.lock.Unlock()
+
+	orgName := factory.testSpace.OrganizationName()
+	spaceName := factory.testSpace.SpaceName()
+
+	AsUser(factory.adminUserContext, factory.adminUserContext.Timeout, func() {
+		testUser.Create()
+		for _, role := range roles.OrgRoles {
+			testUser.SetOrgRole(orgName, string(role))
+		}
+		for _, role := range roles.SpaceRoles {
+			testUser.SetSpaceRole(orgName, spaceName, string(role))
+		}
+	})
+
+	var testSpace spaceValues
+	if len(roles.SpaceRoles) > 0 {
+		testSpace = factory.testSpace
+	}
+
+	userContext := NewUserContext(factory.adminUserContext.ApiUrl, testUser, testSpace, factory.adminUserContext.SkipSSLValidation, factory.adminUserContext.Timeout)
+	userContext.CommandStarter = factory.adminUserContext.CommandStarter
+	userContext.Org = orgName
+
+	if factory.adminUserContext.CfHomeDir != "" {
+		userContext = userContext.WithIsolatedCfHome()
+
+		factory.lock.Lock()
+		factory.cfHomeDirs = append(factory.cfHomeDirs, userContext.CfHomeDir)
+		factory.lock.Unlock()
+	}
+
+	return userContext
+}
+
+// Cleanup deletes every user the factory created, unless the config asks to
+// keep users, and the CF_HOMEs of their contexts.
+func (factory *RoleUserFactory) Cleanup() {
+	factory.lock.Lock()
+	users := factory.users
+	cfHomeDirs := factory.cfHomeDirs
+	factory.users = nil
+	factory.cfHomeDirs = nil
+	factory.lock.Unlock()
+
+	for _, cfHomeDir := range cfHomeDirs {
+		err := os.RemoveAll(cfHomeDir)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	if len(users) == 0 {
+		return
+	}
+
+	AsUser(factory.adminUserContext, factory.adminUserContext.Timeout, func() {
+		for _, user := range users {
+			if !user.ShouldRemain() {
+				user.Destroy()
+			}
+		}
+	})
+}
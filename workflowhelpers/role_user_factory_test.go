@@ -0,0 +1,142 @@
+package workflowhelpers_test
+
+import (
+	"time"
+
+	"github.com/cloudfoundry/cf-test-helpers/v2/config"
+	"github.com/cloudfoundry/cf-test-helpers/v2/internal/fakes"
+	. "github.com/cloudfoundry/cf-test-helpers/v2/workflowhelpers"
+	"github.com/cloudfoundry/cf-test-helpers/v2/workflowhelpers/internal"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RoleUserFactory", func() {
+	var cfg config.Config
+	var fakeStarter *fakes.FakeCmdStarter
+	var adminUserContext UserContext
+	var factory *RoleUserFactory
+
+	var cfCommands = func() [][]string {
+		var commands [][]string
+		for _, call := range fakeStarter.CalledWith {
+			commands = append(commands, call.Args)
+		}
+		return commands
+	}
+
+	BeforeEach(func() {
+		cfg = config.Config{
+			NamePrefix:    "UNIT-TESTS",
+			TimeoutScale:  1.0,
+			AdminUser:     "admin",
+			AdminPassword: "admin-password",
+		}
+
+		fakeStarter = fakes.NewFakeCmdStarter()
+		fakeStarter.ToReturn = append(fakeStarter.ToReturn, fakeStarter.ToReturn...)
+
+		adminUserContext = NewUserContext("api.my-cf.com", internal.NewAdminUser(&cfg, fakeStarter), nil, false, time.Minute)
+		adminUserContext.CommandStarter = fakeStarter
+	})
+
+	JustBeforeEach(func() {
+		testSpace := internal.NewBaseTestSpace("my-space", "my-org", "my-quota", "10G", true, true, time.Minute, fakeStarter)
+		factory = NewRoleUserFactory(&cfg, adminUserContext, testSpace)
+	})
+
+	It("creates a user with exactly the given roles as admin", func() {
+		userContext := factory.CreateUser(UserRoles{
+			OrgRoles:   []OrgRole{BillingManager},
+			SpaceRoles: []SpaceRole{SpaceSupporter, SpaceAuditor},
+		})
+
+		username := userContext.TestUser.Username()
+		Expect(username).To(MatchRegexp("UNIT-TESTS-[0-9]+-USER-.*"))
+		Expect(cfCommands()).To(ContainElements(
+			[]string{"create-user", username, userContext.TestUser.Password()},
+			[]string{"set-org-role", username, "my-org", "BillingManager"},
+			[]string{"set-space-role", username, "my-org", "my-space", "SpaceSupporter"},
+			[]string{"set-space-role", username, "my-org", "my-space", "SpaceAuditor"},
+		))
+		Expect(cfCommands()).NotTo(ContainElement(ContainElement("SpaceDeveloper")))
+		Expect(cfCommands()).To(ContainElement([]string{"auth", "admin", "admin-password"}))
+	})
+
+	It("returns a context for the user that targets the test space", func() {
+		userContext := factory.CreateUser(UserRoles{SpaceRoles: []SpaceRole{SpaceDeveloper}})
+
+		Expect(userContext.ApiUrl).To(Equal("api.my-cf.com"))
+		Expect(userContext.CommandStarter).To(Equal(fakeStarter))
+		Expect(userContext.Org).To(Equal("my-org"))
+		Expect(userContext.TestSpace.SpaceName()).To(Equal("my-space"))
+	})
+
+	It("does not target the space for users with only org roles", func() {
+		userContext := factory.CreateUser(UserRoles{OrgRoles: []OrgRole{OrgAuditor}})
+
+		Expect(userContext.Org).To(Equal("my-org"))
+		Expect(userContext.TestSpace).To(BeNil())
+	})
+
+	Context("when the admin context has a CF_HOME of its own", func() {
+		BeforeEach(func() {
+			adminUserContext = adminUserContext.WithIsolatedCfHome()
+			DeferCleanup(adminUserContext.RemoveCfHomeDir)
+		})
+
+		It("creates the user and gives it the roles in that CF_HOME", func() {
+			userContext := factory.CreateUser(UserRoles{OrgRoles: []OrgRole{OrgManager}})
+
+			Expect(fakeStarter.TotalCallsToStart).To(BeNumerically(">", 0))
+			for i := 0; i < fakeStarter.TotalCallsToStart; i++ {
+				if fakeStarter.CalledWith[i].Args[0] == "create-user" || fakeStarter.CalledWith[i].Args[0] == "set-org-role" {
+					Expect(fakeStarter.CalledWith[i].Env).To(Equal([]string{"CF_HOME=" + adminUserContext.CfHomeDir}))
+				}
+			}
+			Expect(cfCommands()).To(ContainElement([]string{"create-user", userContext.TestUser.Username(), userContext.TestUser.Password()}))
+		})
+
+		It("gives the user context a CF_HOME of its own until Cleanup", func() {
+			userContext := factory.CreateUser(UserRoles{})
+
+			Expect(userContext.CfHomeDir).NotTo(BeEmpty())
+			Expect(userContext.CfHomeDir).NotTo(Equal(adminUserContext.CfHomeDir))
+			Expect(userContext.CfHomeDir).To(BeADirectory())
+
+			factory.Cleanup()
+			Expect(userContext.CfHomeDir).NotTo(BeADirectory())
+			Expect(cfCommands()).To(ContainElement([]string{"delete-user", "-f", userContext.TestUser.Username()}))
+		})
+	})
+
+	Describe("Cleanup", func() {
+		It("deletes every user it created", func() {
+			first := factory.CreateUser(UserRoles{OrgRoles: []OrgRole{OrgManager}})
+			second := factory.CreateUser(UserRoles{})
+
+			factory.Cleanup()
+			Expect(cfCommands()).To(ContainElements(
+				[]string{"delete-user", "-f", first.TestUser.Username()},
+				[]string{"delete-user", "-f", second.TestUser.Username()},
+			))
+
+			calls := fakeStarter.TotalCallsToStart
+			factory.Cleanup()
+			Expect(fakeStarter.TotalCallsToStart).To(Equal(calls))
+		})
+
+		Context("when the config asks to keep users", func() {
+			BeforeEach(func() {
+				cfg.ShouldKeepUser = true
+			})
+
+			It("does not delete them", func() {
+				factory.CreateUser(UserRoles{})
+				factory.Cleanup()
+
+				Expect(cfCommands()).NotTo(ContainElement(ContainElement("delete-user")))
+			})
+		})
+	})
+})
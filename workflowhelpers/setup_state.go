@@ -0,0 +1,208 @@
+package workflowhelpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry/cf-test-helpers/v2/workflowhelpers/internal"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+// SetupState is what Setup records in its StateFile as it creates things, so
+// that an aborted run can be resumed or cleaned up, and a failed environment
+// inspected, once the random names are gone from memory.
+type SetupState struct {
+	RunID string `json:"run_id"`
+	Node  int    `json:"node"`
+	Api   string `json:"api"`
+
+	Organization         string `json:"organization"`
+	OrganizationGuid     string `json:"organization_guid,omitempty"`
+	ExistingOrganization bool   `json:"existing_organization"`
+	Space                string `json:"space"`
+	SpaceGuid            string `json:"space_guid,omitempty"`
+	ExistingSpace        bool   `json:"existing_space"`
+	Quota                string `json:"quota,omitempty"`
+
+	// The password of the user is never recorded. ResumeFromState logs in
+	// as a user Setup created with the test_password of the config.
+	User        string `json:"user"`
+	UserOrigin  string `json:"user_origin,omitempty"`
+	UserCreated bool   `json:"user_created"`
+	KeepUser    bool   `json:"keep_user"`
+
+	CfHomeDir      string `json:"cf_home_dir,omitempty"`
+	AdminCfHomeDir string `json:"admin_cf_home_dir,omitempty"`
+}
+
+type artifactsDirectoryConfig interface {
+	GetArtifactsDirectory() string
+}
+
+// defaultStateFile is setup-state-<node>.json in the artifacts directory of
+// configs that have one.
+func defaultStateFile(config testSuiteConfig) string {
+	artifactsConfig, ok := config.(artifactsDirectoryConfig)
+	if !ok || artifactsConfig.GetArtifactsDirectory() == "" {
+		return ""
+	}
+	return filepath.Join(artifactsConfig.GetArtifactsDirectory(), fmt.Sprintf("setup-state-%d.json", ginkgo.GinkgoParallelProcess()))
+}
+
+// ReadSetupState reads the state file of a run, for instance to look into
+// the environment a failed run left behind.
+func ReadSetupState(path string) (SetupState, error) {
+	var state SetupState
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return state, err
+	}
+
+	err = json.Unmarshal(contents, &state)
+	if err != nil {
+		return state, fmt.Errorf("invalid setup state in %s: %w", path, err)
+	}
+	return state, nil
+}
+
+// writeState replaces the StateFile with the current state. The file is
+// only readable by its owner, as it names the resources of the run.
+func (testSetup *ReproducibleTestSuiteSetup) writeState() {
+	if testSetup.StateFile == "" {
+		return
+	}
+
+	state := testSetup.currentState()
+	contents, err := json.MarshalIndent(state, "", "  ")
+	gomega.ExpectWithOffset(2, err).NotTo(gomega.HaveOccurred())
+
+	err = os.MkdirAll(filepath.Dir(testSetup.StateFile), 0755)
+	gomega.ExpectWithOffset(2, err).NotTo(gomega.HaveOccurred(), "Failed to write setup state")
+
+	tmpFile := testSetup.StateFile + ".tmp"
+	err = os.WriteFile(tmpFile, contents, 0600)
+	gomega.ExpectWithOffset(2, err).NotTo(gomega.HaveOccurred(), "Failed to write setup state")
+	err = os.Rename(tmpFile, testSetup.StateFile)
+	gomega.ExpectWithOffset(2, err).NotTo(gomega.HaveOccurred(), "Failed to write setup state")
+}
+
+func (testSetup *ReproducibleTestSuiteSetup) currentState() SetupState {
+	state := testSetup.state
+	state.RunID = testSetup.ownership.RunID
+	state.Node = ginkgo.GinkgoParallelProcess()
+	state.Api = testSetup.regularUserContext.ApiUrl
+
+	state.Organization = testSetup.TestSpace.OrganizationName()
+	state.Space = testSetup.TestSpace.SpaceName()
+	state.Quota = testSetup.TestSpace.QuotaName()
+	state.ExistingOrganization, state.ExistingSpace = true, true
+	if testSpace, ok := testSetup.TestSpace.(*internal.TestSpace); ok {
+		state.ExistingOrganization = testSpace.IsExistingOrganization()
+		state.ExistingSpace = testSpace.IsExistingSpace()
+	}
+
+	testUser := testSetup.regularUserContext.TestUser
+	state.User = testUser.Username()
+	state.UserOrigin = testUser.Origin()
+	state.UserCreated = !testSetup.SkipUserCreation && !testSetup.regularUserContext.UseClientCredentials
+	state.KeepUser = testSetup.TestUser.ShouldRemain()
+
+	state.CfHomeDir = testSetup.currentCfHomeDir
+	state.AdminCfHomeDir = testSetup.adminUserContext.CfHomeDir
+	return state
+}
+
+// recordGuids looks up the GUIDs of the org and space Setup created, as the
+// admin. Spaces other than a TestSpace are recorded by name only.
+func (testSetup *ReproducibleTestSuiteSetup) recordGuids() {
+	testSpace, ok := testSetup.TestSpace.(*internal.TestSpace)
+	if testSetup.StateFile == "" || !ok {
+		return
+	}
+
+	orgGuid, spaceGuid, err := testSpace.Guids()
+	gomega.ExpectWithOffset(2, err).NotTo(gomega.HaveOccurred(), "Failed to look up the GUIDs for the setup state")
+	testSetup.state.OrganizationGuid = orgGuid
+	testSetup.state.SpaceGuid = spaceGuid
+}
+
+func (testSetup *ReproducibleTestSuiteSetup) removeState() {
+	if testSetup.StateFile == "" {
+		return
+	}
+
+	err := os.Remove(testSetup.StateFile)
+	if err != nil && !os.IsNotExist(err) {
+		gomega.ExpectWithOffset(2, err).NotTo(gomega.HaveOccurred(), "Failed to remove setup state")
+	}
+}
+
+// ResumeFromState takes over the org, space and user an earlier run recorded
+// in the state file at path, instead of creating new ones, and logs in as
+// that user like Setup. Teardown deletes them as if this run created them.
+// Logging in as a user the earlier run created needs the test_password of
+// the config, as the state file does not record passwords.
+func (testSetup *ReproducibleTestSuiteSetup) ResumeFromState(path string) {
+	state := testSetup.restoreState(path)
+	gomega.ExpectWithOffset(1, !state.UserCreated || testSetup.configuredTestPassword != "").To(gomega.BeTrue(),
+		"Cannot log in as user %q from %s: set test_password in the config to resume a run that created its user", state.User, path)
+
+	testSetup.prepare()
+	testSetup.login()
+}
+
+// TeardownFromState deletes what an aborted run recorded in the state file
+// at path, along with the CF_HOME directories it left behind, and removes
+// the state file once everything is gone.
+func (testSetup *ReproducibleTestSuiteSetup) TeardownFromState(path string) {
+	state := testSetup.restoreState(path)
+
+	// The CF_HOME directories are registered first so that they are removed
+	// last, once the admin is done with them.
+	teardown := internal.NewTeardown(testSetup.TeardownOptions)
+	for _, cfHomeDir := range []string{state.CfHomeDir, state.AdminCfHomeDir} {
+		if cfHomeDir != "" {
+			teardown.Register("remove "+cfHomeDir, func() error {
+				return os.RemoveAll(cfHomeDir)
+			})
+		}
+	}
+	teardown.Register("tear down as admin", testSetup.teardownAsAdmin)
+
+	err := teardown.Run()
+	gomega.ExpectWithOffset(1, err).NotTo(gomega.HaveOccurred())
+	if err == nil {
+		testSetup.removeState()
+	}
+}
+
+func (testSetup *ReproducibleTestSuiteSetup) restoreState(path string) SetupState {
+	state, err := ReadSetupState(path)
+	gomega.ExpectWithOffset(2, err).NotTo(gomega.HaveOccurred(), "Failed to read setup state")
+
+	testSpace := internal.NewBaseTestSpace(state.Space, state.Organization, state.Quota, "", state.ExistingOrganization, state.ExistingSpace, testSetup.shortTimeout, testSetup.adminUserContext.commandStarter())
+	testSpace.TeardownOptions = testSetup.TeardownOptions
+	testSetup.TestSpace = testSpace
+	testSetup.regularUserContext.TestSpace = testSpace
+	testSetup.regularUserContext.Org = state.Organization
+	testSetup.regularUserContext.Space = state.Space
+
+	testSetup.SkipUserCreation = !state.UserCreated
+	if state.UserCreated {
+		testUser := internal.NewBaseTestUser(state.User, testSetup.configuredTestPassword, state.UserOrigin, testSetup.shortTimeout, testSetup.adminUserContext.commandStarter(), state.KeepUser)
+		testSetup.TestUser = testUser
+		testSetup.regularUserContext.TestUser = testUser
+		testSetup.regularUserContext.Username = state.User
+		testSetup.regularUserContext.Password = testSetup.configuredTestPassword
+		testSetup.regularUserContext.Origin = state.UserOrigin
+	}
+
+	testSetup.ownership.RunID = state.RunID
+	testSetup.state = state
+	testSetup.StateFile = path
+	return state
+}
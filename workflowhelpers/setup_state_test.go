@@ -0,0 +1,244 @@
+package workflowhelpers_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudfoundry/cf-test-helpers/v2/config"
+	starterFakes "github.com/cloudfoundry/cf-test-helpers/v2/internal/fakes"
+	. "github.com/cloudfoundry/cf-test-helpers/v2/workflowhelpers"
+	"github.com/cloudfoundry/cf-test-helpers/v2/workflowhelpers/internal"
+	"github.com/cloudfoundry/cf-test-helpers/v2/workflowhelpers/internal/fakes"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Setup state", func() {
+	var cfg config.Config
+	var artifactsDir, stateFile string
+	var regularUserCmdStarter, adminUserCmdStarter *starterFakes.FakeCmdStarter
+	var regularUserContext, adminUserContext UserContext
+	var testUser *fakes.FakeRemoteResource
+	var testSpace *internal.TestSpace
+	var testSetup *ReproducibleTestSuiteSetup
+
+	var adminCommandsNamed = func(name string) [][]string {
+		var commands [][]string
+		for _, call := range adminUserCmdStarter.CalledWith {
+			if call.Args[0] == name {
+				commands = append(commands, call.Args)
+			}
+		}
+		return commands
+	}
+
+	BeforeEach(func() {
+		artifactsDir = GinkgoT().TempDir()
+		stateFile = filepath.Join(artifactsDir, "setup-state-1.json")
+		cfg = config.Config{
+			NamePrefix:         "UNIT-TESTS",
+			TimeoutScale:       1,
+			ArtifactsDirectory: artifactsDir,
+		}
+
+		regularUserCmdStarter = starterFakes.NewFakeCmdStarter()
+		adminUserCmdStarter = starterFakes.NewFakeCmdStarter()
+		for i := 0; i < 2; i++ {
+			adminUserCmdStarter.ToReturn = append(adminUserCmdStarter.ToReturn, adminUserCmdStarter.ToReturn...)
+		}
+		for i := range adminUserCmdStarter.ToReturn {
+			adminUserCmdStarter.ToReturn[i].Output = `'{"resources":[{"guid":"some-guid"}]}'`
+		}
+
+		testSpace = internal.NewBaseTestSpace("space", "org", "quota", "10G", false, false, 2*time.Second, adminUserCmdStarter)
+		testUser = &fakes.FakeRemoteResource{}
+
+		regularUserContext = UserContext{
+			ApiUrl:         "api-url.com",
+			CommandStarter: regularUserCmdStarter,
+			TestUser:       fakes.NewFakeUserValues("username", "password", "uaa"),
+			TestSpace:      testSpace,
+			Timeout:        2 * time.Second,
+		}
+		adminUserContext = UserContext{
+			ApiUrl:         "api-url.com",
+			CommandStarter: adminUserCmdStarter,
+			TestUser:       fakes.NewFakeUserValues("admin", "admin", ""),
+			Timeout:        2 * time.Second,
+		}
+	})
+
+	JustBeforeEach(func() {
+		testSetup = NewBaseTestSuiteSetup(&cfg, testSpace, testUser, regularUserContext, adminUserContext, false)
+	})
+
+	Describe("Setup", func() {
+		It("records what it creates in the artifacts directory", func() {
+			Expect(testSetup.StateFile).To(Equal(stateFile))
+
+			testSetup.Setup()
+
+			state, err := ReadSetupState(testSetup.StateFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(state).To(Equal(SetupState{
+				RunID:            testSetup.RunID(),
+				Node:             1,
+				Api:              "api-url.com",
+				Organization:     "org",
+				OrganizationGuid: "some-guid",
+				Space:            "space",
+				SpaceGuid:        "some-guid",
+				Quota:            "quota",
+				User:             "username",
+				UserOrigin:       "uaa",
+				UserCreated:      true,
+				CfHomeDir:        os.Getenv("CF_HOME"),
+			}))
+
+			info, err := os.Stat(testSetup.StateFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+
+			contents, err := os.ReadFile(testSetup.StateFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).NotTo(ContainSubstring("password"))
+		})
+
+		It("records a user it did not create", func() {
+			testSetup.SkipUserCreation = true
+			testSetup.Setup()
+
+			state, err := ReadSetupState(testSetup.StateFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(state.User).To(Equal("username"))
+			Expect(state.UserCreated).To(BeFalse())
+		})
+
+		It("records nothing without an artifacts directory", func() {
+			cfg.ArtifactsDirectory = ""
+			testSetup = NewBaseTestSuiteSetup(&cfg, testSpace, testUser, regularUserContext, adminUserContext, false)
+			Expect(testSetup.StateFile).To(BeEmpty())
+
+			testSetup.Setup()
+			Expect(stateFile).NotTo(BeAnExistingFile())
+		})
+	})
+
+	Describe("Teardown", func() {
+		It("removes the state file", func() {
+			testSetup.Setup()
+			testSetup.Teardown()
+			Expect(testSetup.StateFile).NotTo(BeAnExistingFile())
+		})
+
+		It("keeps the state file when the resources are kept on failure", func() {
+			testSetup.KeepResourcesOnFailure = true
+			testSetup.HasFailed = func() bool { return true }
+			testSetup.Setup()
+
+			testSetup.Teardown()
+			Expect(testSetup.StateFile).To(BeAnExistingFile())
+			Expect(adminCommandsNamed("delete-org")).To(BeEmpty())
+		})
+
+		It("keeps the state file when a cleanup step fails", func() {
+			testUser.DestroyFailure = "user is still logged in"
+			testSetup.Setup()
+
+			InterceptGomegaFailures(testSetup.Teardown)
+			Expect(testSetup.StateFile).To(BeAnExistingFile())
+		})
+	})
+
+	Context("with the state file of an earlier run", func() {
+		var statePath, cfHomeDir string
+
+		BeforeEach(func() {
+			cfHomeDir = GinkgoT().TempDir()
+			statePath = filepath.Join(artifactsDir, "aborted-run.json")
+
+			contents, err := json.Marshal(SetupState{
+				RunID:        "earlier-run",
+				Organization: "earlier-org",
+				Space:        "earlier-space",
+				Quota:        "earlier-quota",
+				User:         "earlier-user",
+				UserOrigin:   "uaa",
+				UserCreated:  true,
+				CfHomeDir:    cfHomeDir,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.WriteFile(statePath, contents, 0600)).To(Succeed())
+		})
+
+		Describe("ResumeFromState", func() {
+			BeforeEach(func() {
+				cfg.ConfigurableTestPassword = "earlier-password"
+			})
+
+			It("logs in as the recorded user and targets the recorded space without creating anything", func() {
+				testSetup.ResumeFromState(statePath)
+
+				Expect(adminCommandsNamed("create-org")).To(BeEmpty())
+				Expect(adminCommandsNamed("create-space")).To(BeEmpty())
+				Expect(testUser.CreateCallCount()).To(Equal(0))
+
+				var regularCommands [][]string
+				for _, call := range regularUserCmdStarter.CalledWith {
+					regularCommands = append(regularCommands, call.Args)
+				}
+				Expect(regularCommands).To(Equal([][]string{
+					{"api", "api-url.com"},
+					{"auth", "earlier-user", "earlier-password", "--origin", "uaa"},
+					{"target", "-o", "earlier-org", "-s", "earlier-space"},
+				}))
+
+				Expect(testSetup.RunID()).To(Equal("earlier-run"))
+				Expect(testSetup.GetOrganizationName()).To(Equal("earlier-org"))
+				Expect(testSetup.StateFile).To(Equal(statePath))
+			})
+
+			It("tears down what the earlier run created", func() {
+				testSetup.ResumeFromState(statePath)
+				testSetup.Teardown()
+
+				Expect(adminCommandsNamed("delete-org")).To(Equal([][]string{{"delete-org", "-f", "earlier-org"}}))
+				Expect(adminCommandsNamed("delete-user")).To(Equal([][]string{{"delete-user", "-f", "earlier-user"}}))
+				Expect(statePath).NotTo(BeAnExistingFile())
+			})
+
+			It("fails without the test password of the created user", func() {
+				cfg.ConfigurableTestPassword = ""
+				testSetup = NewBaseTestSuiteSetup(&cfg, testSpace, testUser, regularUserContext, adminUserContext, false)
+
+				err := InterceptGomegaFailure(func() {
+					testSetup.ResumeFromState(statePath)
+				})
+				Expect(err).To(MatchError(ContainSubstring("set test_password in the config")))
+				Expect(regularUserCmdStarter.CalledWith).To(BeEmpty())
+			})
+		})
+
+		Describe("TeardownFromState", func() {
+			It("deletes what the earlier run created and the state file, without the user's password", func() {
+				testSetup.TeardownFromState(statePath)
+
+				Expect(adminCommandsNamed("delete-quota")).To(Equal([][]string{{"delete-quota", "-f", "earlier-quota"}}))
+				Expect(adminCommandsNamed("delete-org")).To(Equal([][]string{{"delete-org", "-f", "earlier-org"}}))
+				Expect(adminCommandsNamed("delete-user")).To(Equal([][]string{{"delete-user", "-f", "earlier-user"}}))
+				Expect(testUser.DestroyCallCount()).To(Equal(0))
+				Expect(cfHomeDir).NotTo(BeADirectory())
+				Expect(statePath).NotTo(BeAnExistingFile())
+			})
+
+			It("fails for a missing state file", func() {
+				failures := InterceptGomegaFailures(func() {
+					testSetup.TeardownFromState(filepath.Join(artifactsDir, "missing.json"))
+				})
+				Expect(failures).To(ContainElement(ContainSubstring("Failed to read setup state")))
+			})
+		})
+	})
+})
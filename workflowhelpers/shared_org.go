@@ -0,0 +1,147 @@
+package workflowhelpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/cloudfoundry/cf-test-helpers/v2/generator"
+	"github.com/cloudfoundry/cf-test-helpers/v2/workflowhelpers/internal"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+// SharedOrg is created once by node 1 for all the parallel nodes of a
+// suite, each of which then only creates its own space and user in it:
+//
+//	var sharedOrg *workflowhelpers.SharedOrg
+//
+//	var _ = SynchronizedBeforeSuite(func() []byte {
+//		sharedOrg = workflowhelpers.NewSharedOrg(cfg)
+//		return sharedOrg.Create()
+//	}, func(data []byte) {
+//		testSetup = workflowhelpers.NewSharedOrgTestSuiteSetup(cfg, data)
+//		testSetup.Setup()
+//	})
+//
+//	var _ = SynchronizedAfterSuite(func() {
+//		testSetup.Teardown()
+//	}, func() {
+//		sharedOrg.Destroy()
+//	})
+type SharedOrg struct {
+	// NodeSpaces makes node 1 create the space and user of every node too,
+	// in parallel, so that the Setup of the nodes only logs in.
+	NodeSpaces bool
+
+	// QuotaTotalMemoryLimit limits the org, 10G per node by default.
+	QuotaTotalMemoryLimit string
+
+	config           testSuiteConfig
+	adminUserContext UserContext
+	ownership        Ownership
+	timeout          time.Duration
+
+	orgSpace *internal.TestSpace
+	pool     *SpacePoolManager
+}
+
+func NewSharedOrg(config testSuiteConfig) *SharedOrg {
+	return NewBaseSharedOrg(config, newAdminUserContext(config))
+}
+
+func NewBaseSharedOrg(config testSuiteConfig, adminUserContext UserContext) *SharedOrg {
+	return &SharedOrg{
+		QuotaTotalMemoryLimit: fmt.Sprintf("%dG", 10*parallelNodes()),
+
+		config:           config,
+		adminUserContext: adminUserContext,
+		ownership:        internal.NewOwnership(config.GetNamePrefix()),
+		timeout:          config.GetScaledTimeout(1 * time.Minute),
+	}
+}
+
+// Create creates the quota and org, unless the config asks for an existing
+// org, and returns their names for SynchronizedBeforeSuite to share with
+// every node.
+func (shared *SharedOrg) Create() []byte {
+	if shared.NodeSpaces {
+		shared.pool = NewBaseSpacePoolManager(shared.config, shared.adminUserContext, parallelNodes())
+		shared.pool.QuotaTotalMemoryLimit = shared.QuotaTotalMemoryLimit
+		shared.pool.ownership = shared.ownership
+		return shared.pool.Provision()
+	}
+
+	orgName := generator.PrefixedRandomName(shared.config.GetNamePrefix(), "ORG")
+	if shared.config.GetUseExistingOrganization() {
+		orgName = shared.config.GetExistingOrganization()
+	}
+
+	shared.orgSpace = internal.NewBaseTestSpace(
+		"",
+		orgName,
+		generator.PrefixedRandomName(shared.config.GetNamePrefix(), "QUOTA"),
+		shared.QuotaTotalMemoryLimit,
+		shared.config.GetUseExistingOrganization(),
+		false,
+		shared.timeout,
+		shared.adminUserContext.CommandStarter,
+	)
+	shared.orgSpace.OwnershipLabels = shared.ownership.Labels()
+
+	AsUser(shared.adminUserContext, shared.timeout, shared.orgSpace.CreateOrganization)
+
+	data, err := json.Marshal(&PooledSpaces{
+		RunID: shared.ownership.RunID,
+		Org:   shared.orgSpace.OrganizationName(),
+		Quota: shared.orgSpace.QuotaName(),
+	})
+	gomega.ExpectWithOffset(1, err).NotTo(gomega.HaveOccurred())
+	return data
+}
+
+// Destroy deletes the org and quota, and the spaces and users of the nodes
+// when node 1 created them, once every node has torn down.
+func (shared *SharedOrg) Destroy() {
+	if shared.pool != nil {
+		shared.pool.Teardown()
+		return
+	}
+	if shared.orgSpace == nil || shared.config.GetUseExistingOrganization() {
+		return
+	}
+
+	AsUser(shared.adminUserContext, shared.timeout, shared.orgSpace.Destroy)
+}
+
+// NewSharedOrgTestSuiteSetup sets a node up in the org SharedOrg created.
+// The node creates its own space and user, unless node 1 created them.
+func NewSharedOrgTestSuiteSetup(config testSuiteConfig, data []byte) *ReproducibleTestSuiteSetup {
+	pool := ClaimPooledSpaces(data)
+	if len(pool.Spaces) > 0 {
+		return NewPooledTestSuiteSetup(config, pool)
+	}
+
+	testSpace := internal.NewBaseTestSpace(
+		generator.PrefixedRandomName(config.GetNamePrefix(), "SPACE"),
+		pool.Org,
+		pool.Quota,
+		"",
+		true,
+		false,
+		config.GetScaledTimeout(1*time.Minute),
+		internal.NewCommandStarter(config),
+	)
+
+	testSetup := NewTestContextSuiteSetup(config, testSpace, config.GetUseExistingUser())
+	testSetup.ownership.RunID = pool.RunID
+	return testSetup
+}
+
+func parallelNodes() int {
+	suiteConfig, _ := ginkgo.GinkgoConfiguration()
+	if suiteConfig.ParallelTotal < 1 {
+		return 1
+	}
+	return suiteConfig.ParallelTotal
+}
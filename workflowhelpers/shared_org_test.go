@@ -0,0 +1,138 @@
+package workflowhelpers_test
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/cloudfoundry/cf-test-helpers/v2/config"
+	starterFakes "github.com/cloudfoundry/cf-test-helpers/v2/internal/fakes"
+	. "github.com/cloudfoundry/cf-test-helpers/v2/workflowhelpers"
+	"github.com/cloudfoundry/cf-test-helpers/v2/workflowhelpers/internal/fakes"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SharedOrg", func() {
+	var cfg config.Config
+	var adminUserCmdStarter *starterFakes.FakeCmdStarter
+	var sharedOrg *SharedOrg
+
+	var commandsNamed = func(name string) [][]string {
+		var commands [][]string
+		for _, call := range adminUserCmdStarter.CalledWith {
+			if call.Args[0] == name {
+				commands = append(commands, call.Args)
+			}
+		}
+		return commands
+	}
+
+	BeforeEach(func() {
+		cfg = config.Config{
+			NamePrefix:   "UNIT-TESTS",
+			TimeoutScale: 1,
+			ApiEndpoint:  "api-url.com",
+		}
+
+		adminUserCmdStarter = starterFakes.NewFakeCmdStarter()
+		for i := 0; i < 3; i++ {
+			adminUserCmdStarter.ToReturn = append(adminUserCmdStarter.ToReturn, adminUserCmdStarter.ToReturn...)
+		}
+		for i := range adminUserCmdStarter.ToReturn {
+			adminUserCmdStarter.ToReturn[i].Output = `'{"resources":[{"guid":"some-guid"}]}'`
+		}
+
+		adminUserContext := UserContext{
+			ApiUrl:         "api-url.com",
+			CommandStarter: adminUserCmdStarter,
+			TestUser:       fakes.NewFakeUserValues("admin", "admin", ""),
+			Timeout:        2 * time.Second,
+		}
+
+		sharedOrg = NewBaseSharedOrg(&cfg, adminUserContext)
+	})
+
+	Describe("Create", func() {
+		It("creates the org and quota but no space", func() {
+			var pool PooledSpaces
+			Expect(json.Unmarshal(sharedOrg.Create(), &pool)).To(Succeed())
+
+			Expect(pool.Org).To(MatchRegexp("UNIT-TESTS-[0-9]+-ORG-.*"))
+			Expect(pool.Quota).To(MatchRegexp("UNIT-TESTS-[0-9]+-QUOTA-.*"))
+			Expect(pool.RunID).NotTo(BeEmpty())
+			Expect(pool.Spaces).To(BeEmpty())
+
+			Expect(commandsNamed("create-quota")).To(HaveLen(1))
+			Expect(commandsNamed("create-org")).To(Equal([][]string{{"create-org", pool.Org}}))
+			Expect(commandsNamed("set-quota")).To(Equal([][]string{{"set-quota", pool.Org, pool.Quota}}))
+			Expect(commandsNamed("create-space")).To(BeEmpty())
+		})
+
+		It("creates nothing when the config asks for an existing org", func() {
+			cfg.UseExistingOrganization = true
+			cfg.ExistingOrganization = "existing-org"
+			sharedOrg = NewBaseSharedOrg(&cfg, UserContext{
+				ApiUrl:         "api-url.com",
+				CommandStarter: adminUserCmdStarter,
+				TestUser:       fakes.NewFakeUserValues("admin", "admin", ""),
+				Timeout:        2 * time.Second,
+			})
+
+			var pool PooledSpaces
+			Expect(json.Unmarshal(sharedOrg.Create(), &pool)).To(Succeed())
+			Expect(pool.Org).To(Equal("existing-org"))
+			Expect(commandsNamed("create-org")).To(BeEmpty())
+			Expect(commandsNamed("create-quota")).To(BeEmpty())
+
+			sharedOrg.Destroy()
+			Expect(commandsNamed("delete-org")).To(BeEmpty())
+		})
+
+		It("creates a space and user for every node with NodeSpaces", func() {
+			sharedOrg.NodeSpaces = true
+
+			var pool PooledSpaces
+			Expect(json.Unmarshal(sharedOrg.Create(), &pool)).To(Succeed())
+			Expect(pool.Spaces).To(HaveLen(1))
+			Expect(commandsNamed("create-space")).To(HaveLen(1))
+			Expect(commandsNamed("create-user")).To(HaveLen(1))
+		})
+	})
+
+	Describe("Destroy", func() {
+		It("deletes the org and quota", func() {
+			var pool PooledSpaces
+			Expect(json.Unmarshal(sharedOrg.Create(), &pool)).To(Succeed())
+
+			sharedOrg.Destroy()
+
+			Expect(commandsNamed("delete-org")).To(Equal([][]string{{"delete-org", "-f", pool.Org}}))
+			Expect(commandsNamed("delete-quota")).To(Equal([][]string{{"delete-quota", "-f", pool.Quota}}))
+		})
+	})
+
+	Describe("NewSharedOrgTestSuiteSetup", func() {
+		It("sets the node up in a space of its own in the shared org", func() {
+			data := sharedOrg.Create()
+			var pool PooledSpaces
+			Expect(json.Unmarshal(data, &pool)).To(Succeed())
+
+			testSetup := NewSharedOrgTestSuiteSetup(&cfg, data)
+			Expect(testSetup.GetOrganizationName()).To(Equal(pool.Org))
+			Expect(testSetup.RegularUserContext().TestSpace.SpaceName()).To(MatchRegexp("UNIT-TESTS-[0-9]+-SPACE-.*"))
+			Expect(testSetup.SkipUserCreation).To(BeFalse())
+			Expect(testSetup.RunID()).To(Equal(pool.RunID))
+		})
+
+		It("uses the space node 1 created for the node with NodeSpaces", func() {
+			sharedOrg.NodeSpaces = true
+			data := sharedOrg.Create()
+			var pool PooledSpaces
+			Expect(json.Unmarshal(data, &pool)).To(Succeed())
+
+			testSetup := NewSharedOrgTestSuiteSetup(&cfg, data)
+			Expect(testSetup.RegularUserContext().TestSpace.SpaceName()).To(Equal(pool.Spaces[0].Space))
+			Expect(testSetup.SkipUserCreation).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,102 @@
+package workflowhelpers
+
+import (
+	"github.com/cloudfoundry/cf-test-helpers/v2/generator"
+	"github.com/cloudfoundry/cf-test-helpers/v2/workflowhelpers/internal"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+// SpacePool hands out spaces created ahead of time in the suite's org, so
+// that leasing a space does not wait for it to be created.
+type SpacePool interface {
+	// TakeSpace returns the name of a space nobody else uses, or false when
+	// the pool has run out.
+	TakeSpace() (string, bool)
+}
+
+// spaceReleaser is implemented by the SpacePools that need to know which of
+// their spaces LeaseSpace deleted, such as PooledSpaces.
+type spaceReleaser interface {
+	ReleaseSpace(space string)
+}
+
+// LeaseSpace gives the current spec a space of its own in the suite's org,
+// so that the apps, routes and service instances of one spec do not leak
+// into the next. Call it from a BeforeEach after Setup: it takes a space
+// from SpacePool, or creates one, gives the regular user the space roles
+// and targets it. The returned context and RegularUserContext refer to the
+// leased space until the spec ends, when DeferCleanup targets the suite's
+// space again and deletes the leased one with everything in it.
+func (testSetup *ReproducibleTestSuiteSetup) LeaseSpace() UserContext {
+	orgName := testSetup.TestSpace.OrganizationName()
+
+	spaceName, fromPool := "", false
+	if testSetup.SpacePool != nil {
+		spaceName, fromPool = testSetup.SpacePool.TakeSpace()
+	}
+	if !fromPool {
+		spaceName = generator.PrefixedRandomName(testSetup.namePrefix, "SPACE")
+	}
+
+	var leasedSpace *internal.TestSpace
+	AsUser(testSetup.AdminUserContext(), testSetup.shortTimeout, func() {
+		leasedSpace = internal.NewBaseTestSpace(spaceName, orgName, "", "", true, false, testSetup.shortTimeout, testSetup.adminUserContext.commandStarter())
+		leasedSpace.Options = leasedSpaceOptions(testSetup.TestSpace)
+		leasedSpace.OwnershipLabels = testSetup.OwnershipLabels()
+		leasedSpace.TeardownOptions = testSetup.TeardownOptions
+
+		if !fromPool {
+			leasedSpace.Create()
+		}
+
+		if !testSetup.regularUserContext.UseClientCredentials {
+			roleContext := testSetup.regularUserContext
+			roleContext.TestSpace = leasedSpace
+			roleContext.RoleAssignmentMode = testSetup.RoleAssignmentMode
+			roleContext.VerifyRoleAssignments = testSetup.VerifyRoleAssignments
+			roleContext.AssignSpaceRoles(SpaceManager, SpaceDeveloper, SpaceAuditor)
+		}
+	})
+
+	suiteContext := testSetup.regularUserContext
+	ginkgo.DeferCleanup(func() {
+		testSetup.regularUserContext = suiteContext
+
+		teardown := internal.NewTeardown(testSetup.TeardownOptions)
+		teardown.RegisterAssertions("delete leased space "+spaceName, func() {
+			AsUser(testSetup.AdminUserContext(), testSetup.shortTimeout, leasedSpace.Destroy)
+			if releaser, ok := testSetup.SpacePool.(spaceReleaser); ok && fromPool {
+				releaser.ReleaseSpace(spaceName)
+			}
+		})
+		teardown.RegisterAssertions("target suite space", suiteContext.TargetSpace)
+		gomega.Expect(teardown.Run()).To(gomega.Succeed())
+	})
+
+	leaseContext := testSetup.regularUserContext
+	leaseContext.TestSpace = leasedSpace
+	leaseContext.Org = orgName
+	leaseContext.Space = spaceName
+	testSetup.regularUserContext = leaseContext
+
+	leaseContext.TargetSpace()
+	return leaseContext
+}
+
+// leasedSpaceOptions are the options of the suite's space that apply to
+// every space in the org. Space quotas and feature flags stay with the
+// suite's space.
+func leasedSpaceOptions(suiteSpace internal.Space) SpaceOptions {
+	testSpace, ok := suiteSpace.(*internal.TestSpace)
+	if !ok {
+		return SpaceOptions{}
+	}
+
+	return SpaceOptions{
+		IsolationSegmentName: testSpace.Options.IsolationSegmentName,
+		SpaceLabels:          testSpace.Options.SpaceLabels,
+		SpaceAnnotations:     testSpace.Options.SpaceAnnotations,
+		EnableSSH:            testSpace.Options.EnableSSH,
+	}
+}
@@ -0,0 +1,133 @@
+package workflowhelpers_test
+
+import (
+	"time"
+
+	"github.com/cloudfoundry/cf-test-helpers/v2/config"
+	starterFakes "github.com/cloudfoundry/cf-test-helpers/v2/internal/fakes"
+	. "github.com/cloudfoundry/cf-test-helpers/v2/workflowhelpers"
+	"github.com/cloudfoundry/cf-test-helpers/v2/workflowhelpers/internal/fakes"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type fakeSpacePool struct {
+	spaces   []string
+	released []string
+}
+
+func (pool *fakeSpacePool) TakeSpace() (string, bool) {
+	if len(pool.spaces) == 0 {
+		return "", false
+	}
+	space := pool.spaces[0]
+	pool.spaces = pool.spaces[1:]
+	return space, true
+}
+
+func (pool *fakeSpacePool) ReleaseSpace(space string) {
+	pool.released = append(pool.released, space)
+}
+
+var _ = Describe("LeaseSpace", func() {
+	var regularUserCmdStarter, adminUserCmdStarter *starterFakes.FakeCmdStarter
+	var testSetup *ReproducibleTestSuiteSetup
+
+	var cfCommands = func(starter *starterFakes.FakeCmdStarter) [][]string {
+		var commands [][]string
+		for _, call := range starter.CalledWith {
+			commands = append(commands, call.Args)
+		}
+		return commands
+	}
+
+	var newTestSetup = func() {
+		regularUserCmdStarter = starterFakes.NewFakeCmdStarter()
+		adminUserCmdStarter = starterFakes.NewFakeCmdStarter()
+		adminUserCmdStarter.ToReturn = append(adminUserCmdStarter.ToReturn, adminUserCmdStarter.ToReturn...)
+		adminUserCmdStarter.ToReturn[3].Output = `'{"resources":[{"guid":"org-guid"}]}'`
+		adminUserCmdStarter.ToReturn[4].Output = `'{"resources":[{"guid":"space-guid"}]}'`
+
+		testSpace := &fakes.FakeSpace{}
+		testSpace.OrganizationNameReturns("org")
+		testSpace.SpaceNameReturns("suite-space")
+		suiteSpaceValues := fakes.NewFakeSpaceValues("org", "suite-space")
+
+		regularUserContext := UserContext{
+			ApiUrl:         "api-url.com",
+			CommandStarter: regularUserCmdStarter,
+			TestUser:       fakes.NewFakeUserValues("username", "password", ""),
+			Timeout:        2 * time.Second,
+			TestSpace:      suiteSpaceValues,
+			Org:            "org",
+			Space:          "suite-space",
+		}
+		adminUserContext := UserContext{
+			ApiUrl:         "api-url.com",
+			CommandStarter: adminUserCmdStarter,
+			TestUser:       fakes.NewFakeUserValues("admin", "admin", ""),
+			Timeout:        2 * time.Second,
+		}
+
+		cfg := config.Config{NamePrefix: "UNIT-TESTS", TimeoutScale: 1}
+		testSetup = NewBaseTestSuiteSetup(&cfg, testSpace, &fakes.FakeRemoteResource{}, regularUserContext, adminUserContext, false)
+	}
+
+	Describe("creating a space", Ordered, func() {
+		var leaseContext UserContext
+
+		BeforeAll(newTestSetup)
+
+		It("creates a labelled space in the suite's org, gives the user roles in it and targets it", func() {
+			leaseContext = testSetup.LeaseSpace()
+
+			spaceName := leaseContext.TestSpace.SpaceName()
+			Expect(spaceName).To(MatchRegexp("UNIT-TESTS-[0-9]+-SPACE-.*"))
+			Expect(leaseContext.Space).To(Equal(spaceName))
+			Expect(testSetup.RegularUserContext().TestSpace.SpaceName()).To(Equal(spaceName))
+
+			adminCommands := cfCommands(adminUserCmdStarter)
+			Expect(adminCommands[2]).To(Equal([]string{"create-space", "-o", "org", spaceName}))
+			Expect(adminCommands[5][:4]).To(Equal([]string{"curl", "/v3/spaces/space-guid", "-X", "PATCH"}))
+			Expect(adminCommands[5][5]).To(ContainSubstring(RunIDLabel))
+
+			Expect(cfCommands(regularUserCmdStarter)).To(Equal([][]string{
+				{"set-space-role", "username", "org", spaceName, "SpaceManager"},
+				{"set-space-role", "username", "org", spaceName, "SpaceDeveloper"},
+				{"set-space-role", "username", "org", spaceName, "SpaceAuditor"},
+				{"target", "-o", "org", "-s", spaceName},
+			}))
+		})
+
+		It("targets the suite's space again and deletes the leased space after the spec", func() {
+			spaceName := leaseContext.TestSpace.SpaceName()
+			Expect(testSetup.RegularUserContext().TestSpace.SpaceName()).To(Equal("suite-space"))
+
+			Expect(cfCommands(regularUserCmdStarter)[4]).To(Equal([]string{"target", "-o", "org", "-s", "suite-space"}))
+			Expect(cfCommands(adminUserCmdStarter)[9]).To(Equal([]string{"delete-space", "-f", "-o", "org", spaceName}))
+		})
+	})
+
+	Describe("taking a space from the pool", Ordered, func() {
+		var pool *fakeSpacePool
+
+		BeforeAll(func() {
+			newTestSetup()
+			pool = &fakeSpacePool{spaces: []string{"pooled-space"}}
+			testSetup.SpacePool = pool
+		})
+
+		It("does not create the space", func() {
+			leaseContext := testSetup.LeaseSpace()
+			Expect(leaseContext.TestSpace.SpaceName()).To(Equal("pooled-space"))
+
+			Expect(cfCommands(adminUserCmdStarter)).NotTo(ContainElement(ContainElement("create-space")))
+			Expect(cfCommands(regularUserCmdStarter)[3]).To(Equal([]string{"target", "-o", "org", "-s", "pooled-space"}))
+		})
+
+		It("deletes it after the spec and releases it from the pool", func() {
+			Expect(cfCommands(adminUserCmdStarter)).To(ContainElement([]string{"delete-space", "-f", "-o", "org", "pooled-space"}))
+			Expect(pool.released).To(Equal([]string{"pooled-space"}))
+		})
+	})
+})
@@ -0,0 +1,398 @@
+package workflowhelpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry/cf-test-helpers/v2/generator"
+	"github.com/cloudfoundry/cf-test-helpers/v2/workflowhelpers/internal"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+// SpacePoolManager provisions the spaces and users of every parallel node
+// on node 1, instead of each node creating its own quota, org, space and
+// user one cf command after another. Provision creates the org and the
+// first space, and the other spaces in the background while the nodes set
+// up and run, each node waiting for its spaces when it takes them:
+//
+//	var pool *workflowhelpers.SpacePoolManager
+//
+//	var _ = SynchronizedBeforeSuite(func() []byte {
+//		suiteConfig, _ := GinkgoConfiguration()
+//		pool = workflowhelpers.NewSpacePoolManager(cfg, 2*suiteConfig.ParallelTotal)
+//		return pool.Provision()
+//	}, func(data []byte) {
+//		testSetup = workflowhelpers.NewPooledTestSuiteSetup(cfg, workflowhelpers.ClaimPooledSpaces(data))
+//		testSetup.Setup()
+//	})
+//
+//	var _ = SynchronizedAfterSuite(func() {
+//		testSetup.Teardown()
+//	}, func() {
+//		pool.Teardown()
+//	})
+type SpacePoolManager struct {
+	Size int
+
+	// Concurrency is how many spaces are created at the same time, each
+	// with its own admin login.
+	Concurrency int
+
+	// QuotaTotalMemoryLimit limits the org all the spaces share, 10G per
+	// space by default.
+	QuotaTotalMemoryLimit string
+
+	TeardownOptions TeardownOptions
+
+	config           testSuiteConfig
+	adminUserContext UserContext
+	ownership        Ownership
+	timeout          time.Duration
+
+	lock         sync.Mutex
+	pool         PooledSpaces
+	spaces       []*internal.TestSpace
+	users        []string
+	provisioning sync.WaitGroup
+}
+
+// PooledSpaces are the spaces of a pool, with a user holding the space
+// roles in each. ClaimPooledSpaces gives each node its share of them.
+//
+// The nodes learn which spaces have been provisioned, and which LeaseSpace
+// has deleted, from marker files in StatusDir, which every node of the
+// suite can reach as they run on the same machine. Take waits up to
+// ProvisionTimeout for a space that is still being provisioned.
+type PooledSpaces struct {
+	RunID  string        `json:"run_id"`
+	Org    string        `json:"org"`
+	Quota  string        `json:"quota"`
+	Spaces []PooledSpace `json:"spaces"`
+
+	StatusDir        string        `json:"status_dir,omitempty"`
+	ProvisionTimeout time.Duration `json:"provision_timeout,omitempty"`
+
+	lock sync.Mutex
+}
+
+const (
+	provisionedMarker = "provisioned"
+	failedMarker      = "failed"
+	releasedMarker    = "released"
+)
+
+// provisionPollInterval is how often Take checks whether a space it waits
+// for has been provisioned.
+var provisionPollInterval = 100 * time.Millisecond
+
+type PooledSpace struct {
+	Space    string `json:"space"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Origin   string `json:"origin"`
+}
+
+func NewSpacePoolManager(config testSuiteConfig, size int) *SpacePoolManager {
+	return NewBaseSpacePoolManager(config, newAdminUserContext(config), size)
+}
+
+func NewBaseSpacePoolManager(config testSuiteConfig, adminUserContext UserContext, size int) *SpacePoolManager {
+	return &SpacePoolManager{
+		Size:                  size,
+		Concurrency:           4,
+		QuotaTotalMemoryLimit: fmt.Sprintf("%dG", 10*size),
+
+		config:           config,
+		adminUserContext: adminUserContext,
+		ownership:        internal.NewOwnership(config.GetNamePrefix()),
+		timeout:          config.GetScaledTimeout(1 * time.Minute),
+	}
+}
+
+// Provision creates the pool's org and quota, unless the config asks for an
+// existing org, with its first space and user, and starts provisioning the
+// others in the background. It returns them all for SynchronizedBeforeSuite
+// to share with every node. A space that fails to be provisioned in the
+// background fails the spec node 1 runs at the time, and Take skips it.
+func (manager *SpacePoolManager) Provision() []byte {
+	gomega.ExpectWithOffset(1, manager.Size).To(gomega.BeNumerically(">", 0), "A space pool needs at least one space")
+
+	statusDir, err := os.MkdirTemp("", "cf-space-pool-")
+	gomega.ExpectWithOffset(1, err).NotTo(gomega.HaveOccurred())
+
+	manager.pool = PooledSpaces{
+		RunID:            manager.ownership.RunID,
+		Org:              generator.PrefixedRandomName(manager.config.GetNamePrefix(), "ORG"),
+		Quota:            generator.PrefixedRandomName(manager.config.GetNamePrefix(), "QUOTA"),
+		StatusDir:        statusDir,
+		ProvisionTimeout: time.Duration(manager.Size) * manager.timeout,
+	}
+	if manager.config.GetUseExistingOrganization() {
+		manager.pool.Org = manager.config.GetExistingOrganization()
+	}
+
+	// The spaces and users are named up front, so that the nodes know them
+	// before they exist.
+	var testSpaces []*internal.TestSpace
+	var testUsers []*internal.TestUser
+	for i := 0; i < manager.Size; i++ {
+		// The first space creates the org the others are created in.
+		testSpace := internal.NewBaseTestSpace(
+			generator.PrefixedRandomName(manager.config.GetNamePrefix(), "SPACE"),
+			manager.pool.Org,
+			manager.pool.Quota,
+			manager.QuotaTotalMemoryLimit,
+			i > 0 || manager.config.GetUseExistingOrganization(),
+			false,
+			manager.timeout,
+			manager.adminUserContext.CommandStarter,
+		)
+		testSpace.OwnershipLabels = manager.ownership.Labels()
+		testUser := internal.NewGeneratedTestUser(manager.config, manager.adminUserContext.CommandStarter)
+
+		testSpaces = append(testSpaces, testSpace)
+		testUsers = append(testUsers, testUser)
+		manager.pool.Spaces = append(manager.pool.Spaces, PooledSpace{
+			Space:    testSpace.SpaceName(),
+			Username: testUser.Username(),
+			Password: testUser.Password(),
+			Origin:   testUser.Origin(),
+		})
+	}
+
+	manager.provisionSpace(testSpaces[0], testUsers[0])
+
+	concurrency := manager.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	remaining := make(chan int, manager.Size)
+	for i := 1; i < manager.Size; i++ {
+		remaining <- i
+	}
+	close(remaining)
+
+	for i := 0; i < concurrency; i++ {
+		manager.provisioning.Add(1)
+		go func() {
+			defer manager.provisioning.Done()
+
+			for i := range remaining {
+				manager.provisionSpaceInBackground(testSpaces[i], testUsers[i])
+			}
+		}()
+	}
+
+	data, err := json.Marshal(&manager.pool)
+	gomega.ExpectWithOffset(1, err).NotTo(gomega.HaveOccurred())
+	return data
+}
+
+// Wait blocks until every space Provision started has been provisioned, or
+// has failed to be.
+func (manager *SpacePoolManager) Wait() {
+	manager.provisioning.Wait()
+}
+
+func (manager *SpacePoolManager) provisionSpaceInBackground(testSpace *internal.TestSpace, testUser *internal.TestUser) {
+	provisioned := false
+	defer ginkgo.GinkgoRecover()
+	defer func() {
+		if !provisioned {
+			manager.pool.mark(testSpace.SpaceName(), failedMarker)
+		}
+	}()
+
+	manager.provisionSpace(testSpace, testUser)
+	provisioned = true
+}
+
+func (manager *SpacePoolManager) provisionSpace(testSpace *internal.TestSpace, testUser *internal.TestUser) {
+	adminContext := manager.adminUserContext.WithIsolatedCfHome()
+	defer adminContext.RemoveCfHomeDir()
+
+	manager.lock.Lock()
+	manager.spaces = append(manager.spaces, testSpace)
+	manager.users = append(manager.users, testUser.Username())
+	manager.lock.Unlock()
+
+	AsUser(adminContext, manager.timeout, func() {
+		cmdStarter := adminContext.commandStarter()
+		testSpace.CommandStarter = cmdStarter
+		testUser.SetCommandStarter(cmdStarter)
+
+		testSpace.Create()
+		testUser.Create()
+
+		roleContext := NewUserContext(manager.config.GetApiEndpoint(), testUser, testSpace, manager.config.GetSkipSSLValidation(), manager.timeout)
+		roleContext.CommandStarter = adminContext.CommandStarter
+		roleContext.CfHomeDir = adminContext.CfHomeDir
+		roleContext.AddUserToSpace()
+	})
+
+	manager.pool.mark(testSpace.SpaceName(), provisionedMarker)
+}
+
+// Teardown waits for the spaces still being provisioned, and deletes the
+// users, spaces, org and quota of the pool, including the ones whose
+// provisioning failed part way. The spaces LeaseSpace has deleted already
+// are skipped.
+func (manager *SpacePoolManager) Teardown() {
+	manager.Wait()
+
+	manager.lock.Lock()
+	var spaces []*internal.TestSpace
+	for i, testSpace := range manager.spaces {
+		// The first space, which owns the org, is never handed out.
+		if i == 0 || !manager.pool.marked(testSpace.SpaceName(), releasedMarker) {
+			spaces = append(spaces, testSpace)
+		}
+	}
+	users := manager.users
+	manager.spaces = nil
+	manager.users = nil
+	manager.lock.Unlock()
+
+	var err error
+	AsUser(manager.adminUserContext, manager.timeout, func() {
+		cmdStarter := manager.adminUserContext.commandStarter()
+		teardown := internal.NewTeardown(manager.TeardownOptions)
+
+		// The first space, which deletes the org and quota, runs last.
+		for _, testSpace := range spaces {
+			testSpace.CommandStarter = cmdStarter
+			testSpace.RegisterCleanup(teardown)
+		}
+		if !manager.config.GetShouldKeepUser() {
+			for _, username := range users {
+				teardown.RegisterCf("delete user "+username, cmdStarter, manager.timeout, "Failed to delete user", "delete-user", "-f", username)
+			}
+		}
+
+		err = teardown.Run()
+	})
+	gomega.ExpectWithOffset(1, err).NotTo(gomega.HaveOccurred())
+
+	if manager.pool.StatusDir != "" {
+		gomega.ExpectWithOffset(1, os.RemoveAll(manager.pool.StatusDir)).To(gomega.Succeed())
+	}
+}
+
+// ClaimPooledSpaces decodes the data Provision returned and keeps the share
+// of the spaces that belongs to the current node.
+func ClaimPooledSpaces(data []byte) *PooledSpaces {
+	var pool PooledSpaces
+	err := json.Unmarshal(data, &pool)
+	gomega.ExpectWithOffset(1, err).NotTo(gomega.HaveOccurred(), "Failed to decode the space pool")
+
+	node := ginkgo.GinkgoParallelProcess()
+	nodes := parallelNodes()
+
+	var share []PooledSpace
+	for i, space := range pool.Spaces {
+		if i%nodes == node-1 {
+			share = append(share, space)
+		}
+	}
+	pool.Spaces = share
+
+	return &pool
+}
+
+// Take returns an unused space of the pool with its user, once it has been
+// provisioned. Spaces that failed to be provisioned, or were not within
+// ProvisionTimeout, are skipped.
+func (pool *PooledSpaces) Take() (PooledSpace, bool) {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	for len(pool.Spaces) > 0 {
+		space := pool.Spaces[0]
+		pool.Spaces = pool.Spaces[1:]
+		if pool.waitUntilProvisioned(space.Space) {
+			return space, true
+		}
+	}
+	return PooledSpace{}, false
+}
+
+// TakeSpace makes the pool the SpacePool of LeaseSpace.
+func (pool *PooledSpaces) TakeSpace() (string, bool) {
+	space, ok := pool.Take()
+	return space.Space, ok
+}
+
+// ReleaseSpace records that LeaseSpace deleted the space, for the
+// SpacePoolManager not to delete it again.
+func (pool *PooledSpaces) ReleaseSpace(space string) {
+	pool.mark(space, releasedMarker)
+}
+
+func (pool *PooledSpaces) waitUntilProvisioned(space string) bool {
+	if pool.StatusDir == "" {
+		return true
+	}
+
+	deadline := time.Now().Add(pool.ProvisionTimeout)
+	for {
+		if pool.marked(space, provisionedMarker) {
+			return true
+		}
+		if pool.marked(space, failedMarker) || time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(provisionPollInterval)
+	}
+}
+
+func (pool *PooledSpaces) mark(space, marker string) {
+	if pool.StatusDir == "" {
+		return
+	}
+
+	err := os.WriteFile(pool.markerPath(space, marker), nil, 0600)
+	gomega.ExpectWithOffset(2, err).NotTo(gomega.HaveOccurred())
+}
+
+func (pool *PooledSpaces) marked(space, marker string) bool {
+	if pool.StatusDir == "" {
+		return false
+	}
+
+	_, err := os.Stat(pool.markerPath(space, marker))
+	return err == nil
+}
+
+func (pool *PooledSpaces) markerPath(space, marker string) string {
+	return filepath.Join(pool.StatusDir, space+"."+marker)
+}
+
+// NewPooledTestSuiteSetup sets a suite up in a space of the pool, as its
+// user, so that Setup only logs in and targets the space. The pool's
+// remaining spaces become the SpacePool of LeaseSpace. Teardown leaves the
+// space and user to the SpacePoolManager.
+func NewPooledTestSuiteSetup(config testSuiteConfig, pool *PooledSpaces) *ReproducibleTestSuiteSetup {
+	pooledSpace, ok := pool.Take()
+	gomega.ExpectWithOffset(1, ok).To(gomega.BeTrue(), fmt.Sprintf("The space pool has no space left for node %d", ginkgo.GinkgoParallelProcess()))
+
+	cmdStarter := internal.NewCommandStarter(config)
+	timeout := config.GetScaledTimeout(1 * time.Minute)
+
+	testSpace := internal.NewBaseTestSpace(pooledSpace.Space, pool.Org, pool.Quota, "", true, true, timeout, cmdStarter)
+	testUser := internal.NewExistingTestUser(pooledSpace.Username, pooledSpace.Password, pooledSpace.Origin, timeout, cmdStarter)
+
+	regularUserContext := NewUserContext(config.GetApiEndpoint(), testUser, testSpace, config.GetSkipSSLValidation(), timeout)
+	regularUserContext.CommandStarter = cmdStarter
+
+	testSetup := NewBaseTestSuiteSetup(config, testSpace, testUser, regularUserContext, newAdminUserContext(config), true)
+	testSetup.SkipSpaceRoleCreation = true
+	testSetup.SpacePool = pool
+	testSetup.ownership.RunID = pool.RunID
+	return testSetup
+}
@@ -0,0 +1,209 @@
+package workflowhelpers_test
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/cloudfoundry/cf-test-helpers/v2/config"
+	starterFakes "github.com/cloudfoundry/cf-test-helpers/v2/internal/fakes"
+	. "github.com/cloudfoundry/cf-test-helpers/v2/workflowhelpers"
+	"github.com/cloudfoundry/cf-test-helpers/v2/workflowhelpers/internal/fakes"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SpacePoolManager", func() {
+	var cfg config.Config
+	var adminUserCmdStarter *starterFakes.FakeCmdStarter
+	var manager *SpacePoolManager
+
+	var cfCommands = func() [][]string {
+		var commands [][]string
+		for _, call := range adminUserCmdStarter.CalledWith {
+			commands = append(commands, call.Args)
+		}
+		return commands
+	}
+
+	var commandsNamed = func(name string) [][]string {
+		var commands [][]string
+		for _, command := range cfCommands() {
+			if command[0] == name {
+				commands = append(commands, command)
+			}
+		}
+		return commands
+	}
+
+	BeforeEach(func() {
+		cfg = config.Config{
+			NamePrefix:   "UNIT-TESTS",
+			TimeoutScale: 1,
+			ApiEndpoint:  "api-url.com",
+		}
+
+		adminUserCmdStarter = starterFakes.NewFakeCmdStarter()
+		for i := 0; i < 3; i++ {
+			adminUserCmdStarter.ToReturn = append(adminUserCmdStarter.ToReturn, adminUserCmdStarter.ToReturn...)
+		}
+		for i := range adminUserCmdStarter.ToReturn {
+			adminUserCmdStarter.ToReturn[i].Output = `'{"resources":[{"guid":"some-guid"}]}'`
+		}
+
+		adminUserContext := UserContext{
+			ApiUrl:         "api-url.com",
+			CommandStarter: adminUserCmdStarter,
+			TestUser:       fakes.NewFakeUserValues("admin", "admin", ""),
+			Timeout:        2 * time.Second,
+		}
+
+		manager = NewBaseSpacePoolManager(&cfg, adminUserContext, 3)
+		manager.Concurrency = 1
+	})
+
+	Describe("Provision", func() {
+		It("creates one org and quota, and the spaces with a user each", func() {
+			var pool PooledSpaces
+			Expect(json.Unmarshal(manager.Provision(), &pool)).To(Succeed())
+			manager.Wait()
+
+			Expect(pool.Org).To(MatchRegexp("UNIT-TESTS-[0-9]+-ORG-.*"))
+			Expect(pool.RunID).NotTo(BeEmpty())
+			Expect(pool.Spaces).To(HaveLen(3))
+
+			spaces := map[string]bool{}
+			for _, space := range pool.Spaces {
+				spaces[space.Space] = true
+				Expect(space.Username).To(MatchRegexp("UNIT-TESTS-[0-9]+-USER-.*"))
+				Expect(space.Password).NotTo(BeEmpty())
+				Expect(cfCommands()).To(ContainElement([]string{"set-space-role", space.Username, pool.Org, space.Space, "SpaceDeveloper"}))
+			}
+			Expect(spaces).To(HaveLen(3))
+
+			Expect(commandsNamed("create-quota")).To(HaveLen(1))
+			Expect(commandsNamed("create-org")).To(Equal([][]string{{"create-org", pool.Org}}))
+			Expect(commandsNamed("create-space")).To(HaveLen(3))
+			Expect(commandsNamed("create-user")).To(HaveLen(3))
+		})
+
+		It("returns once the first space is provisioned, and Take waits for the others", func() {
+			// The first space takes 16 commands, the next one sleeps.
+			adminUserCmdStarter.ToReturn[16].SleepTime = 1
+
+			start := time.Now()
+			pool := ClaimPooledSpaces(manager.Provision())
+			Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+
+			for i := 0; i < 3; i++ {
+				_, ok := pool.Take()
+				Expect(ok).To(BeTrue())
+			}
+			Expect(time.Since(start)).To(BeNumerically(">=", time.Second))
+
+			manager.Wait()
+			Expect(commandsNamed("create-user")).To(HaveLen(3))
+		})
+
+		It("logs in as the admin in a CF_HOME of its own for each space", func() {
+			manager.Provision()
+			manager.Wait()
+
+			homes := map[string]bool{}
+			for _, call := range adminUserCmdStarter.CalledWith {
+				Expect(call.Env).To(ConsistOf(HavePrefix("CF_HOME=")))
+				homes[call.Env[0]] = true
+			}
+			Expect(homes).To(HaveLen(3))
+			Expect(commandsNamed("auth")).To(HaveLen(3))
+		})
+	})
+
+	Describe("Teardown", func() {
+		It("deletes the users, then the spaces, then the org and quota", func() {
+			var pool PooledSpaces
+			Expect(json.Unmarshal(manager.Provision(), &pool)).To(Succeed())
+			manager.Wait()
+			calls := len(adminUserCmdStarter.CalledWith)
+
+			manager.Teardown()
+
+			var deletes [][]string
+			for _, command := range cfCommands()[calls:] {
+				if command[0] != "api" && command[0] != "auth" && command[0] != "logout" {
+					deletes = append(deletes, command[:2])
+				}
+			}
+			Expect(deletes).To(Equal([][]string{
+				{"delete-user", "-f"},
+				{"delete-user", "-f"},
+				{"delete-user", "-f"},
+				{"delete-space", "-f"},
+				{"delete-space", "-f"},
+				{"delete-org", "-f"},
+				{"delete-quota", "-f"},
+			}))
+		})
+	})
+
+	Describe("Teardown of released spaces", func() {
+		It("skips the spaces LeaseSpace deleted", func() {
+			pool := ClaimPooledSpaces(manager.Provision())
+			manager.Wait()
+
+			pool.Take()
+			released, ok := pool.TakeSpace()
+			Expect(ok).To(BeTrue())
+			kept, ok := pool.TakeSpace()
+			Expect(ok).To(BeTrue())
+			pool.ReleaseSpace(released)
+
+			manager.Teardown()
+			Expect(commandsNamed("delete-space")).To(Equal([][]string{{"delete-space", "-f", "-o", pool.Org, kept}}))
+			Expect(commandsNamed("delete-user")).To(HaveLen(3))
+			Expect(pool.StatusDir).NotTo(BeADirectory())
+		})
+	})
+
+	Describe("NewPooledTestSuiteSetup", func() {
+		var pool *PooledSpaces
+
+		BeforeEach(func() {
+			pool = ClaimPooledSpaces(manager.Provision())
+			DeferCleanup(manager.Wait)
+		})
+
+		It("sets the suite up as the user of one of its spaces", func() {
+			var claimed []PooledSpace
+			claimed = append(claimed, pool.Spaces...)
+
+			testSetup := NewPooledTestSuiteSetup(&cfg, pool)
+			Expect(testSetup.RegularUserContext().TestUser.Username()).To(Equal(claimed[0].Username))
+			Expect(testSetup.RegularUserContext().TestUser.Password()).To(Equal(claimed[0].Password))
+			Expect(testSetup.RegularUserContext().TestSpace.SpaceName()).To(Equal(claimed[0].Space))
+			Expect(testSetup.GetOrganizationName()).To(Equal(pool.Org))
+			Expect(testSetup.SkipUserCreation).To(BeTrue())
+			Expect(testSetup.SkipSpaceRoleCreation).To(BeTrue())
+			Expect(testSetup.RunID()).To(Equal(pool.RunID))
+
+			for _, space := range claimed[1:] {
+				spaceName, ok := testSetup.SpacePool.TakeSpace()
+				Expect(ok).To(BeTrue())
+				Expect(spaceName).To(Equal(space.Space))
+			}
+			_, ok := testSetup.SpacePool.TakeSpace()
+			Expect(ok).To(BeFalse())
+		})
+
+		It("fails when the pool has no space left", func() {
+			manager.Wait()
+			for range pool.Spaces {
+				pool.Take()
+			}
+
+			failures := InterceptGomegaFailures(func() {
+				NewPooledTestSuiteSetup(&cfg, pool)
+			})
+			Expect(failures).To(ConsistOf(ContainSubstring("The space pool has no space left")))
+		})
+	})
+})
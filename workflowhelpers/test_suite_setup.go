@@ -3,16 +3,52 @@ package workflowhelpers
 import (
 	"time"
 
-	"github.com/cloudfoundry/cf-test-helpers/v2/commandstarter"
 	"github.com/cloudfoundry/cf-test-helpers/v2/workflowhelpers/internal"
+	"github.com/onsi/gomega"
 )
 
-type remoteResource interface {
+type SpaceOptions = internal.SpaceOptions
+type QuotaBuilder = internal.QuotaBuilder
+
+// NewQuotaBuilder declares an org or space quota for SpaceOptions, unlimited
+// until limits are set.
+func NewQuotaBuilder(name string) QuotaBuilder {
+	return internal.NewQuotaBuilder(name)
+}
+
+// DefaultOrgQuota declares the org quota suites get by default, limited to
+// the given total memory, as a base for quotas that change a few limits.
+func DefaultOrgQuota(name, totalMemoryLimit string) QuotaBuilder {
+	return internal.DefaultOrgQuota(name, totalMemoryLimit)
+}
+
+type Ownership = internal.Ownership
+type TeardownOptions = internal.TeardownOptions
+type TeardownError = internal.TeardownError
+
+// The v3 metadata labels Setup puts on the orgs, spaces and apps it creates.
+const (
+	SuiteLabel     = internal.SuiteLabel
+	NodeLabel      = internal.NodeLabel
+	RunIDLabel     = internal.RunIDLabel
+	CreatedAtLabel = internal.CreatedAtLabel
+	GitSHALabel    = internal.GitSHALabel
+)
+
+// RemoteResource is something a suite creates on the CF API for its specs
+// and destroys again at suite end, unless it should remain.
+type RemoteResource interface {
 	Create()
 	Destroy()
 	ShouldRemain() bool
 }
 
+// cleanupRegisterer is implemented by the remote resources that can tear
+// themselves down step by step rather than in a single Destroy.
+type cleanupRegisterer interface {
+	RegisterCleanup(teardown *internal.Teardown)
+}
+
 type testSuiteConfig interface {
 	internal.AdminUserConfig
 	internal.SpaceAndOrgConfig
@@ -31,7 +67,7 @@ type ReproducibleTestSuiteSetup struct {
 	shortTimeout time.Duration
 	longTimeout  time.Duration
 
-	TestUser  remoteResource
+	TestUser  RemoteResource
 	TestSpace internal.Space
 
 	regularUserContext UserContext
@@ -42,6 +78,55 @@ type ReproducibleTestSuiteSetup struct {
 	SkipUserCreation      bool
 	SkipSpaceRoleCreation bool
 
+	// CacheLogins keeps the admin and the regular user logged in between
+	// AsUser calls for the lifetime of the suite instead of authenticating
+	// on every switch. It is off by default.
+	CacheLogins bool
+
+	// RoleAssignmentMode and VerifyRoleAssignments apply to the space roles
+	// given to the regular user, whose outcome RoleAssignments returns.
+	RoleAssignmentMode    RoleAssignmentMode
+	VerifyRoleAssignments bool
+	roleAssignments       []RoleAssignmentResult
+
+	ownership Ownership
+
+	// TeardownOptions configure how Teardown retries failed cleanup steps
+	// and whether it only warns about the ones that keep failing.
+	TeardownOptions TeardownOptions
+
+	// SpacePool, when set, provides the spaces LeaseSpace leases.
+	SpacePool SpacePool
+
+	// Resources are created by Setup after the space and user, and
+	// destroyed by Teardown before them.
+	Resources ResourceRegistry
+
+	// StateFile is where Setup records what it creates, for ResumeFromState
+	// and TeardownFromState. It defaults to setup-state-<node>.json in the
+	// artifacts directory; an empty StateFile records nothing.
+	StateFile string
+	state     SetupState
+
+	configuredTestPassword string
+
+	// KeepResourcesOnFailure makes Teardown leave the space, org and user in
+	// place for inspection when HasFailed, which defaults to SpecFailed.
+	// Without HasFailed, the suite has to pass its spec reports to
+	// RecordSpecReport, or Teardown warns that it cannot tell.
+	KeepResourcesOnFailure bool
+	HasFailed              func() bool
+	specFailed             bool
+	specReportRecorded     bool
+
+	namePrefix string
+
+	// IsolateCfHomes makes Setup give the admin and regular user contexts
+	// CF_HOMEs of their own, which Teardown removes again, so that their Cf
+	// methods run as their user wherever they are called. AsUser still
+	// points the process CF_HOME at the context's for helpers like cf.Cf.
+	IsolateCfHomes bool
+
 	originalCfHomeDir string
 	currentCfHomeDir  string
 }
@@ -67,35 +152,45 @@ func NewRunawayAppTestSuiteSetup(config testSuiteConfig) *ReproducibleTestSuiteS
 }
 
 func NewTestContextSuiteSetup(config testSuiteConfig, testSpace internal.Space, skipUserCreation bool) *ReproducibleTestSuiteSetup {
+	cmdStarter := internal.NewCommandStarter(config)
+
 	var testUser *internal.TestUser
 	useTestClient := false
 	if config.GetExistingClient() != "" && config.GetExistingClientSecret() != "" {
-		testUser = internal.NewTestClient(config, commandstarter.NewCommandStarter())
+		testUser = internal.NewTestClient(config, cmdStarter)
 		skipUserCreation = true
 		useTestClient = true
 	} else {
-		testUser = internal.NewTestUser(config, commandstarter.NewCommandStarter())
+		testUser = internal.NewTestUser(config, cmdStarter)
 	}
 
+	shortTimeout := config.GetScaledTimeout(1 * time.Minute)
+	regularUserContext := NewUserContext(config.GetApiEndpoint(), testUser, testSpace, config.GetSkipSSLValidation(), shortTimeout)
+	regularUserContext.UseClientCredentials = useTestClient
+	regularUserContext.CommandStarter = cmdStarter
+
+	return NewBaseTestSuiteSetup(config, testSpace, testUser, regularUserContext, newAdminUserContext(config), skipUserCreation)
+}
+
+func newAdminUserContext(config testSuiteConfig) UserContext {
+	cmdStarter := internal.NewCommandStarter(config)
+
 	var adminUser *internal.TestUser
 	useAdminClient := false
 	if config.GetAdminClient() != "" && config.GetAdminClientSecret() != "" {
-		adminUser = internal.NewAdminClient(config, commandstarter.NewCommandStarter())
+		adminUser = internal.NewAdminClient(config, cmdStarter)
 		useAdminClient = true
 	} else {
-		adminUser = internal.NewAdminUser(config, commandstarter.NewCommandStarter())
+		adminUser = internal.NewAdminUser(config, cmdStarter)
 	}
 
-	shortTimeout := config.GetScaledTimeout(1 * time.Minute)
-	regularUserContext := NewUserContext(config.GetApiEndpoint(), testUser, testSpace, config.GetSkipSSLValidation(), shortTimeout)
-	adminUserContext := NewUserContext(config.GetApiEndpoint(), adminUser, nil, config.GetSkipSSLValidation(), shortTimeout)
-	regularUserContext.UseClientCredentials = useTestClient
+	adminUserContext := NewUserContext(config.GetApiEndpoint(), adminUser, nil, config.GetSkipSSLValidation(), config.GetScaledTimeout(1*time.Minute))
 	adminUserContext.UseClientCredentials = useAdminClient
-
-	return NewBaseTestSuiteSetup(config, testSpace, testUser, regularUserContext, adminUserContext, skipUserCreation)
+	adminUserContext.CommandStarter = cmdStarter
+	return adminUserContext
 }
 
-func NewBaseTestSuiteSetup(config testSuiteConfig, testSpace internal.Space, testUser remoteResource, regularUserContext, adminUserContext UserContext, skipUserCreation bool) *ReproducibleTestSuiteSetup {
+func NewBaseTestSuiteSetup(config testSuiteConfig, testSpace internal.Space, testUser RemoteResource, regularUserContext, adminUserContext UserContext, skipUserCreation bool) *ReproducibleTestSuiteSetup {
 	shortTimeout := config.GetScaledTimeout(1 * time.Minute)
 
 	return &ReproducibleTestSuiteSetup{
@@ -109,6 +204,13 @@ func NewBaseTestSuiteSetup(config testSuiteConfig, testSpace internal.Space, tes
 		SkipSpaceRoleCreation: !config.GetAddExistingUserToExistingSpace() && config.GetUseExistingSpace() && skipUserCreation,
 		TestSpace:             testSpace,
 		TestUser:              testUser,
+
+		ownership:  internal.NewOwnership(config.GetNamePrefix()),
+		namePrefix: config.GetNamePrefix(),
+
+		StateFile:              defaultStateFile(config),
+		configuredTestPassword: config.GetConfigurableTestPassword(),
+		KeepResourcesOnFailure: keepResourcesOnFailure(config),
 	}
 }
 
@@ -125,33 +227,172 @@ func (testSetup ReproducibleTestSuiteSetup) LongTimeout() time.Duration {
 }
 
 func (testSetup *ReproducibleTestSuiteSetup) Setup() {
+	_, err := testSetup.Resources.creationOrder()
+	gomega.ExpectWithOffset(1, err).NotTo(gomega.HaveOccurred())
+
+	testSetup.prepare()
+
 	AsUser(testSetup.AdminUserContext(), testSetup.shortTimeout, func() {
 		testSetup.TestSpace.Create()
+		testSetup.recordGuids()
+		testSetup.writeState()
 		if !testSetup.SkipUserCreation {
 			testSetup.TestUser.Create()
+			testSetup.writeState()
 		}
 		if !testSetup.SkipSpaceRoleCreation && !testSetup.RegularUserContext().UseClientCredentials {
-			testSetup.regularUserContext.AddUserToSpace()
+			roleContext := testSetup.regularUserContext
+			roleContext.CommandStarter = testSetup.adminUserContext.CommandStarter
+			roleContext.CfHomeDir = testSetup.adminUserContext.CfHomeDir
+			roleContext.RoleAssignmentMode = testSetup.RoleAssignmentMode
+			roleContext.VerifyRoleAssignments = testSetup.VerifyRoleAssignments
+			testSetup.roleAssignments = roleContext.AssignSpaceRoles(SpaceManager, SpaceDeveloper, SpaceAuditor)
 		}
 	})
+
+	// The resources come first, as creating them as the regular user logs
+	// it out again.
+	testSetup.createResources()
+	testSetup.login()
+}
+
+func (testSetup *ReproducibleTestSuiteSetup) prepare() {
+	if testSetup.IsolateCfHomes {
+		if testSetup.regularUserContext.CfHomeDir == "" {
+			testSetup.regularUserContext = testSetup.regularUserContext.WithIsolatedCfHome()
+		}
+		if testSetup.adminUserContext.CfHomeDir == "" {
+			testSetup.adminUserContext = testSetup.adminUserContext.WithIsolatedCfHome()
+		}
+	}
+
+	if testSetup.CacheLogins {
+		testSetup.regularUserContext = testSetup.regularUserContext.WithCachedLogin()
+		testSetup.adminUserContext = testSetup.adminUserContext.WithCachedLogin()
+	}
+
+	// The space and user are created and deleted as the admin.
+	if testSpace, ok := testSetup.TestSpace.(*internal.TestSpace); ok {
+		testSpace.CommandStarter = testSetup.adminUserContext.commandStarter()
+		testSpace.OwnershipLabels = testSetup.OwnershipLabels()
+	}
+	if testUser, ok := testSetup.TestUser.(*internal.TestUser); ok {
+		testUser.SetCommandStarter(testSetup.adminUserContext.commandStarter())
+	}
+	testSetup.regularUserContext.AppLabels = testSetup.OwnershipLabels()
+	testSetup.adminUserContext.AppLabels = testSetup.OwnershipLabels()
+}
+
+func (testSetup *ReproducibleTestSuiteSetup) login() {
 	testSetup.originalCfHomeDir, testSetup.currentCfHomeDir = testSetup.regularUserContext.SetCfHomeDir()
+	testSetup.writeState()
 	testSetup.regularUserContext.Login()
 	testSetup.regularUserContext.TargetSpace()
 }
 
+// Teardown deletes the test user and space and logs out, attempting every
+// cleanup step before failing with all the steps that failed. The StateFile
+// is removed once everything is gone, and kept for TeardownFromState if not.
+// The registered Resources are destroyed first. With KeepResourcesOnFailure,
+// a failed suite only logs out and reports how to log in to the space it
+// keeps.
 func (testSetup *ReproducibleTestSuiteSetup) Teardown() {
-	testSetup.regularUserContext.Logout()
-	testSetup.regularUserContext.UnsetCfHomeDir(testSetup.originalCfHomeDir, testSetup.currentCfHomeDir)
+	teardown := internal.NewTeardown(testSetup.TeardownOptions)
+	testSetup.warnUnlessSpecOutcomeKnown()
+	keepResources := testSetup.keepsResources()
+
+	// Registered in the order Setup created things, to run in reverse.
+	if testSetup.IsolateCfHomes {
+		teardown.RegisterAssertions("remove CF_HOME directories", func() {
+			testSetup.regularUserContext.RemoveCfHomeDir()
+			testSetup.adminUserContext.RemoveCfHomeDir()
+		})
+	}
+	teardown.RegisterAssertions("clear cached admin login", testSetup.adminUserContext.ClearCachedLogin)
+	if !keepResources {
+		teardown.Register("tear down as admin", testSetup.teardownAsAdmin)
+	}
+	teardown.RegisterAssertions("log out regular user", func() {
+		testSetup.regularUserContext.Logout()
+		testSetup.regularUserContext.UnsetCfHomeDir(testSetup.originalCfHomeDir, testSetup.currentCfHomeDir)
+		testSetup.regularUserContext.ClearCachedLogin()
+	})
+	if !keepResources {
+		testSetup.registerResourceCleanup(teardown)
+	}
 
-	AsUser(testSetup.AdminUserContext(), testSetup.shortTimeout, func() {
-		if !testSetup.TestUser.ShouldRemain() {
-			if !testSetup.SkipUserCreation {
-				testSetup.TestUser.Destroy()
-			}
-		}
+	err := teardown.Run()
+	if keepResources {
+		testSetup.reportKeptResources()
+	}
+	gomega.ExpectWithOffset(1, err).NotTo(gomega.HaveOccurred())
+	if err == nil && !keepResources {
+		testSetup.removeState()
+	}
+}
+
+func (testSetup *ReproducibleTestSuiteSetup) teardownAsAdmin() error {
+	options := testSetup.TeardownOptions
+	options.FailuresAsWarnings = false
+	teardown := internal.NewTeardown(options)
 
-		testSetup.TestSpace.Destroy()
+	registerCleanup(teardown, "destroy test space", testSetup.TestSpace)
+	if !testSetup.TestUser.ShouldRemain() && !testSetup.SkipUserCreation {
+		registerCleanup(teardown, "destroy test user", testSetup.TestUser)
+	}
+
+	var err error
+	failure := gomega.InterceptGomegaFailure(func() {
+		AsUser(testSetup.AdminUserContext(), testSetup.shortTimeout, func() {
+			err = teardown.Run()
+		})
 	})
+	if failure != nil {
+		return failure
+	}
+	return err
+}
+
+func registerCleanup(teardown *internal.Teardown, name string, resource interface{ Destroy() }) {
+	if registerer, ok := resource.(cleanupRegisterer); ok {
+		registerer.RegisterCleanup(teardown)
+		return
+	}
+	teardown.RegisterAssertions(name, resource.Destroy)
+}
+
+// SetSpaceOptions declares what Setup creates beyond the quota, org and
+// space. It fails for suites set up with a TestSpace of their own.
+func (testSetup *ReproducibleTestSuiteSetup) SetSpaceOptions(options SpaceOptions) {
+	testSpace, ok := testSetup.TestSpace.(*internal.TestSpace)
+	gomega.ExpectWithOffset(1, ok).To(gomega.BeTrue(), "SetSpaceOptions needs the TestSpace created by the suite setup")
+	if ok {
+		testSpace.Options = options
+	}
+}
+
+// RunID identifies this run of the suite in the RunIDLabel of everything it
+// creates. It is random unless $CF_TEST_RUN_ID sets it.
+func (testSetup *ReproducibleTestSuiteSetup) RunID() string {
+	return testSetup.ownership.RunID
+}
+
+func (testSetup *ReproducibleTestSuiteSetup) Ownership() Ownership {
+	return testSetup.ownership
+}
+
+func (testSetup *ReproducibleTestSuiteSetup) OwnershipLabels() map[string]string {
+	return testSetup.ownership.Labels()
+}
+
+// OwnershipLabelSelector selects everything this run created, for example
+// with cf curl "/v3/organizations?label_selector=...".
+func (testSetup *ReproducibleTestSuiteSetup) OwnershipLabelSelector() string {
+	return testSetup.ownership.LabelSelector()
+}
+
+func (testSetup *ReproducibleTestSuiteSetup) RoleAssignments() []RoleAssignmentResult {
+	return testSetup.roleAssignments
 }
 
 func (testSetup *ReproducibleTestSuiteSetup) AdminUserContext() UserContext {
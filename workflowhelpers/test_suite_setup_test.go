@@ -2,14 +2,17 @@ package workflowhelpers_test
 
 import (
 	"os"
+	"strings"
 	"time"
 
 	"github.com/cloudfoundry/cf-test-helpers/v2/config"
+	cfinternal "github.com/cloudfoundry/cf-test-helpers/v2/internal"
 	starterFakes "github.com/cloudfoundry/cf-test-helpers/v2/internal/fakes"
 	. "github.com/cloudfoundry/cf-test-helpers/v2/workflowhelpers"
 	"github.com/cloudfoundry/cf-test-helpers/v2/workflowhelpers/internal"
 	"github.com/cloudfoundry/cf-test-helpers/v2/workflowhelpers/internal/fakes"
 	. "github.com/onsi/ginkgo/v2"
+	"github.com/onsi/ginkgo/v2/types"
 	. "github.com/onsi/gomega"
 )
 
@@ -76,6 +79,14 @@ var _ = Describe("ReproducibleTestSuiteSetup", func() {
 			Expect(setup.TestSpace).To(Equal(testSpace))
 		})
 
+		It("identifies the run with ownership labels", func() {
+			setup := NewBaseTestSuiteSetup(&cfg, testSpace, testUser, regularUserContext, adminUserContext, false)
+			Expect(setup.RunID()).To(MatchRegexp("^[0-9a-f]{16}$"))
+			Expect(setup.OwnershipLabels()).To(HaveKeyWithValue(RunIDLabel, setup.RunID()))
+			Expect(setup.OwnershipLabels()).To(HaveKeyWithValue(SuiteLabel, "UNIT-TESTS"))
+			Expect(setup.OwnershipLabelSelector()).To(Equal(RunIDLabel + "=" + setup.RunID()))
+		})
+
 		It("sets the OrganizationName to the testSpace's organiation name", func() {
 			setup := NewBaseTestSuiteSetup(&cfg, testSpace, testUser, regularUserContext, adminUserContext, false)
 
@@ -83,6 +94,26 @@ var _ = Describe("ReproducibleTestSuiteSetup", func() {
 		})
 	})
 
+	Describe("SetSpaceOptions", func() {
+		It("sets the options of the suite's TestSpace", func() {
+			setup := NewTestSuiteSetup(&config.Config{NamePrefix: "UNIT-TESTS"})
+			setup.SetSpaceOptions(SpaceOptions{EnableSSH: true})
+
+			testSpace, ok := setup.TestSpace.(*internal.TestSpace)
+			Expect(ok).To(BeTrue())
+			Expect(testSpace.Options).To(Equal(SpaceOptions{EnableSSH: true}))
+		})
+
+		It("fails for a TestSpace of the suite's own", func() {
+			setup := NewBaseTestSuiteSetup(&config.Config{}, &fakes.FakeSpace{}, &fakes.FakeRemoteResource{}, UserContext{}, UserContext{}, false)
+
+			failures := InterceptGomegaFailures(func() {
+				setup.SetSpaceOptions(SpaceOptions{EnableSSH: true})
+			})
+			Expect(failures).To(ConsistOf(ContainSubstring("SetSpaceOptions needs the TestSpace created by the suite setup")))
+		})
+	})
+
 	Describe("NewTestContextSuiteSetup", func() {
 		var cfg config.Config
 		var existingUserCfg config.Config
@@ -334,7 +365,7 @@ var _ = Describe("ReproducibleTestSuiteSetup", func() {
 		It("creates the user on the remote CF Api", func() {
 			testSetup.Setup()
 			Expect(testUser.CreateCallCount()).To(Equal(1))
-			Expect(adminUserCmdStarter.TotalCallsToStart).To(Equal(3))
+			Expect(adminUserCmdStarter.TotalCallsToStart).To(Equal(6))
 		})
 
 		It("creates the space on the remote CF api", func() {
@@ -342,16 +373,45 @@ var _ = Describe("ReproducibleTestSuiteSetup", func() {
 			Expect(testSpace.CreateCallCount()).To(Equal(1))
 		})
 
-		It("adds the user to the space", func() {
+		It("adds the user to the space as the admin", func() {
 			testSetup.Setup()
-			Expect(regularUserCmdStarter.TotalCallsToStart).To(BeNumerically(">=", 3))
+			Expect(adminUserCmdStarter.TotalCallsToStart).To(BeNumerically(">=", 5))
 
-			Expect(regularUserCmdStarter.CalledWith[0].Executable).To(Equal("cf"))
-			Expect(regularUserCmdStarter.CalledWith[0].Args).To(Equal([]string{"set-space-role", fakeRegularUserValues.Username(), fakeSpaceValues.OrganizationName(), fakeSpaceValues.SpaceName(), "SpaceManager"}))
-			Expect(regularUserCmdStarter.CalledWith[1].Executable).To(Equal("cf"))
-			Expect(regularUserCmdStarter.CalledWith[1].Args).To(Equal([]string{"set-space-role", fakeRegularUserValues.Username(), fakeSpaceValues.OrganizationName(), fakeSpaceValues.SpaceName(), "SpaceDeveloper"}))
-			Expect(regularUserCmdStarter.CalledWith[2].Executable).To(Equal("cf"))
-			Expect(regularUserCmdStarter.CalledWith[2].Args).To(Equal([]string{"set-space-role", fakeRegularUserValues.Username(), fakeSpaceValues.OrganizationName(), fakeSpaceValues.SpaceName(), "SpaceAuditor"}))
+			Expect(adminUserCmdStarter.CalledWith[2].Executable).To(Equal("cf"))
+			Expect(adminUserCmdStarter.CalledWith[2].Args).To(Equal([]string{"set-space-role", fakeRegularUserValues.Username(), fakeSpaceValues.OrganizationName(), fakeSpaceValues.SpaceName(), "SpaceManager"}))
+			Expect(adminUserCmdStarter.CalledWith[3].Executable).To(Equal("cf"))
+			Expect(adminUserCmdStarter.CalledWith[3].Args).To(Equal([]string{"set-space-role", fakeRegularUserValues.Username(), fakeSpaceValues.OrganizationName(), fakeSpaceValues.SpaceName(), "SpaceDeveloper"}))
+			Expect(adminUserCmdStarter.CalledWith[4].Executable).To(Equal("cf"))
+			Expect(adminUserCmdStarter.CalledWith[4].Args).To(Equal([]string{"set-space-role", fakeRegularUserValues.Username(), fakeSpaceValues.OrganizationName(), fakeSpaceValues.SpaceName(), "SpaceAuditor"}))
+		})
+
+		It("records the outcome of the role assignments", func() {
+			testSetup.Setup()
+			Expect(testSetup.RoleAssignments()).To(Equal([]RoleAssignmentResult{
+				{Role: SpaceManager, Assigned: true},
+				{Role: SpaceDeveloper, Assigned: true},
+				{Role: SpaceAuditor, Assigned: true},
+			}))
+		})
+
+		Context("when a role cannot be assigned", func() {
+			BeforeEach(func() {
+				adminUserCmdStarter.ToReturn[3].ExitCode = 1
+				adminUserCmdStarter.ToReturn[3].Output = "not authorized"
+			})
+
+			It("fails in strict mode", func() {
+				testSetup.RoleAssignmentMode = StrictRoleAssignment
+
+				failures := InterceptGomegaFailures(testSetup.Setup)
+				Expect(failures).To(ConsistOf(ContainSubstring("Failed to give username SpaceDeveloper in org/space")))
+			})
+		})
+
+		It("labels the apps its contexts push with the ownership labels", func() {
+			testSetup.Setup()
+			Expect(testSetup.RegularUserContext().AppLabels).To(Equal(testSetup.OwnershipLabels()))
+			Expect(testSetup.AdminUserContext().AppLabels).To(Equal(testSetup.OwnershipLabels()))
 		})
 
 		It("logs in as the regular user in a unique CF_HOME and targets the correct space", func() {
@@ -363,13 +423,57 @@ var _ = Describe("ReproducibleTestSuiteSetup", func() {
 			Expect(os.Getenv("CF_HOME")).To(MatchRegexp("cf_home_.*"))
 			Expect(os.Getenv("CF_HOME")).NotTo(Equal(originalCfHomeDir))
 
-			Expect(regularUserCmdStarter.TotalCallsToStart).To(BeNumerically(">=", 6))
-			Expect(regularUserCmdStarter.CalledWith[3].Executable).To(Equal("cf"))
-			Expect(regularUserCmdStarter.CalledWith[3].Args).To(Equal([]string{"api", apiUrl}))
-			Expect(regularUserCmdStarter.CalledWith[4].Executable).To(Equal("cf"))
-			Expect(regularUserCmdStarter.CalledWith[4].Args).To(Equal([]string{"auth", fakeRegularUserValues.Username(), fakeRegularUserValues.Password()}))
-			Expect(regularUserCmdStarter.CalledWith[5].Executable).To(Equal("cf"))
-			Expect(regularUserCmdStarter.CalledWith[5].Args).To(Equal([]string{"target", "-o", fakeSpaceValues.OrganizationName(), "-s", fakeSpaceValues.SpaceName()}))
+			Expect(regularUserCmdStarter.TotalCallsToStart).To(BeNumerically(">=", 3))
+			Expect(regularUserCmdStarter.CalledWith[0].Executable).To(Equal("cf"))
+			Expect(regularUserCmdStarter.CalledWith[0].Args).To(Equal([]string{"api", apiUrl}))
+			Expect(regularUserCmdStarter.CalledWith[1].Executable).To(Equal("cf"))
+			Expect(regularUserCmdStarter.CalledWith[1].Args).To(Equal([]string{"auth", fakeRegularUserValues.Username(), fakeRegularUserValues.Password()}))
+			Expect(regularUserCmdStarter.CalledWith[2].Executable).To(Equal("cf"))
+			Expect(regularUserCmdStarter.CalledWith[2].Args).To(Equal([]string{"target", "-o", fakeSpaceValues.OrganizationName(), "-s", fakeSpaceValues.SpaceName()}))
+		})
+
+		Context("when CacheLogins is set", func() {
+			JustBeforeEach(func() {
+				testSetup.CacheLogins = true
+			})
+
+			It("caches the admin login for the suite", func() {
+				testSetup.Setup()
+
+				cachedCfHomeDir := testSetup.AdminUserContext().CfHomeDir
+				Expect(adminUserCmdStarter.CalledWith[0].Env).To(Equal([]string{"CF_HOME=" + cachedCfHomeDir}))
+				writeCachedLogin(cachedCfHomeDir, apiUrl, time.Now().Add(time.Hour), time.Now().Add(time.Hour))
+
+				calls := adminUserCmdStarter.TotalCallsToStart
+				AsUser(testSetup.AdminUserContext(), testSetup.ShortTimeout(), func() {})
+				Expect(adminUserCmdStarter.TotalCallsToStart).To(Equal(calls))
+
+				testSetup.AdminUserContext().ClearCachedLogin()
+				Expect(cachedCfHomeDir).NotTo(BeADirectory())
+			})
+
+			It("caches the regular user login for the suite in a CF_HOME of its own", func() {
+				originalCfHomeDir := "original-cf-home-dir"
+				GinkgoT().Setenv("CF_HOME", originalCfHomeDir)
+
+				testSetup.Setup()
+				cachedCfHomeDir := testSetup.RegularUserContext().CfHomeDir
+				Expect(os.Getenv("CF_HOME")).To(Equal(cachedCfHomeDir))
+
+				Expect(regularUserCmdStarter.CalledWith[0].Args).To(Equal([]string{"api", apiUrl}))
+				Expect(regularUserCmdStarter.CalledWith[0].Env).To(Equal([]string{"CF_HOME=" + cachedCfHomeDir}))
+				writeCachedLogin(cachedCfHomeDir, apiUrl, time.Now().Add(time.Hour), time.Now().Add(time.Hour))
+
+				calls := regularUserCmdStarter.TotalCallsToStart
+				AsUser(testSetup.RegularUserContext(), testSetup.ShortTimeout(), func() {})
+				Expect(regularUserCmdStarter.CalledWith[calls:regularUserCmdStarter.TotalCallsToStart]).To(ConsistOf(
+					HaveField("Args", []string{"target", "-o", "org", "-s", "space"}),
+				))
+
+				testSetup.Teardown()
+				Expect(cachedCfHomeDir).NotTo(BeADirectory())
+				Expect(os.Getenv("CF_HOME")).To(Equal(originalCfHomeDir))
+			})
 		})
 
 		It("skips creating the user when called with skipUserCreation on", func() {
@@ -379,6 +483,82 @@ var _ = Describe("ReproducibleTestSuiteSetup", func() {
 		})
 	})
 
+	Describe("Setup of a suite from its config", func() {
+		var cmdStarter *starterFakes.FakeCmdStarter
+		var cfg config.Config
+
+		var cfHomes = func(call string) []string {
+			var homes []string
+			for _, calledWith := range cmdStarter.CalledWith {
+				if calledWith.Args[0] != call {
+					continue
+				}
+				for _, env := range calledWith.Env {
+					if strings.HasPrefix(env, "CF_HOME=") {
+						homes = append(homes, strings.TrimPrefix(env, "CF_HOME="))
+					}
+				}
+			}
+			return homes
+		}
+
+		BeforeEach(func() {
+			cmdStarter = starterFakes.NewFakeCmdStarter()
+			for i := 0; i < 3; i++ {
+				cmdStarter.ToReturn = append(cmdStarter.ToReturn, cmdStarter.ToReturn...)
+			}
+			for i := range cmdStarter.ToReturn {
+				cmdStarter.ToReturn[i].Output = `'{"resources":[{"guid":"some-guid"}]}'`
+			}
+			originalNewCommandStarter := internal.NewCommandStarter
+			internal.NewCommandStarter = func(interface{}) cfinternal.Starter { return cmdStarter }
+			DeferCleanup(func() { internal.NewCommandStarter = originalNewCommandStarter })
+
+			cfg = config.Config{
+				ApiEndpoint:   "api.my-cf.com",
+				AdminUser:     "admin",
+				AdminPassword: "admin-password",
+				NamePrefix:    "UNIT-TESTS",
+				TimeoutScale:  0.1,
+			}
+		})
+
+		It("runs the commands in the process CF_HOME by default", func() {
+			testSetup := NewTestSuiteSetup(&cfg)
+			Expect(testSetup.CacheLogins).To(BeFalse())
+			Expect(testSetup.IsolateCfHomes).To(BeFalse())
+			testSetup.Setup()
+			defer testSetup.Teardown()
+
+			Expect(cmdStarter.CalledWith).NotTo(BeEmpty())
+			for _, call := range cmdStarter.CalledWith {
+				Expect(call.Env).To(BeEmpty(), "cf %v", call.Args)
+			}
+		})
+
+		It("runs each command in the CF_HOME of its user with IsolateCfHomes", func() {
+			testSetup := NewTestSuiteSetup(&cfg)
+			testSetup.IsolateCfHomes = true
+			testSetup.Setup()
+			defer testSetup.Teardown()
+
+			adminCfHome := testSetup.AdminUserContext().CfHomeDir
+			regularCfHome := testSetup.RegularUserContext().CfHomeDir
+			Expect(adminCfHome).NotTo(BeEmpty())
+			Expect(regularCfHome).NotTo(BeEmpty())
+
+			for _, call := range cmdStarter.CalledWith {
+				Expect(call.Env).To(ConsistOf(Or(Equal("CF_HOME="+adminCfHome), Equal("CF_HOME="+regularCfHome))), "cf %v", call.Args)
+			}
+			for _, adminCall := range []string{"create-quota", "create-org", "create-space", "create-user", "set-space-role"} {
+				Expect(cfHomes(adminCall)).NotTo(BeEmpty(), adminCall)
+				Expect(cfHomes(adminCall)).To(HaveEach(adminCfHome), adminCall)
+			}
+			Expect(cfHomes("target")).To(HaveEach(regularCfHome))
+			Expect(os.Getenv("CF_HOME")).To(Equal(regularCfHome))
+		})
+	})
+
 	Describe("TearDown", func() {
 		var testSpace *fakes.FakeSpace
 		var testUser *fakes.FakeRemoteResource
@@ -485,5 +665,108 @@ var _ = Describe("ReproducibleTestSuiteSetup", func() {
 			Expect(testSpace.DestroyCallCount()).To(Equal(1))
 		})
 
+		Context("when resources are kept on failure", func() {
+			var failed bool
+
+			BeforeEach(func() {
+				failed = true
+			})
+
+			JustBeforeEach(func() {
+				testSpace.OrganizationNameReturns("org")
+				testSpace.SpaceNameReturns("space")
+				testSetup.KeepResourcesOnFailure = true
+				testSetup.HasFailed = func() bool { return failed }
+			})
+
+			It("keeps the space and user of a failed suite and reports how to log in", func() {
+				testSetup.Teardown()
+				Expect(testSpace.DestroyCallCount()).To(Equal(0))
+				Expect(testUser.DestroyCallCount()).To(Equal(0))
+				Expect(regularUserCmdStarter.CalledWith[0].Args).To(Equal([]string{"logout"}))
+
+				entries := CurrentSpecReport().ReportEntries
+				Expect(entries).To(ContainElement(HaveField("Name", "Kept test resources")))
+				for _, entry := range entries {
+					if entry.Name == "Kept test resources" {
+						Expect(entry.StringRepresentation()).To(ContainSubstring("space: space"))
+						Expect(entry.StringRepresentation()).To(ContainSubstring("cf login -a api-url.com -u username -p [REDACTED] -o org -s space"))
+						Expect(entry.StringRepresentation()).NotTo(ContainSubstring("password"))
+					}
+				}
+			})
+
+			Context("when no spec failed", func() {
+				BeforeEach(func() {
+					failed = false
+				})
+
+				It("destroys the space and user", func() {
+					testSetup.Teardown()
+					Expect(testSpace.DestroyCallCount()).To(Equal(1))
+					Expect(testUser.DestroyCallCount()).To(Equal(1))
+					Expect(CurrentSpecReport().ReportEntries).NotTo(ContainElement(HaveField("Name", "Kept test resources")))
+				})
+			})
+
+			Context("without HasFailed", func() {
+				JustBeforeEach(func() {
+					testSetup.HasFailed = nil
+				})
+
+				It("keeps the space and user once a failed spec is recorded", func() {
+					testSetup.RecordSpecReport(types.SpecReport{State: types.SpecStatePassed})
+					Expect(testSetup.SpecFailed()).To(BeFalse())
+					testSetup.RecordSpecReport(types.SpecReport{State: types.SpecStateFailed})
+					testSetup.RecordSpecReport(types.SpecReport{State: types.SpecStatePassed})
+					Expect(testSetup.SpecFailed()).To(BeTrue())
+
+					testSetup.Teardown()
+					Expect(testSpace.DestroyCallCount()).To(Equal(0))
+					Expect(testUser.DestroyCallCount()).To(Equal(0))
+				})
+
+				It("destroys the space and user when no failed spec is recorded", func() {
+					testSetup.RecordSpecReport(types.SpecReport{State: types.SpecStatePassed})
+
+					testSetup.Teardown()
+					Expect(testSpace.DestroyCallCount()).To(Equal(1))
+					Expect(testUser.DestroyCallCount()).To(Equal(1))
+					Expect(CurrentSpecReport().ReportEntries).NotTo(ContainElement(HaveField("Name", "Spec outcome unknown")))
+				})
+
+				It("warns when no spec report is recorded at all", func() {
+					testSetup.Teardown()
+					Expect(testSpace.DestroyCallCount()).To(Equal(1))
+					Expect(CurrentSpecReport().ReportEntries).To(ContainElement(HaveField("Name", "Spec outcome unknown")))
+				})
+			})
+		})
+
+		Context("when a cleanup step fails", func() {
+			BeforeEach(func() {
+				testUser.DestroyFailure = "user is still logged in"
+			})
+
+			It("carries on with the other steps and fails once with all the failures", func() {
+				failures := InterceptGomegaFailures(testSetup.Teardown)
+				Expect(failures).To(HaveLen(1))
+				Expect(failures[0]).To(ContainSubstring("1 of 2 cleanup steps failed"))
+				Expect(failures[0]).To(ContainSubstring("destroy test user (after 1 attempts)"))
+				Expect(failures[0]).To(ContainSubstring("user is still logged in"))
+
+				Expect(testSpace.DestroyCallCount()).To(Equal(1))
+				Expect(adminUserCmdStarter.CalledWith[adminUserCmdStarter.TotalCallsToStart-1].Args).To(Equal([]string{"logout"}))
+			})
+
+			It("only warns when failures are warnings", func() {
+				testSetup.TeardownOptions.FailuresAsWarnings = true
+
+				Expect(InterceptGomegaFailures(testSetup.Teardown)).To(BeEmpty())
+				Expect(testSpace.DestroyCallCount()).To(Equal(1))
+				Expect(CurrentSpecReport().ReportEntries).To(ContainElement(HaveField("Name", "Teardown warning")))
+			})
+		})
+
 	})
 })
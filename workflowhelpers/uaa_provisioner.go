@@ -0,0 +1,131 @@
+package workflowhelpers
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry/cf-test-helpers/v2/workflowhelpers/internal"
+	"github.com/onsi/gomega"
+)
+
+type OAuthClient = internal.OAuthClient
+
+type uaaProvisionerConfig interface {
+	internal.AdminUserConfig
+	internal.AdminClientConfig
+
+	GetApiEndpoint() string
+	GetSkipSSLValidation() bool
+
+	GetNamePrefix() string
+	GetScaledTimeout(time.Duration) time.Duration
+}
+
+type uaaGroupMembership struct {
+	username string
+	origin   string
+	group    string
+}
+
+// UAAProvisioner creates OAuth clients and group memberships directly in the
+// UAA of the foundation, and removes them again in Cleanup. It authenticates
+// as the admin client when one is configured and as the admin user otherwise;
+// creating clients needs clients.write, which the cf CLI's client does not
+// grant the admin user on most foundations.
+type UAAProvisioner struct {
+	uaa        *internal.UAAClient
+	namePrefix string
+
+	lock        sync.Mutex
+	clients     []string
+	memberships []uaaGroupMembership
+}
+
+func NewUAAProvisioner(config uaaProvisionerConfig) *UAAProvisioner {
+	httpClient, err := internal.NewUAAHTTPClient(config, config.GetSkipSSLValidation(), config.GetScaledTimeout(1*time.Minute))
+	gomega.ExpectWithOffset(1, err).NotTo(gomega.HaveOccurred())
+
+	uaaUrl, err := internal.DiscoverUAAUrl(httpClient, config.GetApiEndpoint())
+	gomega.ExpectWithOffset(1, err).NotTo(gomega.HaveOccurred())
+
+	uaa := internal.NewUAAClient(uaaUrl, httpClient)
+	if config.GetAdminClient() != "" && config.GetAdminClientSecret() != "" {
+		err = uaa.AuthenticateClient(config.GetAdminClient(), config.GetAdminClientSecret())
+	} else {
+		err = uaa.AuthenticateUser(config.GetAdminUser(), config.GetAdminPassword(), config.GetAdminOrigin())
+	}
+	gomega.ExpectWithOffset(1, err).NotTo(gomega.HaveOccurred())
+
+	return &UAAProvisioner{
+		uaa:        uaa,
+		namePrefix: config.GetNamePrefix(),
+	}
+}
+
+// CreateClient registers the client, generating a client id with the name
+// prefix and a random secret when they are not given, and returns it.
+func (provisioner *UAAProvisioner) CreateClient(client OAuthClient) OAuthClient {
+	clientId, clientSecret := internal.GenerateClientCredentials(provisioner.namePrefix)
+	if client.ClientId == "" {
+		client.ClientId = clientId
+	}
+	if client.ClientSecret == "" {
+		client.ClientSecret = clientSecret
+	}
+
+	err := provisioner.uaa.CreateClient(client)
+	gomega.ExpectWithOffset(1, err).NotTo(gomega.HaveOccurred(), "Failed to create UAA client")
+
+	provisioner.lock.Lock()
+	provisioner.clients = append(provisioner.clients, client.ClientId)
+	provisioner.lock.Unlock()
+
+	return client
+}
+
+// AddUserToGroup adds the user to the UAA group, for example
+// cloud_controller.admin_read_only or network.write. The user has to log in
+// again for the group's scope to show up in its token.
+func (provisioner *UAAProvisioner) AddUserToGroup(user userValues, group string) {
+	err := provisioner.uaa.AddUserToGroup(user.Username(), user.Origin(), group)
+	gomega.ExpectWithOffset(1, err).NotTo(gomega.HaveOccurred(), "Failed to add user to group "+group)
+
+	provisioner.lock.Lock()
+	provisioner.memberships = append(provisioner.memberships, uaaGroupMembership{
+		username: user.Username(),
+		origin:   user.Origin(),
+		group:    group,
+	})
+	provisioner.lock.Unlock()
+}
+
+// Cleanup removes the group memberships and clients in the reverse order of
+// their creation, attempting all of them before failing.
+func (provisioner *UAAProvisioner) Cleanup() {
+	provisioner.lock.Lock()
+	memberships := provisioner.memberships
+	clients := provisioner.clients
+	provisioner.memberships = nil
+	provisioner.clients = nil
+	provisioner.lock.Unlock()
+
+	var failures []string
+	for i := len(memberships) - 1; i >= 0; i-- {
+		membership := memberships[i]
+		err := provisioner.uaa.RemoveUserFromGroup(membership.username, membership.origin, membership.group)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("removing %s from %s: %s", membership.username, membership.group, err))
+		}
+	}
+
+	for i := len(clients) - 1; i >= 0; i-- {
+		err := provisioner.uaa.DeleteClient(clients[i])
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("deleting client %s: %s", clients[i], err))
+		}
+	}
+
+	gomega.ExpectWithOffset(1, failures).To(gomega.BeEmpty(), "Failed to clean up UAA resources:\n"+strings.Join(failures, "\n"))
+}
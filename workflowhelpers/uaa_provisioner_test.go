@@ -0,0 +1,105 @@
+package workflowhelpers_test
+
+import (
+	"github.com/cloudfoundry/cf-test-helpers/v2/config"
+	. "github.com/cloudfoundry/cf-test-helpers/v2/workflowhelpers"
+	"github.com/cloudfoundry/cf-test-helpers/v2/workflowhelpers/internal/fakes"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("UAAProvisioner", func() {
+	var fakeUAA *fakes.FakeUAA
+	var cfg config.Config
+
+	BeforeEach(func() {
+		fakeUAA = fakes.NewFakeUAA()
+		DeferCleanup(fakeUAA.Close)
+
+		fakeUAA.AddUser("admin", "uaa", "admin-password")
+		fakeUAA.AddUser("some-user", "uaa", "password")
+		fakeUAA.AddGroup("cloud_controller.admin_read_only")
+
+		cfg = config.Config{
+			ApiEndpoint:   fakeUAA.URL(),
+			NamePrefix:    "UNIT-TESTS",
+			TimeoutScale:  1.0,
+			AdminUser:     "admin",
+			AdminPassword: "admin-password",
+		}
+	})
+
+	It("authenticates as the admin user", func() {
+		NewUAAProvisioner(&cfg)
+		Expect(fakeUAA.TokenRequests()).To(ConsistOf(ContainSubstring("grant_type=password")))
+	})
+
+	Context("when an admin client is configured", func() {
+		BeforeEach(func() {
+			cfg.AdminClient = "admin-client"
+			cfg.AdminClientSecret = "admin-secret"
+			fakeUAA.AddClientCredentials("admin-client", "admin-secret")
+		})
+
+		It("authenticates as the admin client", func() {
+			NewUAAProvisioner(&cfg)
+			Expect(fakeUAA.TokenRequests()).To(ConsistOf("grant_type=client_credentials"))
+		})
+	})
+
+	It("fails when it cannot authenticate", func() {
+		cfg.AdminPassword = "wrong-password"
+
+		failures := InterceptGomegaFailures(func() {
+			NewUAAProvisioner(&cfg)
+		})
+		Expect(failures).To(ConsistOf(ContainSubstring("Bad credentials")))
+	})
+
+	It("creates clients and group memberships and cleans them up", func() {
+		provisioner := NewUAAProvisioner(&cfg)
+
+		client := provisioner.CreateClient(OAuthClient{
+			AuthorizedGrantTypes: []string{"client_credentials"},
+			Authorities:          []string{"cloud_controller.admin_read_only"},
+		})
+		Expect(client.ClientId).To(MatchRegexp("UNIT-TESTS-[0-9]+-CLIENT-.*"))
+		Expect(client.ClientSecret).NotTo(BeEmpty())
+
+		created, ok := fakeUAA.Client(client.ClientId)
+		Expect(ok).To(BeTrue())
+		Expect(created.ClientSecret).To(Equal(client.ClientSecret))
+
+		provisioner.AddUserToGroup(fakes.NewFakeUserValues("some-user", "password", ""), "cloud_controller.admin_read_only")
+		Expect(fakeUAA.GroupMembers("cloud_controller.admin_read_only")).To(Equal([]string{"some-user"}))
+
+		provisioner.Cleanup()
+		_, ok = fakeUAA.Client(client.ClientId)
+		Expect(ok).To(BeFalse())
+		Expect(fakeUAA.GroupMembers("cloud_controller.admin_read_only")).To(BeEmpty())
+	})
+
+	It("cleans up once the token it started with has expired", func() {
+		provisioner := NewUAAProvisioner(&cfg)
+		client := provisioner.CreateClient(OAuthClient{AuthorizedGrantTypes: []string{"client_credentials"}})
+
+		fakeUAA.RevokeTokens()
+
+		provisioner.Cleanup()
+		_, ok := fakeUAA.Client(client.ClientId)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("attempts every cleanup before failing", func() {
+		provisioner := NewUAAProvisioner(&cfg)
+		provisioner.CreateClient(OAuthClient{ClientId: "first-client", AuthorizedGrantTypes: []string{"client_credentials"}})
+		provisioner.CreateClient(OAuthClient{ClientId: "second-client", AuthorizedGrantTypes: []string{"client_credentials"}})
+
+		fakeUAA.Close()
+
+		failures := InterceptGomegaFailures(provisioner.Cleanup)
+		Expect(failures).To(HaveLen(1))
+		Expect(failures[0]).To(ContainSubstring("deleting client second-client"))
+		Expect(failures[0]).To(ContainSubstring("deleting client first-client"))
+	})
+})
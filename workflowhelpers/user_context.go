@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/cloudfoundry/cf-test-helpers/v2/cf"
 	"github.com/cloudfoundry/cf-test-helpers/v2/commandstarter"
 	"github.com/cloudfoundry/cf-test-helpers/v2/internal"
 	workflowhelpersinternal "github.com/cloudfoundry/cf-test-helpers/v2/workflowhelpers/internal"
@@ -43,6 +45,30 @@ type UserContext struct {
 	Origin   string
 
 	UseClientCredentials bool
+
+	// CfHomeDir, when set, is the CF_HOME of every cf command started by the
+	// context, so that it does not depend on the process environment.
+	CfHomeDir string
+
+	// RoleAssignmentMode decides which failures to assign space roles are
+	// tolerated, and VerifyRoleAssignments checks through the v3 API that
+	// the user holds each role that was assigned.
+	RoleAssignmentMode    RoleAssignmentMode
+	VerifyRoleAssignments bool
+
+	// AppLabels are put on the apps pushed with Push. The contexts of a
+	// ReproducibleTestSuiteSetup get the ownership labels of the suite run.
+	AppLabels map[string]string
+
+	loginCache *loginCache
+}
+
+// tokenExpiryMargin keeps a cached login from being used when its access
+// token is about to expire in the middle of the caller's commands.
+const tokenExpiryMargin = 1 * time.Minute
+
+type loginCache struct {
+	lock sync.Mutex
 }
 
 func cliErrorMessage(session *gexec.Session) string {
@@ -87,12 +113,21 @@ func NewUserContext(apiUrl string, testUser userValues, testSpace spaceValues, s
 }
 
 func (uc UserContext) Login() {
+	if uc.loginCache != nil {
+		uc.loginCache.lock.Lock()
+		defer uc.loginCache.lock.Unlock()
+
+		if uc.hasCachedLogin() {
+			return
+		}
+	}
+
 	args := []string{"api", uc.ApiUrl}
 	if uc.SkipSSLValidation {
 		args = append(args, "--skip-ssl-validation")
 	}
 
-	session := internal.Cf(uc.CommandStarter, args...).Wait(uc.Timeout)
+	session := internal.Cf(uc.commandStarter(), args...).Wait(uc.Timeout)
 	gomega.EventuallyWithOffset(1, session, uc.Timeout).Should(gexec.Exit(0), apiErrorMessage(session))
 
 	redactor := internal.NewRedactor(uc.TestUser.Password())
@@ -100,22 +135,137 @@ func (uc UserContext) Login() {
 
 	var err error
 	if uc.UseClientCredentials {
-		err = workflowhelpersinternal.CfClientAuth(uc.CommandStarter, redactingReporter, uc.TestUser.Username(), uc.TestUser.Password(), uc.Timeout)
+		err = workflowhelpersinternal.CfClientAuth(uc.commandStarter(), redactingReporter, uc.TestUser.Username(), uc.TestUser.Password(), uc.Timeout)
 	} else {
-		err = workflowhelpersinternal.CfAuth(uc.CommandStarter, redactingReporter, uc.TestUser.Username(), uc.TestUser.Password(), uc.TestUser.Origin(), uc.Timeout)
+		err = workflowhelpersinternal.CfAuth(uc.commandStarter(), redactingReporter, uc.TestUser.Username(), uc.TestUser.Password(), uc.TestUser.Origin(), uc.Timeout)
 	}
 
 	gomega.Expect(err).NotTo(gomega.HaveOccurred())
 }
 
-func (uc UserContext) SetCfHomeDir() (string, string) {
-	originalCfHomeDir := os.Getenv("CF_HOME")
-	currentCfHomeDir, err := os.MkdirTemp("", fmt.Sprintf("cf_home_%d", ginkgo.GinkgoParallelProcess()))
+// WithIsolatedCfHome returns a copy of the context that keeps its cf CLI
+// configuration in its own CF_HOME rather than the one in the process
+// environment, so it can be used concurrently with other contexts through
+// its Cf method. AsUser points the process CF_HOME at it for the duration,
+// as it does for other contexts. The directory is removed with
+// RemoveCfHomeDir once the context is not needed.
+func (uc UserContext) WithIsolatedCfHome() UserContext {
+	cfHomeDir, err := os.MkdirTemp("", fmt.Sprintf("cf_home_%d", ginkgo.GinkgoParallelProcess()))
 	if err != nil {
 		panic("Error: could not create temporary home directory: " + err.Error())
 	}
 
-	err = os.Setenv("CF_HOME", currentCfHomeDir)
+	uc.CfHomeDir = cfHomeDir
+	return uc
+}
+
+// WithCachedLogin returns a copy of the context that stays logged in across
+// AsUser calls for the lifetime of the suite, so switching to it does not
+// re-authenticate. The login is cached in the context's own CF_HOME, which
+// it is given if it has none. Login skips cf api and cf auth while that
+// holds a usable token for the API, and Logout keeps the tokens. An expired
+// access token is refreshed by the cf CLI with the refresh token on the next
+// command; only when that has expired too does Login authenticate again.
+// ClearCachedLogin logs out and removes the CF_HOME at suite end.
+func (uc UserContext) WithCachedLogin() UserContext {
+	if uc.CfHomeDir == "" {
+		uc = uc.WithIsolatedCfHome()
+	}
+
+	uc.loginCache = &loginCache{}
+	return uc
+}
+
+func (uc UserContext) ClearCachedLogin() {
+	if uc.loginCache == nil {
+		return
+	}
+
+	uc.loginCache.lock.Lock()
+	defer uc.loginCache.lock.Unlock()
+
+	session := internal.Cf(uc.commandStarter(), "logout")
+	gomega.EventuallyWithOffset(1, session, uc.Timeout).Should(gexec.Exit(0), cliErrorMessage(session))
+
+	uc.RemoveCfHomeDir()
+}
+
+func (uc UserContext) hasCachedLogin() bool {
+	config, err := workflowhelpersinternal.ReadCfConfig(uc.CfHomeDir)
+	if err != nil || config.AccessToken == "" || !config.TargetsApi(uc.ApiUrl) {
+		return false
+	}
+
+	usableUntil := time.Now().Add(tokenExpiryMargin)
+
+	expiresAt, err := config.AccessTokenExpiresAt()
+	if err == nil && expiresAt.After(usableUntil) {
+		return true
+	}
+
+	expiresAt, err = config.RefreshTokenExpiresAt()
+	return err == nil && expiresAt.After(usableUntil)
+}
+
+// Cf runs a cf command as the context's user. Contexts without their own
+// CF_HOME run it as whoever is logged in through the process environment.
+func (uc UserContext) Cf(args ...string) *gexec.Session {
+	return internal.Cf(uc.commandStarter(), args...)
+}
+
+// CfCurl makes a v3 API request through cf curl as the context's user and
+// decodes the response. API errors in the response body are returned, as
+// cf curl exits 0 on them.
+func (uc UserContext) CfCurl(method, path string, body, response interface{}) error {
+	return workflowhelpersinternal.CfCurl(uc.commandStarter(), uc.Timeout, method, path, body, response)
+}
+
+// CfCurlWithoutOutput is CfCurl for responses that hold secrets, which it
+// leaves out of the GinkgoWriter when the CommandStarter supports that.
+func (uc UserContext) CfCurlWithoutOutput(method, path string, body, response interface{}) error {
+	return workflowhelpersinternal.CfCurl(internal.StarterWithoutOutput(uc.commandStarter()), uc.Timeout, method, path, body, response)
+}
+
+// Push pushes an app like cf.Push, with the context's AppLabels, as whoever
+// is logged in through the process environment, such as the context's user
+// within AsUser.
+func (uc UserContext) Push(appName string, args ...string) *gexec.Session {
+	return cf.PushWithLabels(uc.AppLabels, appName, args...)
+}
+
+func (uc UserContext) RemoveCfHomeDir() {
+	if uc.CfHomeDir == "" {
+		return
+	}
+
+	err := os.RemoveAll(uc.CfHomeDir)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (uc UserContext) commandStarter() internal.Starter {
+	if uc.CfHomeDir != "" {
+		return internal.StarterWithEnv(uc.CommandStarter, "CF_HOME="+uc.CfHomeDir)
+	}
+	return uc.CommandStarter
+}
+
+// SetCfHomeDir points the process CF_HOME at the context's own CF_HOME, or at
+// a new temporary one for contexts without, and returns the original and
+// the current CF_HOME for UnsetCfHomeDir.
+func (uc UserContext) SetCfHomeDir() (string, string) {
+	originalCfHomeDir := os.Getenv("CF_HOME")
+	currentCfHomeDir := uc.CfHomeDir
+	if currentCfHomeDir == "" {
+		var err error
+		currentCfHomeDir, err = os.MkdirTemp("", fmt.Sprintf("cf_home_%d", ginkgo.GinkgoParallelProcess()))
+		if err != nil {
+			panic("Error: could not create temporary home directory: " + err.Error())
+		}
+	}
+
+	err := os.Setenv("CF_HOME", currentCfHomeDir)
 	if err != nil {
 		panic("Error: could not set 'CF_HOME' env var: " + err.Error())
 	}
@@ -125,45 +275,81 @@ func (uc UserContext) SetCfHomeDir() (string, string) {
 
 func (uc UserContext) TargetSpace() {
 	if uc.TestSpace != nil && uc.TestSpace.OrganizationName() != "" {
-		session := internal.Cf(uc.CommandStarter, "target", "-o", uc.TestSpace.OrganizationName(), "-s", uc.TestSpace.SpaceName())
+		session := internal.Cf(uc.commandStarter(), "target", "-o", uc.TestSpace.OrganizationName(), "-s", uc.TestSpace.SpaceName())
 		gomega.EventuallyWithOffset(1, session, uc.Timeout).Should(gexec.Exit(0), cliErrorMessage(session))
 	}
 }
 
 func (uc UserContext) AddUserToSpace() {
+	uc.assignSpaceRoles(SpaceManager, SpaceDeveloper, SpaceAuditor)
+}
+
+// AssignSpaceRoles gives the user the roles in the context's space and
+// returns the outcome for each of them.
+func (uc UserContext) AssignSpaceRoles(roles ...SpaceRole) []RoleAssignmentResult {
+	return uc.assignSpaceRoles(roles...)
+}
+
+func (uc UserContext) assignSpaceRoles(roles ...SpaceRole) []RoleAssignmentResult {
 	username := uc.TestUser.Username()
 	orgName := uc.TestSpace.OrganizationName()
 	spaceName := uc.TestSpace.SpaceName()
 
-	spaceManager := internal.Cf(uc.CommandStarter, "set-space-role", username, orgName, spaceName, "SpaceManager")
-	gomega.EventuallyWithOffset(1, spaceManager, uc.Timeout).Should(gexec.Exit())
-	if spaceManager.ExitCode() != 0 {
-		gomega.ExpectWithOffset(1, spaceManager.Out).Should(gbytes.Say("not authorized"))
-	}
+	results := make([]RoleAssignmentResult, 0, len(roles))
+	for _, role := range roles {
+		result := RoleAssignmentResult{Role: role}
 
-	spaceDeveloper := internal.Cf(uc.CommandStarter, "set-space-role", username, orgName, spaceName, "SpaceDeveloper")
-	gomega.EventuallyWithOffset(1, spaceDeveloper, uc.Timeout).Should(gexec.Exit())
-	if spaceDeveloper.ExitCode() != 0 {
-		gomega.ExpectWithOffset(1, spaceDeveloper.Out).Should(gbytes.Say("not authorized"))
-	}
+		session := internal.Cf(uc.commandStarter(), "set-space-role", username, orgName, spaceName, string(role))
+		gomega.EventuallyWithOffset(2, session, uc.Timeout).Should(gexec.Exit())
 
-	spaceAuditor := internal.Cf(uc.CommandStarter, "set-space-role", username, orgName, spaceName, "SpaceAuditor")
-	gomega.EventuallyWithOffset(1, spaceAuditor, uc.Timeout).Should(gexec.Exit())
-	if spaceAuditor.ExitCode() != 0 {
-		gomega.ExpectWithOffset(1, spaceAuditor.Out).Should(gbytes.Say("not authorized"))
+		switch {
+		case session.ExitCode() == 0:
+			result.Assigned = true
+		case uc.RoleAssignmentMode == StrictRoleAssignment:
+			result.Reason = strings.TrimSpace(string(session.Out.Contents()) + string(session.Err.Contents()))
+			gomega.ExpectWithOffset(2, session).Should(gexec.Exit(0), fmt.Sprintf("Failed to give %s %s in %s/%s: %s", username, role, orgName, spaceName, result.Reason))
+		default:
+			gomega.ExpectWithOffset(2, session.Out).Should(gbytes.Say("not authorized"))
+			result.Skipped = true
+			result.Reason = "not authorized"
+			ginkgo.AddReportEntry("Skipped role assignment", fmt.Sprintf("%s was not given %s in %s/%s: not authorized", username, role, orgName, spaceName))
+		}
+
+		if result.Assigned && uc.VerifyRoleAssignments {
+			held, err := workflowhelpersinternal.HasSpaceRole(uc.commandStarter(), uc.Timeout, username, orgName, spaceName, string(role))
+			gomega.ExpectWithOffset(2, err).NotTo(gomega.HaveOccurred())
+			gomega.ExpectWithOffset(2, held).To(gomega.BeTrue(), fmt.Sprintf("%s does not hold %s in %s/%s after it was assigned", username, role, orgName, spaceName))
+			result.Verified = held
+		}
+
+		results = append(results, result)
 	}
+
+	return results
 }
 
 func (uc UserContext) Logout() {
-	session := internal.Cf(uc.CommandStarter, "logout")
+	if uc.loginCache != nil {
+		return
+	}
+
+	session := internal.Cf(uc.commandStarter(), "logout")
 	gomega.EventuallyWithOffset(1, session, uc.Timeout).Should(gexec.Exit(0), cliErrorMessage(session))
 }
 
+// UnsetCfHomeDir points the process CF_HOME back at the original one. The
+// temporary CF_HOME of a context without its own is removed, while the
+// context's own is kept for RemoveCfHomeDir.
 func (uc UserContext) UnsetCfHomeDir(originalCfHomeDir, currentCfHomeDir string) {
 	err := os.Setenv("CF_HOME", originalCfHomeDir)
 	if err != nil {
 		panic(err)
 	}
+
+	if uc.CfHomeDir != "" {
+		return
+	}
+
 	err = os.RemoveAll(currentCfHomeDir)
 	if err != nil {
 		panic(err)
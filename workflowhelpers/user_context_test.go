@@ -1,20 +1,36 @@
 package workflowhelpers_test
 
 import (
+	"encoding/base64"
 	"fmt"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"time"
 
+	"github.com/cloudfoundry/cf-test-helpers/v2/cf"
 	"github.com/cloudfoundry/cf-test-helpers/v2/config"
 	"github.com/cloudfoundry/cf-test-helpers/v2/workflowhelpers/internal"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
 
 	"github.com/cloudfoundry/cf-test-helpers/v2/internal/fakes"
 	"github.com/cloudfoundry/cf-test-helpers/v2/workflowhelpers"
 )
 
+func writeCachedLogin(cfHomeDir, target string, accessTokenExpiry, refreshTokenExpiry time.Time) {
+	token := func(expiresAt time.Time) string {
+		claims := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"exp":%d}`, expiresAt.Unix())))
+		return "header." + claims + ".signature"
+	}
+	contents := fmt.Sprintf(`{"Target":%q,"AccessToken":"bearer %s","RefreshToken":%q}`, target, token(accessTokenExpiry), token(refreshTokenExpiry))
+
+	Expect(os.MkdirAll(filepath.Join(cfHomeDir, ".cf"), 0700)).To(Succeed())
+	Expect(os.WriteFile(filepath.Join(cfHomeDir, ".cf", "config.json"), []byte(contents), 0600)).To(Succeed())
+}
+
 var _ = Describe("UserContext", func() {
 	Describe("NewUserContext", func() {
 		var testSpace *internal.TestSpace
@@ -371,6 +387,122 @@ var _ = Describe("UserContext", func() {
 		})
 	})
 
+	Describe("AssignSpaceRoles", func() {
+		var userContext workflowhelpers.UserContext
+		var fakeStarter *fakes.FakeCmdStarter
+		var testSpace *internal.TestSpace
+		var testUser *internal.TestUser
+
+		BeforeEach(func() {
+			fakeStarter = fakes.NewFakeCmdStarter()
+			testSpace = internal.NewBaseTestSpace("my-space", "my-org", "my-quota", "10G", true, true, time.Second, fakeStarter)
+			testUser = internal.NewTestUser(&config.Config{UseExistingUser: true, ExistingUser: "my-user"}, &fakes.FakeCmdStarter{})
+		})
+
+		JustBeforeEach(func() {
+			userContext = workflowhelpers.NewUserContext("", testUser, testSpace, false, time.Second)
+			userContext.CommandStarter = fakeStarter
+		})
+
+		It("returns the outcome of each role", func() {
+			results := userContext.AssignSpaceRoles(workflowhelpers.SpaceSupporter, workflowhelpers.SpaceDeveloper)
+
+			Expect(fakeStarter.CalledWith[0].Args).To(Equal([]string{"set-space-role", "my-user", "my-org", "my-space", "SpaceSupporter"}))
+			Expect(fakeStarter.CalledWith[1].Args).To(Equal([]string{"set-space-role", "my-user", "my-org", "my-space", "SpaceDeveloper"}))
+			Expect(results).To(Equal([]workflowhelpers.RoleAssignmentResult{
+				{Role: workflowhelpers.SpaceSupporter, Assigned: true},
+				{Role: workflowhelpers.SpaceDeveloper, Assigned: true},
+			}))
+		})
+
+		Context("when the acting user is not authorized to assign a role", func() {
+			BeforeEach(func() {
+				fakeStarter.ToReturn[0].ExitCode = 1
+				fakeStarter.ToReturn[0].Output = "not authorized"
+			})
+
+			It("skips the role and records it in the report", func() {
+				results := userContext.AssignSpaceRoles(workflowhelpers.SpaceManager, workflowhelpers.SpaceAuditor)
+
+				Expect(results).To(Equal([]workflowhelpers.RoleAssignmentResult{
+					{Role: workflowhelpers.SpaceManager, Skipped: true, Reason: "not authorized"},
+					{Role: workflowhelpers.SpaceAuditor, Assigned: true},
+				}))
+
+				entries := CurrentSpecReport().ReportEntries
+				Expect(entries).To(HaveLen(1))
+				Expect(entries[0].Name).To(Equal("Skipped role assignment"))
+				Expect(entries[0].StringRepresentation()).To(Equal("my-user was not given SpaceManager in my-org/my-space: not authorized"))
+			})
+
+			Context("in strict mode", func() {
+				JustBeforeEach(func() {
+					userContext.RoleAssignmentMode = workflowhelpers.StrictRoleAssignment
+				})
+
+				It("fails", func() {
+					failures := InterceptGomegaFailures(func() {
+						userContext.AssignSpaceRoles(workflowhelpers.SpaceManager)
+					})
+
+					Expect(failures).To(ConsistOf(ContainSubstring("Failed to give my-user SpaceManager in my-org/my-space: not authorized")))
+				})
+			})
+		})
+
+		Context("when assigning a role fails for another reason", func() {
+			BeforeEach(func() {
+				fakeStarter.ToReturn[0].ExitCode = 1
+				fakeStarter.ToReturn[0].Output = "User my-user not found"
+			})
+
+			It("fails", func() {
+				failures := InterceptGomegaFailures(func() {
+					userContext.AssignSpaceRoles(workflowhelpers.SpaceManager)
+				})
+
+				Expect(failures).To(ConsistOf(ContainSubstring("not authorized")))
+			})
+		})
+
+		Context("when role assignments are verified", func() {
+			BeforeEach(func() {
+				fakeStarter.ToReturn[1].Output = `'{"resources":[{"guid":"org-guid"}]}'`
+				fakeStarter.ToReturn[2].Output = `'{"resources":[{"guid":"space-guid"}]}'`
+				fakeStarter.ToReturn[3].Output = `'{"resources":[{"guid":"role-guid"}],"included":{"users":[{"username":"my-user"}]}}'`
+			})
+
+			JustBeforeEach(func() {
+				userContext.VerifyRoleAssignments = true
+			})
+
+			It("looks the role up through the v3 API", func() {
+				results := userContext.AssignSpaceRoles(workflowhelpers.SpaceSupporter)
+
+				Expect(fakeStarter.CalledWith[1].Args).To(Equal([]string{"curl", "/v3/organizations?names=my-org"}))
+				Expect(fakeStarter.CalledWith[2].Args).To(Equal([]string{"curl", "/v3/spaces?names=my-space&organization_guids=org-guid"}))
+				Expect(fakeStarter.CalledWith[3].Args).To(Equal([]string{"curl", "/v3/roles?include=user&per_page=5000&space_guids=space-guid&types=space_supporter"}))
+				Expect(results).To(Equal([]workflowhelpers.RoleAssignmentResult{
+					{Role: workflowhelpers.SpaceSupporter, Assigned: true, Verified: true},
+				}))
+			})
+
+			Context("and the user does not hold the role", func() {
+				BeforeEach(func() {
+					fakeStarter.ToReturn[3].Output = `'{"resources":[],"included":{"users":[]}}'`
+				})
+
+				It("fails", func() {
+					failures := InterceptGomegaFailures(func() {
+						userContext.AssignSpaceRoles(workflowhelpers.SpaceSupporter)
+					})
+
+					Expect(failures).To(ConsistOf(ContainSubstring("my-user does not hold SpaceSupporter in my-org/my-space after it was assigned")))
+				})
+			})
+		})
+	})
+
 	Describe("Logout", func() {
 		var userContext workflowhelpers.UserContext
 		var fakeStarter *fakes.FakeCmdStarter
@@ -449,4 +581,252 @@ var _ = Describe("UserContext", func() {
 			Expect(currentCfHomeDir).NotTo(BeADirectory())
 		})
 	})
+
+	Describe("Push", func() {
+		var manifests []string
+
+		BeforeEach(func() {
+			manifests = nil
+			originalCf := cf.Cf
+			DeferCleanup(func() { cf.Cf = originalCf })
+			cf.Cf = func(args ...string) *gexec.Session {
+				manifest, err := os.ReadFile(args[2])
+				Expect(err).NotTo(HaveOccurred())
+				manifests = append(manifests, string(manifest))
+
+				session, err := gexec.Start(exec.Command("true"), nil, nil)
+				Expect(err).NotTo(HaveOccurred())
+				return session
+			}
+		})
+
+		It("labels the app with the context's AppLabels", func() {
+			userContext := workflowhelpers.UserContext{AppLabels: map[string]string{"some-label": "some-value"}}
+
+			Eventually(userContext.Push("some-app", "-m", "64M")).Should(gexec.Exit(0))
+			Expect(manifests).To(HaveLen(1))
+			Expect(manifests[0]).To(ContainSubstring("name: some-app"))
+			Expect(manifests[0]).To(ContainSubstring("some-label: some-value"))
+		})
+
+		It("leaves out the metadata without AppLabels", func() {
+			userContext := workflowhelpers.UserContext{}
+
+			Eventually(userContext.Push("some-app")).Should(gexec.Exit(0))
+			Expect(manifests).To(HaveLen(1))
+			Expect(manifests[0]).NotTo(ContainSubstring("metadata"))
+		})
+	})
+
+	Describe("WithIsolatedCfHome", func() {
+		var userContext workflowhelpers.UserContext
+		var fakeStarter *fakes.FakeCmdStarter
+		var testSpace *internal.TestSpace
+		var testUser *internal.TestUser
+
+		BeforeEach(func() {
+			err := os.Setenv("CF_HOME", "my-cf-home-dir")
+			Expect(err).NotTo(HaveOccurred())
+
+			fakeStarter = fakes.NewFakeCmdStarter()
+			testSpace = internal.NewRegularTestSpace(&config.Config{}, "10G")
+			testUser = internal.NewTestUser(&config.Config{}, &fakes.FakeCmdStarter{})
+
+			userContext = workflowhelpers.NewUserContext("api-url", testUser, testSpace, false, 1*time.Second)
+			userContext.CommandStarter = fakeStarter
+			userContext = userContext.WithIsolatedCfHome()
+		})
+
+		AfterEach(func() {
+			userContext.RemoveCfHomeDir()
+			err := os.Unsetenv("CF_HOME")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("creates a temporary CF_HOME owned by the context", func() {
+			tmpDirRegexp := fmt.Sprintf("(\\/var\\/folders\\/.*\\/.*\\/T|\\/tmp)\\/cf_home_%d", GinkgoParallelProcess())
+
+			Expect(userContext.CfHomeDir).To(MatchRegexp(tmpDirRegexp))
+			Expect(userContext.CfHomeDir).To(BeADirectory())
+			Expect(userContext.WithIsolatedCfHome().CfHomeDir).NotTo(Equal(userContext.CfHomeDir))
+		})
+
+		It("runs every command with its own CF_HOME", func() {
+			userContext.Login()
+			userContext.TargetSpace()
+			userContext.Cf("apps").Wait()
+			userContext.Logout()
+
+			Expect(fakeStarter.CalledWith).To(HaveLen(5))
+			for _, call := range fakeStarter.CalledWith {
+				Expect(call.Env).To(Equal([]string{"CF_HOME=" + userContext.CfHomeDir}))
+			}
+			Expect(fakeStarter.CalledWith[3].Args).To(Equal([]string{"apps"}))
+		})
+
+		It("points the CF_HOME of the process at its own until it is unset", func() {
+			originalCfHomeDir, currentCfHomeDir := userContext.SetCfHomeDir()
+			Expect(os.Getenv("CF_HOME")).To(Equal(userContext.CfHomeDir))
+			Expect(currentCfHomeDir).To(Equal(userContext.CfHomeDir))
+
+			userContext.UnsetCfHomeDir(originalCfHomeDir, currentCfHomeDir)
+			Expect(os.Getenv("CF_HOME")).To(Equal("my-cf-home-dir"))
+			Expect(userContext.CfHomeDir).To(BeADirectory())
+		})
+
+		It("can be used concurrently with other contexts", func() {
+			otherStarter := fakes.NewFakeCmdStarter()
+			otherContext := userContext
+			otherContext.CommandStarter = otherStarter
+			otherContext = otherContext.WithIsolatedCfHome()
+			defer otherContext.RemoveCfHomeDir()
+
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				workflowhelpers.AsUser(otherContext, time.Second, func() {})
+				close(done)
+			}()
+			workflowhelpers.AsUser(userContext, time.Second, func() {})
+			Eventually(done).Should(BeClosed())
+
+			Expect(fakeStarter.CalledWith[0].Env).To(Equal([]string{"CF_HOME=" + userContext.CfHomeDir}))
+			Expect(otherStarter.CalledWith[0].Env).To(Equal([]string{"CF_HOME=" + otherContext.CfHomeDir}))
+		})
+
+		It("removes the CF_HOME with RemoveCfHomeDir", func() {
+			userContext.RemoveCfHomeDir()
+			Expect(userContext.CfHomeDir).NotTo(BeADirectory())
+		})
+	})
+
+	Describe("WithCachedLogin", func() {
+		var userContext workflowhelpers.UserContext
+		var fakeStarter *fakes.FakeCmdStarter
+		var cachedCfHomeDir string
+
+		var writeCfConfig = func(target string, accessTokenExpiry, refreshTokenExpiry time.Time) {
+			writeCachedLogin(cachedCfHomeDir, target, accessTokenExpiry, refreshTokenExpiry)
+		}
+
+		BeforeEach(func() {
+			err := os.Setenv("CF_HOME", "my-cf-home-dir")
+			Expect(err).NotTo(HaveOccurred())
+
+			fakeStarter = fakes.NewFakeCmdStarter()
+			userContext = workflowhelpers.UserContext{
+				ApiUrl:         "api.my-cf.com",
+				CommandStarter: fakeStarter,
+				TestUser:       internal.NewAdminUser(&config.Config{AdminUser: "username", AdminPassword: "password"}, &fakes.FakeCmdStarter{}),
+				Timeout:        1 * time.Second,
+			}
+			userContext = userContext.WithCachedLogin()
+			cachedCfHomeDir = userContext.CfHomeDir
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(cachedCfHomeDir)).To(Succeed())
+			err := os.Unsetenv("CF_HOME")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("logs in within the cached CF_HOME when nothing is cached yet", func() {
+			userContext.Login()
+
+			Expect(fakeStarter.CalledWith).To(HaveLen(2))
+			Expect(fakeStarter.CalledWith[0].Args).To(Equal([]string{"api", "api.my-cf.com"}))
+			Expect(fakeStarter.CalledWith[0].Env).To(Equal([]string{"CF_HOME=" + cachedCfHomeDir}))
+			Expect(fakeStarter.CalledWith[1].Args).To(Equal([]string{"auth", "username", "password"}))
+		})
+
+		It("caches the login in a CF_HOME of its own and keeps it when the process CF_HOME is restored", func() {
+			Expect(cachedCfHomeDir).To(BeADirectory())
+
+			originalCfHomeDir, currentCfHomeDir := userContext.SetCfHomeDir()
+			Expect(currentCfHomeDir).To(Equal(cachedCfHomeDir))
+			Expect(os.Getenv("CF_HOME")).To(Equal(cachedCfHomeDir))
+
+			userContext.UnsetCfHomeDir(originalCfHomeDir, currentCfHomeDir)
+			Expect(os.Getenv("CF_HOME")).To(Equal("my-cf-home-dir"))
+			Expect(cachedCfHomeDir).To(BeADirectory())
+		})
+
+		It("does not log out", func() {
+			userContext.Logout()
+			Expect(fakeStarter.CalledWith).To(BeEmpty())
+		})
+
+		Context("when the cached access token is still valid", func() {
+			BeforeEach(func() {
+				writeCfConfig("https://api.my-cf.com", time.Now().Add(time.Hour), time.Now().Add(time.Hour))
+			})
+
+			It("switches to the context without authenticating", func() {
+				workflowhelpers.AsUser(userContext, time.Second, func() {})
+				workflowhelpers.AsUser(userContext, time.Second, func() {})
+
+				Expect(fakeStarter.CalledWith).To(BeEmpty())
+			})
+		})
+
+		Context("when the access token expired but the refresh token is valid", func() {
+			BeforeEach(func() {
+				writeCfConfig("https://api.my-cf.com", time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+			})
+
+			It("leaves refreshing the token to the cf CLI", func() {
+				userContext.Login()
+				Expect(fakeStarter.CalledWith).To(BeEmpty())
+			})
+		})
+
+		Context("when both tokens expired", func() {
+			BeforeEach(func() {
+				writeCfConfig("https://api.my-cf.com", time.Now().Add(-time.Hour), time.Now().Add(-time.Minute))
+			})
+
+			It("authenticates again", func() {
+				userContext.Login()
+				Expect(fakeStarter.CalledWith).To(HaveLen(2))
+			})
+		})
+
+		Context("when the cached login targets another API", func() {
+			BeforeEach(func() {
+				writeCfConfig("https://api.other-cf.com", time.Now().Add(time.Hour), time.Now().Add(time.Hour))
+			})
+
+			It("authenticates again", func() {
+				userContext.Login()
+				Expect(fakeStarter.CalledWith).To(HaveLen(2))
+			})
+		})
+
+		Describe("ClearCachedLogin", func() {
+			It("logs out and removes the cached CF_HOME", func() {
+				userContext.ClearCachedLogin()
+
+				Expect(fakeStarter.CalledWith).To(HaveLen(1))
+				Expect(fakeStarter.CalledWith[0].Args).To(Equal([]string{"logout"}))
+				Expect(fakeStarter.CalledWith[0].Env).To(Equal([]string{"CF_HOME=" + cachedCfHomeDir}))
+				Expect(cachedCfHomeDir).NotTo(BeADirectory())
+			})
+		})
+
+		Context("when the context also has an isolated CF_HOME", func() {
+			BeforeEach(func() {
+				userContext.CfHomeDir = ""
+				userContext = userContext.WithIsolatedCfHome().WithCachedLogin()
+				cachedCfHomeDir = userContext.CfHomeDir
+			})
+
+			It("caches the login in the isolated CF_HOME", func() {
+				writeCfConfig("https://api.my-cf.com", time.Now().Add(time.Hour), time.Now().Add(time.Hour))
+
+				userContext.Login()
+				Expect(fakeStarter.CalledWith).To(BeEmpty())
+				Expect(os.Getenv("CF_HOME")).To(Equal("my-cf-home-dir"))
+			})
+		})
+	})
 })